@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/urfave/cli/v3"
+)
+
+var AdoptDescription = strings.TrimSpace(`
+Creates the local pr/XXX branch of a PR that has been opened without opp (by a colleague,
+or from another machine), so that opp push, opp rebase and opp merge work on it.
+The PR it depends on is found from its base on github: either the base branch, or another
+PR that needs to exist locally, so adopt the PRs of a chain root first.
+`)
+
+type adopter struct {
+	Repo  *core.Repo
+	Forge core.Forge
+}
+
+func AdoptCommand(repo *core.Repo, gh func(context.Context) core.Gh) *cli.Command {
+	cmd := &cli.Command{
+		Name:        "adopt",
+		ArgsUsage:   "pr-number",
+		Usage:       "Start tracking locally a PR created without opp.",
+		Description: AdoptDescription,
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if cmd.NArg() != 1 {
+				return cli.Exit("please give the number of the PR to adopt", 1)
+			}
+			number, err := core.ExtractPrNumber(cmd.Args().First())
+			if err != nil {
+				return cli.Exit(fmt.Errorf("%s is not a PR", cmd.Args().First()), 1)
+			}
+			forge, err := core.NewForge(ctx, gh)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			a := adopter{Repo: repo, Forge: forge}
+			pr, err := a.Adopt(ctx, number)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			fmt.Println(pr.Url())
+			return nil
+		},
+	}
+	return cmd
+}
+
+// Adopt creates the local branch and the state of a PR that exists on github.
+func (a *adopter) Adopt(ctx context.Context, number int) (*core.LocalPr, error) {
+	localBranch := core.NewBranch(a.Repo, core.LocalBranchForPr(number))
+	if _, err := a.Repo.GetLocalTip(localBranch); err == nil {
+		return nil, fmt.Errorf("%s already exists", localBranch.LocalName())
+	}
+	githubCtx, cancel := context.WithTimeoutCause(
+		ctx, core.GetGithubTimeout(),
+		fmt.Errorf("getting the PR too slow, increase github.timeout"),
+	)
+	defer cancel()
+	forgePr, err := a.Forge.GetPr(githubCtx, number)
+	if err != nil {
+		return nil, err
+	}
+	if forgePr.State != "open" {
+		return nil, fmt.Errorf("PR #%d is %s", number, forgePr.State)
+	}
+	if core.IsForkWorkflow() {
+		if owner, _, _ := strings.Cut(forgePr.HeadRepo, "/"); owner != core.GetForkOwner() {
+			return nil, fmt.Errorf("PR #%d comes from the fork of %s, opp can only adopt PRs pushed to the fork of %s", number, owner, core.GetForkOwner())
+		}
+	} else if forgePr.HeadRepo != core.GetGithubRepo() {
+		return nil, fmt.Errorf("PR #%d comes from a fork, opp can only adopt PRs whose branch is in %s", number, core.GetGithubRepo())
+	}
+	ancestor, err := a.AncestorFromBase(ctx, forgePr.Base)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Repo.Fetch(ctx); err != nil {
+		return nil, fmt.Errorf("error during fetch: %w", err)
+	}
+	head := forgePr.Head
+	// Like the PRs opp creates, the branch is on the push remote, the fork when there is one.
+	remoteBranch := core.NewBranchOnRemote(a.Repo, core.GetPushRemoteName(), head)
+	remoteTip, err := a.Repo.GetRemoteTip(remoteBranch)
+	if err != nil {
+		return nil, fmt.Errorf("could not find the branch %s of PR #%d: %w", core.RemoteRef(remoteBranch), number, err)
+	}
+	fmt.Printf("Creating %s from %s... ", localBranch.LocalName(), core.RemoteRef(remoteBranch))
+	if err := a.Repo.GitExec(ctx, "branch %s %s", localBranch.LocalName(), remoteTip).Run(); err != nil {
+		PrintFailure(err)
+		return nil, err
+	}
+	a.Repo.GitExec(ctx, "config branch.%s.rebase true", localBranch.LocalName()).Run()
+	PrintSuccess()
+
+	pr := core.NewLocalPr(a.Repo, number)
+	if head != core.RemoteBranchForPr(number) {
+		pr.SetRemoteBranch(head)
+	}
+	pr.SetAncestor(ancestor)
+	pr.AddKnownTip(remoteTip)
+	if ancestorTip, err := a.Repo.GetRemoteTip(ancestor); err == nil {
+		pr.AddAncestorKnownTip(ancestorTip)
+	}
+	if err := a.Repo.SetTrackingBranch(pr, ancestor); err != nil {
+		return pr, errors.New("the PR has been adopted but could not set tracking branch")
+	}
+	return pr, nil
+}
+
+// AncestorFromBase finds the branch a PR depends on from its base on github.
+func (a *adopter) AncestorFromBase(ctx context.Context, base string) (core.Branch, error) {
+	if base == a.Repo.BaseBranch().RemoteName() {
+		return a.Repo.BaseBranch(), nil
+	}
+	for _, pr := range a.Repo.AllPrs(ctx) {
+		if pr.RemoteBranch() == base {
+			pr := pr
+			return &pr, nil
+		}
+	}
+	// Branches of PRs created by opp are called <login>/pr/<number>.
+	parts := strings.Split(base, "/")
+	if len(parts) >= 3 && parts[len(parts)-2] == "pr" {
+		if number, err := strconv.Atoi(parts[len(parts)-1]); err == nil {
+			return nil, fmt.Errorf("this PR depends on PR #%d, run opp adopt %d first", number, number)
+		}
+	}
+	return nil, fmt.Errorf(
+		"this PR is based on %s, opp only handles PRs based on %s or on another PR",
+		base, a.Repo.BaseBranch().RemoteName(),
+	)
+}
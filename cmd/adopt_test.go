@@ -0,0 +1,80 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/cupcicm/opp/core/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdopt(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	// A colleague opened PR #7 from their own branch.
+	head := core.Must(r.GetHeadHash(context.Background()))
+	assert.NoError(t, r.Push(context.Background(), head, "alice/feature"))
+	r.GithubMock.PullRequestsMock.CallGetAndReturnBranches(7, "alice/feature", "master")
+
+	assert.NoError(t, r.Run("adopt", "7"))
+
+	pr := core.NewLocalPr(r.Repo, 7)
+	assert.Equal(t, head, core.Must(r.GetLocalTip(pr)))
+	assert.Equal(t, "master", core.Must(pr.GetAncestor()).LocalName())
+	assert.Equal(t, "alice/feature", pr.RemoteBranch())
+	assert.Equal(t, head, core.Must(r.GetRemoteTip(pr)))
+	upstream := core.Must(r.GitExec(context.Background(), "rev-parse --abbrev-ref pr/7@{upstream}").Output())
+	assert.Equal(t, "origin/master\n", string(upstream))
+
+	// Adopting it twice is an error.
+	assert.Error(t, r.Run("adopt", "pr/7"))
+}
+
+func TestAdoptFromFork(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.PushToFork(t)
+	ctx := context.Background()
+
+	// PR #7 was opened from the fork, its branch is only there.
+	head := core.Must(r.GetHeadHash(ctx))
+	assert.NoError(t, r.Push(ctx, head, "cupcicm/feature"))
+	r.GithubMock.PullRequestsMock.CallGetAndReturnForkBranches(7, "alice/opp", "cupcicm/feature", "master")
+
+	assert.NoError(t, r.Run("adopt", "7"))
+
+	pr := core.NewLocalPr(r.Repo, 7)
+	assert.Equal(t, head, core.Must(r.GetLocalTip(pr)))
+	assert.Equal(t, "cupcicm/feature", pr.RemoteBranch())
+	assert.Equal(t, head, core.Must(r.GetRefHash(ctx, "refs/remotes/fork/cupcicm/feature")))
+	assert.Equal(t, head, core.Must(r.GetRemoteTip(pr)))
+}
+
+func TestAdoptFindsAncestorPr(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	head := core.Must(r.GetHeadHash(context.Background()))
+	assert.NoError(t, r.Push(context.Background(), head, "cupcicm/pr/3"))
+	r.GithubMock.PullRequestsMock.CallGetAndReturnBranches(3, "cupcicm/pr/3", "cupcicm/pr/2")
+
+	assert.NoError(t, r.Run("adopt", "3"))
+
+	pr3 := core.NewLocalPr(r.Repo, 3)
+	assert.Equal(t, pr2.LocalBranch(), core.Must(pr3.GetAncestor()).LocalName())
+	assert.Contains(t, pr3.AncestorTips(), core.Must(r.GetLocalTip(pr2)))
+	assert.Equal(t, "cupcicm/pr/3", pr3.RemoteBranch())
+}
+
+func TestAdoptNeedsAncestorPrFirst(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnBranches(3, "alice/pr/3", "alice/pr/2")
+
+	err := r.Run("adopt", "3")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "run opp adopt 2 first")
+	}
+	_, err = r.GetLocalTip(core.NewBranch(r.Repo, "pr/3"))
+	assert.Error(t, err)
+}
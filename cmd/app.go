@@ -14,7 +14,8 @@ import (
 	"github.com/urfave/cli/v3"
 )
 
-func MakeApp(out io.Writer, in io.Reader, repo *core.Repo, gh func(context.Context) core.Gh, sf func(string, string) story.StoryFetcher) *cli.Command {
+func MakeApp(out io.Writer, in io.Reader, repo *core.Repo, gh func(context.Context) core.Gh, sf func(string, string) (story.StoryFetcher, error)) *cli.Command {
+	repo.UseRetargeter(retargeter(repo, gh))
 	return &cli.Command{
 		Name:  "opp",
 		Usage: "Create, update and merge Github pull requests from the command line.",
@@ -23,12 +24,15 @@ func MakeApp(out io.Writer, in io.Reader, repo *core.Repo, gh func(context.Conte
 			CleanCommand(repo, gh),
 			CloseCommand(repo, gh),
 			PrCommand(in, repo, gh, sf),
-			MergeCommand(repo, gh),
+			MergeCommand(repo, gh, sf),
 			StatusCommand(out, repo, gh),
-			RebaseCommand(repo),
-			PushCommand(repo),
+			TreeCommand(out, repo, gh),
+			RebaseCommand(repo, gh),
+			PushCommand(repo, gh),
 			CommentCommand(repo, gh),
 			LinkCommand(repo, gh),
+			AdoptCommand(repo, gh),
+			DoctorCommand(repo),
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			// Called only if no subcommand match.
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cupcicm/opp/core"
+)
+
+var ErrAlreadyMerged = errors.New("already merged")
+
+// EnableAutoMerge asks github to merge the PR with github.merge.method
+// as soon as it becomes mergeable.
+func (m *merger) EnableAutoMerge(ctx context.Context, pr *core.LocalPr) error {
+	ctx, cancel := context.WithTimeoutCause(
+		ctx, core.GetGithubTimeout(),
+		fmt.Errorf("enabling auto-merge too slow, increase github.timeout"),
+	)
+	defer cancel()
+	githubPr, _, err := m.PullRequests.Get(ctx, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber)
+	if err != nil {
+		return err
+	}
+	if githubPr.GetMerged() {
+		return ErrAlreadyMerged
+	}
+	if githubPr.GetMergeableState() == "clean" {
+		return fmt.Errorf("%s is already mergeable, use opp merge instead", pr.LocalBranch())
+	}
+	fmt.Printf("Enabling auto-merge on %s... ", pr.LocalBranch())
+	if err := m.AutoMerge.Enable(ctx, githubPr.GetNodeID(), core.GetGithubMergeMethod()); err != nil {
+		PrintFailure(err)
+		return err
+	}
+	PrintSuccess()
+	pr.SetAutoMerge(true)
+	return nil
+}
+
+// EnableAutoMergeOnChain enables auto-merge on the root of the chain, and
+// records in the state of the other PRs that they are waiting for it.
+// Running it again after the root has been merged cleans the root up, rebases
+// the next PR on the base branch and enables auto-merge on it.
+func (m *merger) EnableAutoMergeOnChain(ctx context.Context, pr *core.LocalPr) error {
+	chain := append(pr.AllAncestors(), pr)
+	if len(chain) > 1 && !m.Repo.NoLocalChanges(ctx) {
+		return errors.New("there are uncommitted changes. Cannot enable auto-merge on a PR chain")
+	}
+	for i, current := range chain {
+		if i > 0 {
+			hasBeenMerged, err := m.prepareNextInChain(ctx, current)
+			if err != nil {
+				return err
+			}
+			if hasBeenMerged {
+				continue
+			}
+		}
+		err := m.EnableAutoMerge(ctx, current)
+		if errors.Is(err, ErrAlreadyMerged) {
+			fmt.Printf("%s has already been merged.\n", current.LocalBranch())
+			if err := m.CleanupAfterMerge(ctx, current); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, waiting := range chain[i+1:] {
+			waiting.SetAutoMerge(true)
+			fmt.Printf("%s is waiting for %s to be merged.\n", waiting.LocalBranch(), current.LocalBranch())
+		}
+		if i+1 < len(chain) {
+			fmt.Printf("Run opp merge --auto --chain %s again once %s has been merged.\n", pr.LocalBranch(), current.LocalBranch())
+		}
+		return nil
+	}
+	return nil
+}
+
+// CancelAutoMerge disables auto-merge on github for the root of the chain
+// and forgets that the rest of the chain was waiting for it.
+func (m *merger) CancelAutoMerge(ctx context.Context, pr *core.LocalPr) error {
+	ctx, cancel := context.WithTimeoutCause(
+		ctx, core.GetGithubTimeout(),
+		fmt.Errorf("disabling auto-merge too slow, increase github.timeout"),
+	)
+	defer cancel()
+	chain := append(pr.AllAncestors(), pr)
+	root := chain[0]
+	githubPr, _, err := m.PullRequests.Get(ctx, core.GetGithubOwner(), core.GetGithubRepoName(), root.PrNumber)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Disabling auto-merge on %s... ", root.LocalBranch())
+	if err := m.AutoMerge.Disable(ctx, githubPr.GetNodeID()); err != nil {
+		PrintFailure(err)
+		return err
+	}
+	PrintSuccess()
+	for _, waiting := range chain {
+		waiting.SetAutoMerge(false)
+	}
+	return nil
+}
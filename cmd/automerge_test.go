@@ -0,0 +1,87 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/cupcicm/opp/core/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoMerge(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD", 2)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeableState(2, "blocked")
+	r.GithubMock.AutoMergeMock.CallEnable(2)
+
+	assert.Nil(t, r.Run("merge", "--auto", "pr/2"))
+
+	r.GithubMock.AutoMergeMock.AssertExpectations(t)
+	pr2.ReloadState()
+	assert.True(t, pr2.AutoMerge())
+}
+
+func TestAutoMergeNeedsAncestorsToBeMerged(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.CreatePr(t, "HEAD^", 2)
+	r.CreatePr(t, "HEAD", 3)
+
+	assert.Error(t, r.Run("merge", "--auto", "pr/3"))
+	r.GithubMock.AutoMergeMock.AssertNotCalled(t, "Enable")
+}
+
+func TestAutoMergeChain(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeableState(2, "blocked")
+	r.GithubMock.AutoMergeMock.CallEnable(2)
+
+	assert.Nil(t, r.Run("merge", "--auto", "--chain", "pr/3"))
+
+	pr2.ReloadState()
+	pr3.ReloadState()
+	assert.True(t, pr2.AutoMerge())
+	assert.True(t, pr3.AutoMerge())
+
+	// Github merges pr/2, running the command again queues pr/3.
+	assert.Nil(t, r.Push(context.Background(), core.Must(r.GetLocalTip(pr2)), "master"))
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMerged(2)
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeableState(3, "blocked")
+	r.GithubMock.AutoMergeMock.CallEnable(3)
+
+	assert.Nil(t, r.Run("merge", "--auto", "--chain", "pr/3"))
+
+	r.GithubMock.AutoMergeMock.AssertExpectations(t)
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+	assert.Len(t, core.Must(r.AllLocalPrs()), 1)
+	pr3.ReloadState()
+	assert.Equal(t, "master", core.Must(pr3.GetAncestor()).LocalName())
+}
+
+func TestCancelAutoMerge(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+	pr2.SetAutoMerge(true)
+	pr3.SetAutoMerge(true)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeableState(2, "blocked")
+	r.GithubMock.AutoMergeMock.CallDisable(2)
+
+	assert.Nil(t, r.Run("merge", "--cancel-auto", "pr/3"))
+
+	r.GithubMock.AutoMergeMock.AssertExpectations(t)
+	pr2.ReloadState()
+	pr3.ReloadState()
+	assert.False(t, pr2.AutoMerge())
+	assert.False(t, pr3.AutoMerge())
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/google/go-github/v56/github"
+)
+
+var checksPollInterval = time.Second * 10
+
+const (
+	checkPending = "pending"
+	checkSuccess = "success"
+	checkFailure = "failure"
+)
+
+// A check is either a commit status or a check run, github reports both
+// on the commits of a PR.
+type check struct {
+	Name  string
+	State string
+	Url   string
+}
+
+// WaitForChecks polls the checks of the local tip of the PR until they all
+// succeed, one of them fails, or github.checks.timeout expires.
+// Each check is printed every time its state changes.
+// A PR without any checks is only considered green after github.checks.grace-period.
+func (m *merger) WaitForChecks(ctx context.Context, pr *core.LocalPr) error {
+	tip, err := m.Repo.GetLocalTip(pr)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeoutCause(
+		ctx, core.GetGithubChecksTimeout(),
+		fmt.Errorf("checks of %s did not complete in time, increase github.checks.timeout", pr.LocalBranch()),
+	)
+	defer cancel()
+	t := time.NewTicker(checksPollInterval)
+	defer t.Stop()
+
+	fmt.Printf("Waiting for the checks of %s...\n", pr.LocalBranch())
+	noChecksUntil := time.Now().Add(core.GetGithubChecksGracePeriod())
+	printed := make(map[string]string)
+	for {
+		checks, err := m.getChecks(ctx, tip)
+		if err != nil {
+			return err
+		}
+		for _, c := range checks {
+			if printed[c.Name] != c.State {
+				printed[c.Name] = c.State
+				fmt.Printf("  %s %s\n", checkEmoji(c.State), c.Name)
+			}
+		}
+		failed := slices.DeleteFunc(slices.Clone(checks), func(c check) bool {
+			return c.State != checkFailure
+		})
+		if len(failed) > 0 {
+			lines := make([]string, len(failed))
+			for i, c := range failed {
+				lines[i] = fmt.Sprintf("%s: %s", c.Name, c.Url)
+			}
+			return fmt.Errorf("some checks failed:\n  - %s", strings.Join(lines, "\n  - "))
+		}
+		waitingForChecks := len(checks) == 0 && time.Now().Before(noChecksUntil)
+		if !waitingForChecks && !slices.ContainsFunc(checks, func(c check) bool { return c.State == checkPending }) {
+			return nil
+		}
+		select {
+		case <-t.C:
+			// Poll again
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// Returns both the commit statuses and the check runs of the given commit.
+func (m *merger) getChecks(ctx context.Context, sha string) ([]check, error) {
+	ctx, cancel := context.WithTimeoutCause(
+		ctx, core.GetGithubTimeout(),
+		fmt.Errorf("getting the checks of a PR too slow, increase github.timeout"),
+	)
+	defer cancel()
+	var statuses []*github.RepoStatus
+	statusOptions := &github.ListOptions{PerPage: 100}
+	for {
+		status, response, err := m.Repositories.GetCombinedStatus(
+			ctx, core.GetGithubOwner(), core.GetGithubRepoName(), sha, statusOptions,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not get the statuses of %s: %w", sha, err)
+		}
+		statuses = append(statuses, status.Statuses...)
+		if response == nil || response.NextPage == 0 {
+			break
+		}
+		statusOptions.Page = response.NextPage
+	}
+	var runs []*github.CheckRun
+	runOptions := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		result, response, err := m.Checks.ListCheckRunsForRef(
+			ctx, core.GetGithubOwner(), core.GetGithubRepoName(), sha, runOptions,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not get the check runs of %s: %w", sha, err)
+		}
+		runs = append(runs, result.CheckRuns...)
+		if response == nil || response.NextPage == 0 {
+			break
+		}
+		runOptions.Page = response.NextPage
+	}
+	checks := make([]check, 0, len(statuses)+len(runs))
+	for _, s := range statuses {
+		state := checkPending
+		switch s.GetState() {
+		case "success":
+			state = checkSuccess
+		case "failure", "error":
+			state = checkFailure
+		}
+		checks = append(checks, check{Name: s.GetContext(), State: state, Url: s.GetTargetURL()})
+	}
+	for _, r := range runs {
+		state := checkPending
+		if r.GetStatus() == "completed" {
+			switch r.GetConclusion() {
+			case "success", "neutral", "skipped":
+				state = checkSuccess
+			default:
+				state = checkFailure
+			}
+		}
+		checks = append(checks, check{Name: r.GetName(), State: state, Url: r.GetHTMLURL()})
+	}
+	return checks, nil
+}
+
+func checkEmoji(state string) string {
+	switch state {
+	case checkSuccess:
+		return "✅"
+	case checkFailure:
+		return "❌"
+	default:
+		return "⏳"
+	}
+}
+
+func SetShortChecksIntervalForTests() func() {
+	initial := checksPollInterval
+	checksPollInterval = time.Millisecond
+	return func() {
+		checksPollInterval = initial
+	}
+}
@@ -8,30 +8,66 @@ import (
 	"github.com/urfave/cli/v3"
 )
 
+type prLookup struct {
+	pr  *core.Pr
+	err error
+}
+
 func CleanCommand(repo *core.Repo, gh func(context.Context) core.Gh) *cli.Command {
 	cmd := &cli.Command{
 		Name:        "clean",
 		Aliases:     []string{"gc"},
 		Description: "Deletes all local PRs that have been closed on github",
 		Action: func(ctx context.Context, cmd *cli.Command) error {
+			forge, err := core.NewForge(ctx, gh)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
 			repo.Fetch(ctx)
 			localPrs := repo.AllPrs(ctx)
+			var stillOnGithub []int
 			for _, pr := range localPrs {
-				pullRequests := gh(ctx).PullRequests()
 				_, err := repo.GetRemoteTip(&pr)
-				if errors.Is(err, core.ErrReferenceNotFound) {
+				if !errors.Is(err, core.ErrReferenceNotFound) {
+					stillOnGithub = append(stillOnGithub, pr.PrNumber)
+				}
+			}
+			lookups, err := core.ParallelMap(ctx, stillOnGithub, core.GetGithubConcurrency(), func(ctx context.Context, number int) prLookup {
+				forgePr, err := forge.GetPr(ctx, number)
+				return prLookup{pr: forgePr, err: err}
+			})
+			if err != nil {
+				return err
+			}
+			var dependents []*core.LocalPr
+			var failed []error
+			cleanup := func(pr *core.LocalPr) {
+				cleaned, err := repo.CleanupAfterMerge(ctx, pr)
+				if err != nil {
+					failed = append(failed, err)
+				}
+				dependents = append(dependents, cleaned...)
+			}
+			for _, pr := range localPrs {
+				pr := pr
+				lookup, found := lookups[pr.PrNumber]
+				if !found {
 					// The remote tip does not exist anymore : it has been deleted on the github repo.
 					// Probably because the PR is either abandonned or merged.
-					repo.CleanupAfterMerge(ctx, &pr)
-				} else {
-					githubPr, _, err := pullRequests.Get(ctx, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber)
-					if err != nil {
-						return err
-					}
-					if *githubPr.State == "closed" {
-						repo.CleanupAfterMerge(ctx, &pr)
-					}
+					cleanup(&pr)
+					continue
 				}
+				if lookup.err != nil {
+					return lookup.err
+				}
+				if lookup.pr.State == "closed" {
+					cleanup(&pr)
+				}
+			}
+			stacks := stack{Repo: repo, PullRequests: gh(ctx).PullRequests()}
+			stacks.Update(ctx, dependents...)
+			if len(failed) > 0 {
+				return cli.Exit(errors.Join(failed...), 1)
 			}
 			return nil
 		},
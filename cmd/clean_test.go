@@ -34,8 +34,10 @@ func TestCleanupCleansDependencies(t *testing.T) {
 
 	r.DeleteRemoteBranch(context.Background(), pr2)
 	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(3, true)
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
 
 	assert.Nil(t, r.Run("clean"))
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
 
 	_, err := r.GetLocalTip(pr2)
 	assert.NotNil(t, err)
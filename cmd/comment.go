@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/cupcicm/opp/core"
-	"github.com/google/go-github/v56/github"
 	"github.com/urfave/cli/v3"
 )
 
@@ -33,14 +32,17 @@ func CommentCommand(repo *core.Repo, gh func(context.Context) core.Gh) *cli.Comm
 			if err != nil {
 				return err
 			}
+			forge, err := core.NewForge(ctx, gh)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
 			ctx, cancel := context.WithTimeoutCause(
 				ctx, core.GetGithubTimeout(),
 				fmt.Errorf("adding comment too slow, increase github.timeout"),
 			)
 			defer cancel()
 
-			_, _, err = gh(ctx).Issues().CreateComment(ctx, core.GetGithubOwner(),
-				core.GetGithubRepoName(), pr.PrNumber, &github.IssueComment{Body: &comment})
+			err = forge.Comment(ctx, pr.PrNumber, comment)
 			if err != nil {
 				PrintFailure(nil)
 				return err
@@ -0,0 +1,416 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/spf13/viper"
+	"github.com/urfave/cli/v3"
+)
+
+var DoctorDescription = strings.TrimSpace(`
+Checks that the local PRs, their branches and the state opp keeps in .opp/state are consistent:
+every pr/XXX branch has a state and the other way around, the ancestor of each PR exists,
+there are no cycles in the ancestry, the tracking branches match the ancestors, the PRs exist
+on github and the config has all the required keys.
+With --fix, repairs what can be repaired without losing work.
+`)
+
+func DoctorCommand(repo *core.Repo) *cli.Command {
+	return &cli.Command{
+		Name:        "doctor",
+		Usage:       "Check the state of the local PRs, and repair it",
+		Description: DoctorDescription,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "fix",
+				Usage: "repair the problems that can be repaired safely",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if err := repo.Fetch(ctx); err != nil {
+				fmt.Printf("Could not fetch, the remote branches may be out of date (%s)\n", err)
+			}
+			d := doctor{Repo: repo, Fix: cmd.Bool("fix")}
+			remaining := d.Run(ctx)
+			if remaining > 0 {
+				return cli.Exit(fmt.Sprintf("%d problem(s) left", remaining), 1)
+			}
+			return nil
+		},
+	}
+}
+
+type doctor struct {
+	Repo *core.Repo
+	Fix  bool
+}
+
+type problem struct {
+	Description string
+	// Repairs the problem, nil when it cannot be repaired safely.
+	Fix func(ctx context.Context) error
+}
+
+type doctorCheck struct {
+	Name string
+	Run  func(ctx context.Context) []problem
+}
+
+// Run runs all the checks in order, so that each check sees the repairs
+// of the previous ones, and returns the number of problems left.
+func (d *doctor) Run(ctx context.Context) int {
+	checks := []doctorCheck{
+		{"Config", d.CheckConfig},
+		{"State files can be read", d.CheckCorruptStates},
+		{"Every pr branch has a state", d.CheckBranchesWithoutState},
+		{"Every state has a pr branch", d.CheckStatesWithoutBranch},
+		{"Ancestors exist", d.CheckAncestors},
+		{"No cycles between PRs", d.CheckCycles},
+		{"Tracking branches match ancestors", d.CheckTrackingBranches},
+		{"PRs are on github", d.CheckRemoteBranches},
+	}
+	remaining := 0
+	for _, c := range checks {
+		fmt.Printf("%s... ", c.Name)
+		problems := c.Run(ctx)
+		if len(problems) == 0 {
+			PrintSuccess()
+			continue
+		}
+		PrintFailure(nil)
+		for _, p := range problems {
+			switch {
+			case p.Fix == nil:
+				fmt.Printf("  - %s\n", p.Description)
+				remaining++
+			case !d.Fix:
+				fmt.Printf("  - %s (fix with opp doctor --fix)\n", p.Description)
+				remaining++
+			default:
+				if err := p.Fix(ctx); err != nil {
+					fmt.Printf("  - %s (could not fix: %s)\n", p.Description, err)
+					remaining++
+				} else {
+					fmt.Printf("  - %s (fixed)\n", p.Description)
+				}
+			}
+		}
+	}
+	return remaining
+}
+
+func (d *doctor) CheckConfig(ctx context.Context) []problem {
+	var problems []problem
+	if credential := core.ForgeCredential(); core.GetForgeToken() == "" {
+		problems = append(problems, problem{
+			Description: fmt.Sprintf(
+				"no %s found, set %s, %s-command or %s in %s",
+				credential.Key, credential.EnvVars[0], credential.Key, credential.Key, d.Repo.Config(),
+			),
+		})
+	}
+	for _, key := range []string{"github.login", "repo.github", "repo.remote", "repo.branch"} {
+		if viper.GetString(key) == "" {
+			problems = append(problems, problem{
+				Description: fmt.Sprintf("%s is not set in %s", key, d.Repo.Config()),
+			})
+		}
+	}
+	if repo := viper.GetString("repo.github"); repo != "" && !strings.Contains(repo, "/") {
+		problems = append(problems, problem{
+			Description: fmt.Sprintf("repo.github should look like owner/repo, not %s", repo),
+		})
+	}
+	if branch := core.GetBaseBranch(); branch != "" {
+		if _, err := d.Repo.GetLocalTip(d.Repo.BaseBranch()); err != nil {
+			problems = append(problems, problem{
+				Description: fmt.Sprintf("the base branch %s does not exist locally", branch),
+			})
+		}
+	}
+	return problems
+}
+
+func (d *doctor) CheckCorruptStates(ctx context.Context) []problem {
+	var problems []problem
+	for _, number := range d.stateNumbers(ctx) {
+		number := number
+		pr := &core.LocalPr{Repo: d.Repo, PrNumber: number}
+		_, err := d.Repo.StateStore().LoadBranchState(pr)
+		if !errors.Is(err, core.ErrCorruptState) {
+			continue
+		}
+		problems = append(problems, problem{
+			Description: fmt.Sprintf("the state of %s cannot be read", pr.LocalBranch()),
+			Fix: func(ctx context.Context) error {
+				file, err := d.Repo.StateStore().SetAsideBranchState(pr)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("  - the old state has been moved to %s\n", file)
+				if _, err := d.Repo.GetLocalTip(pr); err != nil {
+					// Nothing to rebuild, the next checks deal with the missing branch.
+					return nil
+				}
+				return d.rebuildState(ctx, number)
+			},
+		})
+	}
+	return problems
+}
+
+func (d *doctor) CheckBranchesWithoutState(ctx context.Context) []problem {
+	branches, err := d.Repo.AllLocalPrs()
+	if err != nil {
+		return []problem{{Description: err.Error()}}
+	}
+	states := d.stateNumbers(ctx)
+	var problems []problem
+	for _, number := range sortedKeys(branches) {
+		if slices.Contains(states, number) {
+			continue
+		}
+		number := number
+		problems = append(problems, problem{
+			Description: fmt.Sprintf("%s has no state", core.LocalBranchForPr(number)),
+			Fix: func(ctx context.Context) error {
+				return d.rebuildState(ctx, number)
+			},
+		})
+	}
+	return problems
+}
+
+func (d *doctor) CheckStatesWithoutBranch(ctx context.Context) []problem {
+	branches, err := d.Repo.AllLocalPrs()
+	if err != nil {
+		return []problem{{Description: err.Error()}}
+	}
+	var problems []problem
+	for _, number := range d.stateNumbers(ctx) {
+		if _, found := branches[number]; found {
+			continue
+		}
+		pr, err := core.LoadLocalPr(d.Repo, number)
+		if err != nil {
+			pr = &core.LocalPr{Repo: d.Repo, PrNumber: number}
+		}
+		remoteTip, err := d.Repo.GetRemoteTip(pr)
+		if err != nil {
+			problems = append(problems, problem{
+				Description: fmt.Sprintf("%s has a state but no branch, locally or on github", pr.LocalBranch()),
+				Fix: func(ctx context.Context) error {
+					pr.DeleteState()
+					return nil
+				},
+			})
+			continue
+		}
+		problems = append(problems, problem{
+			Description: fmt.Sprintf("%s has been deleted locally but still exists on github", pr.LocalBranch()),
+			Fix: func(ctx context.Context) error {
+				if err := d.Repo.GitExec(ctx, "branch %s %s", pr.LocalBranch(), remoteTip).Run(); err != nil {
+					return err
+				}
+				return d.Repo.GitExec(ctx, "config branch.%s.rebase true", pr.LocalBranch()).Run()
+			},
+		})
+	}
+	return problems
+}
+
+func (d *doctor) CheckAncestors(ctx context.Context) []problem {
+	var problems []problem
+	for _, pr := range d.prs(ctx) {
+		pr := pr
+		ancestor, err := d.ancestorOf(pr)
+		var description string
+		switch {
+		case err != nil:
+			description = fmt.Sprintf("%s has no ancestor", pr.LocalBranch())
+		case d.branchExists(ancestor):
+			continue
+		default:
+			description = fmt.Sprintf("%s depends on %s, that does not exist", pr.LocalBranch(), ancestor.LocalName())
+		}
+		problems = append(problems, problem{
+			Description: description,
+			Fix: func(ctx context.Context) error {
+				pr.SetAncestor(d.Repo.BaseBranch())
+				return d.Repo.SetTrackingBranch(pr, d.Repo.BaseBranch())
+			},
+		})
+	}
+	return problems
+}
+
+func (d *doctor) CheckCycles(ctx context.Context) []problem {
+	prs := d.prs(ctx)
+	ancestors := make(map[int]int)
+	for _, pr := range prs {
+		if number, err := core.ExtractPrNumber(pr.AncestorName()); err == nil {
+			ancestors[pr.PrNumber] = number
+		}
+	}
+	var problems []problem
+	reported := make(map[int]bool)
+	for _, pr := range prs {
+		var chain []int
+		current, ok := pr.PrNumber, true
+		for ok && !slices.Contains(chain, current) {
+			chain = append(chain, current)
+			current, ok = ancestors[current]
+		}
+		if !ok || reported[current] {
+			continue
+		}
+		// current is the first PR of the cycle.
+		cycle := chain[slices.Index(chain, current):]
+		var names []string
+		for _, number := range cycle {
+			reported[number] = true
+			names = append(names, core.LocalBranchForPr(number))
+		}
+		names = append(names, core.LocalBranchForPr(current))
+		problems = append(problems, problem{
+			Description: fmt.Sprintf(
+				"%s: change the ancestor of one of them in %s",
+				strings.Join(names, " depends on "), path.Join(d.Repo.DotOpDir(), "state", "pr"),
+			),
+		})
+	}
+	return problems
+}
+
+func (d *doctor) CheckTrackingBranches(ctx context.Context) []problem {
+	var problems []problem
+	for _, pr := range d.prs(ctx) {
+		pr := pr
+		ancestor, err := d.ancestorOf(pr)
+		if err != nil || !d.branchExists(ancestor) {
+			continue
+		}
+		expected := fmt.Sprintf("refs/heads/%s", ancestor.RemoteName())
+		remote, _ := d.Repo.GitExec(ctx, "config branch.%s.remote", pr.LocalBranch()).Output()
+		merge, _ := d.Repo.GitExec(ctx, "config branch.%s.merge", pr.LocalBranch()).Output()
+		if strings.TrimSpace(string(remote)) == ancestor.Remote() && strings.TrimSpace(string(merge)) == expected {
+			continue
+		}
+		problems = append(problems, problem{
+			Description: fmt.Sprintf("%s does not track %s", pr.LocalBranch(), core.RemoteRef(ancestor)),
+			Fix: func(ctx context.Context) error {
+				return d.Repo.SetTrackingBranch(pr, ancestor)
+			},
+		})
+	}
+	return problems
+}
+
+func (d *doctor) CheckRemoteBranches(ctx context.Context) []problem {
+	var problems []problem
+	for _, pr := range d.prs(ctx) {
+		if _, err := d.Repo.GetRemoteTip(pr); err == nil {
+			continue
+		}
+		problems = append(problems, problem{
+			Description: fmt.Sprintf(
+				"%s does not exist: run opp push %s, or opp clean if it has been merged",
+				core.RemoteRef(pr), pr.LocalBranch(),
+			),
+		})
+	}
+	return problems
+}
+
+// Recreates the state of a PR from its branch: the ancestor is the branch it tracks.
+func (d *doctor) rebuildState(ctx context.Context, number int) error {
+	pr := core.NewLocalPr(d.Repo, number)
+	ancestor := d.trackedAncestor(ctx, pr)
+	pr.SetAncestor(ancestor)
+	if ancestor.IsPr() {
+		if tip, err := d.Repo.GetLocalTip(ancestor); err == nil {
+			pr.AddAncestorKnownTip(tip)
+		}
+	}
+	pr.RememberCurrentTip()
+	return d.Repo.SetTrackingBranch(pr, ancestor)
+}
+
+// Finds the branch a PR depends on from its tracking branch, defaults to the base branch.
+func (d *doctor) trackedAncestor(ctx context.Context, pr *core.LocalPr) core.Branch {
+	merge, err := d.Repo.GitExec(ctx, "config branch.%s.merge", pr.LocalBranch()).Output()
+	if err != nil {
+		return d.Repo.BaseBranch()
+	}
+	tracked := strings.TrimPrefix(strings.TrimSpace(string(merge)), "refs/heads/")
+	for _, other := range d.prs(ctx) {
+		if other.PrNumber != pr.PrNumber && other.RemoteBranch() == tracked {
+			return other
+		}
+	}
+	return d.Repo.BaseBranch()
+}
+
+// The PRs that have both a branch and a readable state. Unlike Repo.AllPrs,
+// it does not warn about the other ones: the checks report them.
+func (d *doctor) prs(ctx context.Context) []*core.LocalPr {
+	var prs []*core.LocalPr
+	for _, number := range d.stateNumbers(ctx) {
+		pr, err := core.LoadLocalPr(d.Repo, number)
+		if err != nil {
+			continue
+		}
+		if _, err := d.Repo.GetLocalTip(pr); err == nil {
+			prs = append(prs, pr)
+		}
+	}
+	return prs
+}
+
+// Like LocalPr.GetAncestor, but does not create a state for an ancestor PR that has none.
+func (d *doctor) ancestorOf(pr *core.LocalPr) (core.Branch, error) {
+	name := pr.AncestorName()
+	if name == "" {
+		return nil, errors.New("no ancestor")
+	}
+	number, err := core.ExtractPrNumber(name)
+	if err != nil {
+		return core.NewBranch(d.Repo, name), nil
+	}
+	if ancestor, err := core.LoadLocalPr(d.Repo, number); err == nil {
+		return ancestor, nil
+	}
+	return &core.LocalPr{Repo: d.Repo, PrNumber: number}, nil
+}
+
+func (d *doctor) branchExists(branch core.Branch) bool {
+	if _, err := d.Repo.GetLocalTip(branch); err == nil {
+		return true
+	}
+	if branch.IsPr() {
+		return false
+	}
+	_, err := d.Repo.GetRemoteTip(branch)
+	return err == nil
+}
+
+func (d *doctor) stateNumbers(ctx context.Context) []int {
+	numbers := d.Repo.StateStore().AllLocalPrNumbers(ctx)
+	slices.Sort(numbers)
+	return numbers
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
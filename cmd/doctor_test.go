@@ -0,0 +1,103 @@
+package cmd_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/cupcicm/opp/core/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoctorOnHealthyRepo(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.CreatePr(t, "HEAD^", 2)
+	r.CreatePr(t, "HEAD", 3)
+
+	assert.Nil(t, r.Run("doctor"))
+}
+
+func TestDoctorRebuildsMissingState(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+	pr3.DeleteState()
+
+	assert.NotNil(t, r.Run("doctor"))
+	assert.False(t, core.FileExists(r.StateStore().StateBranchFile(pr3)))
+
+	assert.Nil(t, r.Run("doctor", "--fix"))
+	pr3.ReloadState()
+	// The ancestor is found from the tracking branch.
+	assert.Equal(t, pr2.LocalBranch(), core.Must(pr3.GetAncestor()).LocalName())
+	assert.Contains(t, pr3.AncestorTips(), core.Must(r.GetLocalTip(pr2)))
+	assert.Nil(t, r.Run("doctor"))
+}
+
+func TestDoctorSetsAsideCorruptState(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD", 2)
+	file := r.StateStore().StateBranchFile(pr2)
+	assert.NoError(t, os.WriteFile(file, []byte("ancestor: [unclosed"), 0600))
+
+	// Loading a corrupt state does not panic.
+	assert.Equal(t, "pr/2", core.NewLocalPr(r.Repo, 2).LocalBranch())
+
+	assert.Nil(t, r.Run("doctor", "--fix"))
+	assert.FileExists(t, file+".corrupt")
+	pr2.ReloadState()
+	assert.Equal(t, "master", core.Must(pr2.GetAncestor()).LocalName())
+	assert.Nil(t, r.Run("doctor"))
+}
+
+func TestDoctorRecreatesLostBranches(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+	tip := core.Must(r.GetLocalTip(pr2))
+	assert.NoError(t, r.GitExec(context.Background(), "branch -D pr/2").Run())
+
+	// The lost PR is not cleaned up behind the user's back.
+	prs := r.AllPrs(context.Background())
+	assert.Len(t, prs, 1)
+	assert.True(t, core.FileExists(r.StateStore().StateBranchFile(pr2)))
+	assert.Equal(t, tip, core.Must(r.GetRemoteTip(pr2)))
+
+	assert.Nil(t, r.Run("doctor", "--fix"))
+	assert.Equal(t, tip, core.Must(r.GetLocalTip(pr2)))
+	pr3.ReloadState()
+	assert.Equal(t, pr2.LocalBranch(), core.Must(pr3.GetAncestor()).LocalName())
+}
+
+func TestDoctorForgetsPrsThatDoNotExistAnymore(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+	assert.NoError(t, r.GitExec(context.Background(), "branch -D pr/2").Run())
+	r.DeleteRemoteBranch(context.Background(), pr2)
+	assert.NoError(t, r.Fetch(context.Background()))
+
+	assert.Nil(t, r.Run("doctor", "--fix"))
+	assert.False(t, core.FileExists(r.StateStore().StateBranchFile(pr2)))
+	pr3.ReloadState()
+	assert.Equal(t, "master", core.Must(pr3.GetAncestor()).LocalName())
+	assert.Nil(t, r.Run("doctor"))
+}
+
+func TestDoctorReportsCycles(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+	pr2.SetAncestor(pr3)
+	r.SetTrackingBranch(pr2, pr3)
+
+	assert.Len(t, pr3.AllAncestors(), 1)
+	assert.NotNil(t, r.Run("doctor", "--fix"))
+}
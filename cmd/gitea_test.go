@@ -0,0 +1,108 @@
+package cmd_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cupcicm/opp/cmd"
+	"github.com/cupcicm/opp/core"
+	"github.com/cupcicm/opp/core/story"
+	"github.com/cupcicm/opp/core/tests"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func giteaPr(number int, mergeable bool, sha string) *tests.FakeGiteaPr {
+	pr := &tests.FakeGiteaPr{Number: number, Title: "PR", State: "open", Mergeable: mergeable}
+	pr.Head.Sha = sha
+	return pr
+}
+
+func TestCreatePrOnGitea(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	gitea := tests.NewFakeGitea(t)
+	// Issues and PRs share their numbers.
+	gitea.Issues = []int{1}
+	r.StoryFetcherMock.CallFetchInProgressStories([]story.Story{}, false)
+
+	require.NoError(t, r.Run("pr", "--draft", "HEAD"))
+
+	pr := r.AssertHasPr(t, 2)
+	require.Contains(t, gitea.PullRequests, 2)
+	created := gitea.PullRequests[2]
+	assert.Equal(t, "cupcicm/pr/2", created.Head.Ref)
+	assert.Equal(t, "master", created.Base.Ref)
+	assert.True(t, strings.HasPrefix(created.Title, "WIP: "))
+	assert.Equal(t, gitea.URL+"/cupcicm/opp/pulls/2", pr.Url())
+}
+
+func TestStatusOnGitea(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD^", 2)
+	r.CreatePr(t, "HEAD", 3)
+	tests.NewFakeGitea(t, giteaPr(2, true, ""), giteaPr(3, false, ""))
+
+	require.NoError(t, r.Run("status", "--json"))
+
+	lines := strings.Split(strings.TrimSpace(r.Out.String()), "\n")
+	require.Len(t, lines, 2)
+	var first, second cmd.PrStatus
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+
+	assert.True(t, first.Mergeable)
+	assert.Equal(t, "clean", first.MergeableState)
+	assert.True(t, strings.HasSuffix(first.Url, "/cupcicm/opp/pulls/2"))
+	assert.False(t, second.Mergeable)
+	assert.Equal(t, "cannot be merged cleanly into master", second.Reason)
+}
+
+func TestMergeOnGiteaUsesTheMergeStyle(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	pr2 := r.CreatePr(t, "HEAD", 2)
+	gitea := tests.NewFakeGitea(t, giteaPr(2, true, core.Must(r.GetLocalTip(pr2))))
+	viper.Set("github.merge.method", "squash")
+
+	require.NoError(t, r.Run("merge", "pr/2"))
+
+	assert.True(t, gitea.PullRequests[2].Merged)
+	assert.Equal(t, "squash", gitea.MergeStyles[2])
+	assert.Len(t, core.Must(r.AllLocalPrs()), 0)
+}
+
+func TestMergeOnGiteaChecksTheRemoteTip(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD", 2)
+	gitea := tests.NewFakeGitea(t, giteaPr(2, true, "0123456789"))
+
+	assert.Error(t, r.Run("merge", "pr/2"))
+
+	assert.False(t, gitea.PullRequests[2].Merged)
+	assert.Len(t, core.Must(r.AllLocalPrs()), 1)
+}
+
+func TestCommentOnGitea(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD", 2)
+	gitea := tests.NewFakeGitea(t, giteaPr(2, true, ""))
+
+	require.NoError(t, r.Run("comment", "pr/2", "looks good"))
+
+	assert.Equal(t, []string{"looks good"}, gitea.Notes[2])
+}
+
+func TestMergeOnGiteaRetargetsDependentPrs(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	r.CreatePr(t, "HEAD", 3)
+	pr3 := giteaPr(3, true, "")
+	pr3.Base.Ref = "cupcicm/pr/2"
+	gitea := tests.NewFakeGitea(t, giteaPr(2, true, core.Must(r.GetLocalTip(pr2))), pr3)
+
+	require.NoError(t, r.Run("merge", "pr/2"))
+
+	assert.True(t, gitea.PullRequests[2].Merged)
+	assert.Equal(t, "master", gitea.PullRequests[3].Base.Ref)
+}
@@ -0,0 +1,132 @@
+package cmd_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cupcicm/opp/cmd"
+	"github.com/cupcicm/opp/core"
+	"github.com/cupcicm/opp/core/story"
+	"github.com/cupcicm/opp/core/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePrOnGitlab(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	gitlab := tests.NewFakeGitlab(t, &tests.FakeMergeRequest{Iid: 1, State: "merged"})
+	r.StoryFetcherMock.CallFetchInProgressStories([]story.Story{}, false)
+
+	require.NoError(t, r.Run("pr", "--draft", "HEAD"))
+
+	pr := r.AssertHasPr(t, 2)
+	require.Contains(t, gitlab.MergeRequests, 2)
+	mr := gitlab.MergeRequests[2]
+	assert.Equal(t, "cupcicm/pr/2", mr.SourceBranch)
+	assert.Equal(t, "master", mr.TargetBranch)
+	assert.True(t, strings.HasPrefix(mr.Title, "Draft: "))
+	assert.Equal(t, gitlab.URL+"/cupcicm/opp/-/merge_requests/2", pr.Url())
+}
+
+func TestStatusOnGitlab(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD^", 2)
+	r.CreatePr(t, "HEAD", 3)
+	tests.NewFakeGitlab(t,
+		&tests.FakeMergeRequest{Iid: 2, Title: "first", State: "opened", DetailedMergeStatus: "mergeable"},
+		&tests.FakeMergeRequest{Iid: 3, Title: "second", State: "opened", DetailedMergeStatus: "not_approved"},
+	)
+
+	require.NoError(t, r.Run("status", "--json"))
+
+	lines := strings.Split(strings.TrimSpace(r.Out.String()), "\n")
+	require.Len(t, lines, 2)
+	var first, second cmd.PrStatus
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+
+	assert.Equal(t, "first", first.Title)
+	assert.True(t, first.Mergeable)
+	assert.Equal(t, "clean", first.MergeableState)
+	assert.True(t, strings.HasSuffix(first.Url, "/cupcicm/opp/-/merge_requests/2"))
+
+	assert.False(t, second.Mergeable)
+	assert.Equal(t, "blocked", second.MergeableState)
+	assert.Equal(t, "not authorized to merge", second.Reason)
+}
+
+func TestStatusOnGitlabHasNoReviews(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD", 2)
+	tests.NewFakeGitlab(t,
+		&tests.FakeMergeRequest{Iid: 2, Title: "first", State: "opened", DetailedMergeStatus: "mergeable"},
+	)
+
+	require.NoError(t, r.Run("status"))
+
+	assert.Contains(t, r.Out.String(), "mergeable  ✅")
+	assert.NotContains(t, r.Out.String(), "reviews")
+}
+
+func TestMergeOnGitlab(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	pr2 := r.CreatePr(t, "HEAD", 2)
+	tip := core.Must(r.GetLocalTip(pr2))
+	gitlab := tests.NewFakeGitlab(t,
+		&tests.FakeMergeRequest{Iid: 2, State: "opened", Sha: tip, DetailedMergeStatus: "mergeable"},
+	)
+
+	require.NoError(t, r.Run("merge", "pr/2"))
+
+	assert.Equal(t, "merged", gitlab.MergeRequests[2].State)
+	assert.Len(t, core.Must(r.AllLocalPrs()), 0)
+}
+
+func TestMergeOnGitlabRetargetsDependentMergeRequests(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	r.CreatePr(t, "HEAD", 3)
+	gitlab := tests.NewFakeGitlab(t,
+		&tests.FakeMergeRequest{Iid: 2, State: "opened", Sha: core.Must(r.GetLocalTip(pr2)), DetailedMergeStatus: "mergeable"},
+		&tests.FakeMergeRequest{Iid: 3, State: "opened", TargetBranch: "cupcicm/pr/2"},
+	)
+
+	require.NoError(t, r.Run("merge", "pr/2"))
+
+	assert.Equal(t, "merged", gitlab.MergeRequests[2].State)
+	assert.Equal(t, "master", gitlab.MergeRequests[3].TargetBranch)
+}
+
+func TestNoAutoMergeOnGitlab(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD", 2)
+	gitlab := tests.NewFakeGitlab(t, &tests.FakeMergeRequest{Iid: 2, State: "opened", DetailedMergeStatus: "mergeable"})
+
+	assert.Error(t, r.Run("merge", "--auto", "pr/2"))
+
+	assert.Equal(t, "opened", gitlab.MergeRequests[2].State)
+}
+
+func TestMergeOnGitlabChecksTheRemoteTip(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD", 2)
+	gitlab := tests.NewFakeGitlab(t,
+		&tests.FakeMergeRequest{Iid: 2, State: "opened", Sha: "0123456789", DetailedMergeStatus: "mergeable"},
+	)
+
+	assert.Error(t, r.Run("merge", "pr/2"))
+
+	assert.Equal(t, "opened", gitlab.MergeRequests[2].State)
+	assert.Len(t, core.Must(r.AllLocalPrs()), 1)
+}
+
+func TestCommentOnGitlab(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD", 2)
+	gitlab := tests.NewFakeGitlab(t, &tests.FakeMergeRequest{Iid: 2, State: "opened"})
+
+	require.NoError(t, r.Run("comment", "pr/2", "looks good"))
+
+	assert.Equal(t, []string{"looks good"}, gitlab.Notes[2])
+}
@@ -5,8 +5,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/cupcicm/opp/core"
@@ -27,11 +30,25 @@ func InitCommand(repo *core.Repo) *cli.Command {
 			}
 			os.Mkdir(path.Dir(config), 0755)
 
-			i := initializer{repo}
-			i.AskGithubToken()
-			i.GuessRepoValues()
-			i.GetGithubValues(ctx)
-			err := i.AddOppInGlobalGitignore(ctx)
+			i := initializer{Repo: repo, in: bufio.NewReader(os.Stdin)}
+			if err := DetectForge(ctx, repo); err != nil {
+				return cli.Exit(err, 1)
+			}
+			token, err := i.AskGithubToken(ctx)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			login, err := i.GetGithubValues(ctx, token)
+			if err != nil {
+				return cli.Exit(fmt.Errorf("could not get your %s login: %w", core.GetForgeType(), err), 1)
+			}
+			if err := i.StoreToken(ctx, login, token); err != nil {
+				return cli.Exit(fmt.Errorf("could not store your token: %w", err), 1)
+			}
+			if err := i.GuessRepoValues(ctx, login); err != nil {
+				return cli.Exit(err, 1)
+			}
+			err = i.AddOppInGlobalGitignore(ctx)
 			if err != nil {
 				fmt.Printf("%v\n", err)
 			}
@@ -46,75 +63,358 @@ func InitCommand(repo *core.Repo) *cli.Command {
 
 type initializer struct {
 	Repo *core.Repo
+	in   *bufio.Reader
+	// The credential provider the token is stored in, empty when it was already somewhere.
+	storage string
+}
+
+// The page where users create a token, and what the token needs to be allowed to do.
+var tokenHelp = map[string]func() (string, []string){
+	"github": func() (string, []string) {
+		return core.GetGithubWebUrl() + "/settings/tokens", []string{
+			`It needs to have all of the "repo" permissions checked,`,
+			`and the "write:discussion" permission.`,
+		}
+	},
+	"gitlab": func() (string, []string) {
+		return core.GetGitlabWebUrl() + "/-/user_settings/personal_access_tokens", []string{
+			`It needs the "api" scope.`,
+		}
+	},
+	"gitea": func() (string, []string) {
+		return core.GetGiteaWebUrl() + "/user/settings/applications", []string{
+			`It needs the "write:repository", "write:issue" and "read:user" permissions.`,
+		}
+	},
+}
+
+// AskGithubToken returns the token of the forge when one of the credential providers
+// has it, and otherwise asks where to store it, and the token itself.
+func (i *initializer) AskGithubToken(ctx context.Context) (string, error) {
+	forge := core.GetForgeType()
+	credential := core.ForgeCredential()
+	if token, name := core.ResolveToken(ctx, credential); token != "" {
+		provider, _ := core.LookupCredentialProvider(name)
+		fmt.Printf("Using the %s token from %s.\n", forge, provider.Description)
+		return token, nil
+	}
+	i.storage = i.AskTokenStorage(ctx)
+	if i.storage == "command" {
+		fmt.Printf("The command that prints your %s token: ", forge)
+		command := i.readLine()
+		token, err := core.RunTokenCommand(ctx, command)
+		if err != nil {
+			return "", err
+		}
+		if token == "" {
+			return "", fmt.Errorf("%s did not print any token", command)
+		}
+		viper.Set(credential.Key+"-command", command)
+		return token, nil
+	}
+	url, permissions := tokenHelp[forge]()
+	fmt.Printf("Please enter a personal %s token.\n", forge)
+	fmt.Printf("You can create one at %s.\n", url)
+	for _, line := range permissions {
+		fmt.Println(line)
+	}
+	fmt.Printf("Your %s token: ", forge)
+	return i.readLine(), nil
+}
+
+// AskTokenStorage asks which credential provider the token goes to. The git credential
+// helper is only offered when there is one, the config of the repo comes last because
+// it is a plaintext file inside the working tree.
+func (i *initializer) AskTokenStorage(ctx context.Context) string {
+	var names []string
+	if helper, err := i.Repo.GitExec(ctx, "config --get credential.helper").Output(); err == nil && len(strings.TrimSpace(string(helper))) > 0 {
+		names = append(names, "git")
+	}
+	names = append(names, "command", "user-config", "config")
+	fmt.Println("Where should opp keep your token?")
+	for index, name := range names {
+		provider, _ := core.LookupCredentialProvider(name)
+		fmt.Printf("  %d. in %s\n", index+1, provider.Description)
+	}
+	for {
+		fmt.Printf("Your choice [1]: ")
+		answer := i.readLine()
+		if answer == "" {
+			return names[0]
+		}
+		if choice, err := strconv.Atoi(answer); err == nil && choice >= 1 && choice <= len(names) {
+			return names[choice-1]
+		}
+	}
 }
 
-func (i *initializer) AskGithubToken() {
-	reader := bufio.NewReader(os.Stdin)
-	if viper.GetString("github.token") == "" {
-		fmt.Println("Please enter a personal github token.")
-		fmt.Println("You can create one at https://github.com/settings/tokens.")
-		fmt.Println(`It needs to have all of the "repo" permissions checked,`)
-		fmt.Println(`and the "write:discussion" permission.`)
-		fmt.Print("Your github token: ")
-		token := strings.TrimSpace(core.Must(reader.ReadString('\n')))
-		viper.Set("github.token", token)
+// StoreToken stores the token in the credential provider chosen in AskGithubToken.
+func (i *initializer) StoreToken(ctx context.Context, login, token string) error {
+	credential := core.ForgeCredential()
+	for _, c := range core.Credentials() {
+		if i.storage == "config" && c.Key == credential.Key {
+			continue
+		}
+		// viper writes all the keys it has, including the tokens it read from
+		// the user config file: only the one stored in the config of the repo
+		// may end up in the repo.
+		viper.Set(c.Key, "")
+	}
+	if i.storage == "" || i.storage == "command" {
+		return nil
 	}
+	provider, _ := core.LookupCredentialProvider(i.storage)
+	if err := provider.Store(ctx, credential, login, token); err != nil {
+		return err
+	}
+	fmt.Printf("Your token is stored in %s.\n", provider.Description)
+	return nil
 }
 
-func (i *initializer) GuessRepoValues() {
-	remoteName, githubRepo := i.extractGithubRepo()
-	viper.Set("repo.github", githubRepo)
-	viper.Set("repo.remote", remoteName)
+func (i *initializer) readLine() string {
+	return strings.TrimSpace(core.Must(i.in.ReadString('\n')))
+}
+
+func (i *initializer) GuessRepoValues(ctx context.Context, login string) error {
+	upstream, push, err := FindGithubRemotes(ctx, i.Repo, login)
+	if err != nil {
+		return err
+	}
+	viper.Set("repo.github", upstream.Repo)
+	viper.Set("repo.remote", upstream.Name)
+	if push.Name != upstream.Name {
+		viper.Set("repo.upstream", upstream.Name)
+		viper.Set("repo.push-remote", push.Name)
+		viper.Set("repo.fork", push.Repo)
+		fmt.Printf("PR branches will be pushed to %s (%s), and PRs opened against %s (%s).\n", push.Name, push.Repo, upstream.Name, upstream.Repo)
+	}
 
-	mainBranch := core.Must(i.Repo.GetMainBranch(context.Background(), remoteName))
+	mainBranch, err := i.Repo.GetMainBranch(ctx, upstream.Name)
+	if err != nil {
+		return fmt.Errorf("could not find the main branch of %s: %w", upstream.Name, err)
+	}
 	viper.Set("repo.branch", mainBranch)
+	return nil
 }
 
-func (i *initializer) extractGithubRepo() (string, string) {
-	cmd := i.Repo.GitExec(context.Background(), "remote")
-	output := strings.TrimSpace(string(core.Must(cmd.Output())))
-	remotes := strings.Split(output, "\n")
+// GithubRemote is a git remote of a github repo.
+type GithubRemote struct {
+	Name string
+	// owner/name
+	Repo string
+}
 
-	found := false
-	var result string
-	var remoteName string
-	for _, name := range remotes {
+// FindGithubRemotes finds the remote PRs are opened against, and the one PR branches are pushed to.
+// They are the same unless there are several github remotes: then the branches are pushed to the
+// fork owned by login (or called origin), and the PRs opened against the other one (or upstream).
+func FindGithubRemotes(ctx context.Context, repo *core.Repo, login string) (upstream GithubRemote, push GithubRemote, err error) {
+	remotes, err := githubRemotes(ctx, repo)
+	if err != nil {
+		return GithubRemote{}, GithubRemote{}, err
+	}
+	switch len(remotes) {
+	case 0:
+		return GithubRemote{}, GithubRemote{}, fmt.Errorf("could not find a %s remote in this repo", core.GetForgeType())
+	case 1:
+		return remotes[0], remotes[0], nil
+	}
+	pushIndex := -1
+	var owned []int
+	for index, remote := range remotes {
+		if owner, _, _ := strings.Cut(remote.Repo, "/"); strings.EqualFold(owner, login) {
+			owned = append(owned, index)
+		}
+	}
+	if len(owned) == 1 {
+		pushIndex = owned[0]
+	} else {
+		pushIndex = slices.IndexFunc(remotes, func(remote GithubRemote) bool { return remote.Name == "origin" })
+	}
+	upstreamIndex := slices.IndexFunc(remotes, func(remote GithubRemote) bool { return remote.Name == "upstream" })
+	if upstreamIndex == -1 && pushIndex != -1 && len(remotes) == 2 {
+		upstreamIndex = 1 - pushIndex
+	}
+	if pushIndex == -1 || upstreamIndex == -1 || pushIndex == upstreamIndex {
+		var names []string
+		for _, remote := range remotes {
+			names = append(names, fmt.Sprintf("%s (%s)", remote.Name, remote.Repo))
+		}
+		return GithubRemote{}, GithubRemote{}, fmt.Errorf(
+			"there are several github remotes in this repo: %s. Please name the fork you push to origin and the repo the PRs are opened against upstream",
+			strings.Join(names, ", "),
+		)
+	}
+	return remotes[upstreamIndex], remotes[pushIndex], nil
+}
+
+// DetectForge sets forge.type and the host of the forge when none of the remotes are on
+// the configured forge, but they all are on the same other host. The forge is guessed from
+// the name of the host, or by asking the host whether it runs gitea. Otherwise it has to
+// be a GitHub Enterprise server.
+func DetectForge(ctx context.Context, repo *core.Repo) error {
+	remotes, err := gitRemotes(ctx, repo)
+	if err != nil {
+		return err
+	}
+	forgeHost := forgeHostname()
+	var webUrls []string
+	for _, remote := range remotes {
+		if remote.Host == forgeHost {
+			return nil
+		}
+		if !slices.Contains(webUrls, remote.WebUrl) {
+			webUrls = append(webUrls, remote.WebUrl)
+		}
+	}
+	if len(webUrls) != 1 {
+		// Not much to guess from: FindGithubRemotes explains what is wrong.
+		return nil
+	}
+	forge := guessForge(ctx, webUrls[0])
+	host := strings.TrimPrefix(webUrls[0], "https://")
+	viper.Set("forge.type", forge)
+	viper.Set(forge+".host", host)
+	if forge != "github" || core.IsGithubEnterprise() {
+		fmt.Printf("Using the %s server at %s. Change forge.type and %s.host if that is not right.\n", forge, host, forge)
+	}
+	return nil
+}
+
+func guessForge(ctx context.Context, webUrl string) string {
+	u, err := url.Parse(webUrl)
+	if err != nil {
+		return "github"
+	}
+	host := u.Hostname()
+	switch {
+	case strings.Contains(host, "github"):
+		return "github"
+	case strings.Contains(host, "gitlab"):
+		return "gitlab"
+	case host == "codeberg.org" || strings.Contains(host, "gitea") || strings.Contains(host, "forgejo"):
+		return "gitea"
+	case core.IsGiteaInstance(ctx, webUrl):
+		return "gitea"
+	default:
+		return "github"
+	}
+}
+
+type gitRemote struct {
+	Name string
+	Host string
+	// The base URL of the web pages of the host.
+	WebUrl string
+	// owner/name
+	Repo string
+}
+
+func gitRemotes(ctx context.Context, repo *core.Repo) ([]gitRemote, error) {
+	output, err := repo.GitExec(ctx, "remote").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the remotes: %w", err)
+	}
+	var remotes []gitRemote
+	for _, name := range strings.Split(strings.TrimSpace(string(output)), "\n") {
 		name = strings.TrimSpace(name)
 		if name == "" {
 			continue
 		}
-		urlCmd := i.Repo.GitExec(context.Background(), "remote get-url %s", name)
-		urlBytes, err := urlCmd.Output()
+		url, err := repo.GitExec(ctx, "remote get-url %s", name).Output()
 		if err != nil {
 			continue
 		}
-		url := strings.TrimSpace(string(urlBytes))
-		index := strings.Index(url, "github.com")
-		dotGit := strings.LastIndex(url, ".git")
-		if index > -1 {
-			if found {
-				panic("two github remotes in this repo.")
-			}
-			found = true
-			if dotGit == -1 {
-				result = url[index+len("github.com")+1:]
-			} else {
-				result = url[index+len("github.com")+1 : dotGit]
-			}
-			remoteName = name
+		if host, webUrl, repoName, found := parseRemoteUrl(strings.TrimSpace(string(url))); found {
+			remotes = append(remotes, gitRemote{Name: name, Host: host, WebUrl: webUrl, Repo: repoName})
+		}
+	}
+	return remotes, nil
+}
+
+func githubRemotes(ctx context.Context, repo *core.Repo) ([]GithubRemote, error) {
+	remotes, err := gitRemotes(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	forgeHost := forgeHostname()
+	var githubRemotes []GithubRemote
+	for _, remote := range remotes {
+		if remote.Host == forgeHost {
+			githubRemotes = append(githubRemotes, GithubRemote{Name: remote.Name, Repo: remote.Repo})
+		}
+	}
+	return githubRemotes, nil
+}
+
+// The hostname of the forge, without the scheme and the port.
+func forgeHostname() string {
+	u, err := url.Parse(core.GetForgeWebUrl())
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// Extracts the hostname and owner/name from the https or ssh url of a repo:
+// https://host/owner/name.git, ssh://git@host:22/owner/name.git or git@host:owner/name.git.
+// The web pages are assumed to be served over https, unless the repo itself is on http.
+func parseRemoteUrl(remote string) (host string, webUrl string, repo string, found bool) {
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return "", "", "", false
+		}
+		host, repo = u.Hostname(), u.Path
+		webUrl = "https://" + host
+		if u.Scheme == "http" || u.Scheme == "https" {
+			webUrl = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+		}
+	} else {
+		var found bool
+		host, repo, found = strings.Cut(remote, ":")
+		if !found {
+			// A local path.
+			return "", "", "", false
+		}
+		if at := strings.LastIndex(host, "@"); at != -1 {
+			host = host[at+1:]
 		}
+		webUrl = "https://" + host
 	}
-	return remoteName, result
+	repo = strings.TrimSuffix(strings.Trim(repo, "/"), ".git")
+	if host == "" || !strings.Contains(repo, "/") {
+		return "", "", "", false
+	}
+	return host, webUrl, repo, true
 }
 
-func (i *initializer) GetGithubValues(ctx context.Context) {
-	client := core.NewClient(ctx)
+func (i *initializer) GetGithubValues(ctx context.Context, token string) (string, error) {
+	var forge interface {
+		Login(context.Context) (string, error)
+	}
+	switch core.GetForgeType() {
+	case "gitlab":
+		forge = core.NewGitlabForge(core.GetGitlabWebUrl(), token, "")
+	case "gitea":
+		forge = core.NewGiteaForge(core.GetGiteaWebUrl(), token, "")
+	}
+	if forge != nil {
+		login, err := forge.Login(ctx)
+		if err != nil {
+			return "", err
+		}
+		// Also used to name the PR branches, like on github.
+		viper.Set("github.login", login)
+		return login, nil
+	}
+	client := core.NewClientWithToken(ctx, token)
 
 	user, _, err := client.Users.Get(ctx, "")
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	viper.Set("github.login", user.Login)
+	viper.Set("github.login", user.GetLogin())
+	return user.GetLogin(), nil
 }
 
 func (i *initializer) GlobalGitignorePath(ctx context.Context) (string, error) {
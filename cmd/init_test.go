@@ -0,0 +1,178 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cupcicm/opp/cmd"
+	"github.com/cupcicm/opp/core"
+	"github.com/cupcicm/opp/core/tests"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindGithubRemotes(t *testing.T) {
+	testCases := []struct {
+		name             string
+		remotes          map[string]string
+		expectedUpstream cmd.GithubRemote
+		expectedPush     cmd.GithubRemote
+		expectedError    bool
+	}{
+		{
+			name:             "single remote",
+			remotes:          map[string]string{"origin": "git@github.com:acme/opp.git"},
+			expectedUpstream: cmd.GithubRemote{Name: "origin", Repo: "acme/opp"},
+			expectedPush:     cmd.GithubRemote{Name: "origin", Repo: "acme/opp"},
+		},
+		{
+			name: "origin and upstream",
+			remotes: map[string]string{
+				"origin":   "git@github.com:someone/opp.git",
+				"upstream": "https://github.com/acme/opp.git",
+			},
+			expectedUpstream: cmd.GithubRemote{Name: "upstream", Repo: "acme/opp"},
+			expectedPush:     cmd.GithubRemote{Name: "origin", Repo: "someone/opp"},
+		},
+		{
+			name: "fork owned by the user",
+			remotes: map[string]string{
+				"origin": "https://github.com/acme/opp",
+				"mine":   "git@github.com:cupcicm/opp.git",
+			},
+			expectedUpstream: cmd.GithubRemote{Name: "origin", Repo: "acme/opp"},
+			expectedPush:     cmd.GithubRemote{Name: "mine", Repo: "cupcicm/opp"},
+		},
+		{
+			name: "ambiguous",
+			remotes: map[string]string{
+				"first":  "git@github.com:acme/opp.git",
+				"second": "git@github.com:other/opp.git",
+				"third":  "git@github.com:another/opp.git",
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := tests.NewTestRepo(t)
+			ctx := context.Background()
+			require.NoError(t, r.GitExec(ctx, "remote remove origin").Run())
+			for name, url := range tc.remotes {
+				require.NoError(t, r.GitExec(ctx, "remote add %s %s", name, url).Run())
+			}
+
+			upstream, push, err := cmd.FindGithubRemotes(ctx, r.Repo, "cupcicm")
+
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedUpstream, upstream)
+			assert.Equal(t, tc.expectedPush, push)
+		})
+	}
+}
+
+func TestDetectForge(t *testing.T) {
+	testCases := []struct {
+		name          string
+		remotes       map[string]string
+		expectedForge string
+		expectedHost  string
+	}{
+		{
+			name:          "github.com",
+			remotes:       map[string]string{"origin": "git@github.com:acme/opp.git"},
+			expectedForge: "github",
+			expectedHost:  "github.com",
+		},
+		{
+			name:          "enterprise over ssh",
+			remotes:       map[string]string{"origin": "git@github.acme.com:acme/opp.git"},
+			expectedForge: "github",
+			expectedHost:  "github.acme.com",
+		},
+		{
+			name: "enterprise fork",
+			remotes: map[string]string{
+				"origin":   "ssh://git@github.acme.com:2222/cupcicm/opp.git",
+				"upstream": "https://github.acme.com/acme/opp",
+			},
+			expectedForge: "github",
+			expectedHost:  "github.acme.com",
+		},
+		{
+			name:          "gitlab",
+			remotes:       map[string]string{"origin": "git@gitlab.acme.com:acme/tools/opp.git"},
+			expectedForge: "gitlab",
+			expectedHost:  "gitlab.acme.com",
+		},
+		{
+			name:          "codeberg",
+			remotes:       map[string]string{"origin": "https://codeberg.org/acme/opp.git"},
+			expectedForge: "gitea",
+			expectedHost:  "codeberg.org",
+		},
+		{
+			name: "several hosts",
+			remotes: map[string]string{
+				"origin": "git@github.acme.com:acme/opp.git",
+				"mirror": "git@git.example.com:acme/opp.git",
+			},
+			expectedForge: "github",
+			expectedHost:  "github.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := tests.NewTestRepo(t)
+			ctx := context.Background()
+			require.NoError(t, r.GitExec(ctx, "remote remove origin").Run())
+			for name, url := range tc.remotes {
+				require.NoError(t, r.GitExec(ctx, "remote add %s %s", name, url).Run())
+			}
+
+			require.NoError(t, cmd.DetectForge(ctx, r.Repo))
+
+			assert.Equal(t, tc.expectedForge, core.GetForgeType())
+			assert.Equal(t, tc.expectedHost, viper.GetString(tc.expectedForge+".host"))
+		})
+	}
+}
+
+func TestDetectGiteaFromItsApi(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	ctx := context.Background()
+	gitea := tests.NewFakeGitea(t)
+	viper.Set("forge.type", "github")
+	viper.Set("gitea.host", "")
+	require.NoError(t, r.GitExec(ctx, "remote set-url origin %s/acme/opp.git", gitea.URL).Run())
+
+	require.NoError(t, cmd.DetectForge(ctx, r.Repo))
+
+	assert.Equal(t, "gitea", core.GetForgeType())
+	assert.Equal(t, gitea.URL, core.GetGiteaHost())
+	upstream, _, err := cmd.FindGithubRemotes(ctx, r.Repo, "cupcicm")
+	require.NoError(t, err)
+	assert.Equal(t, cmd.GithubRemote{Name: "origin", Repo: "acme/opp"}, upstream)
+}
+
+func TestFindGithubRemotesOnEnterprise(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	ctx := context.Background()
+	viper.Set("github.host", "github.acme.com")
+	require.NoError(t, r.GitExec(ctx, "remote remove origin").Run())
+	require.NoError(t, r.GitExec(ctx, "remote add origin git@github.acme.com:acme/opp.git").Run())
+	require.NoError(t, r.GitExec(ctx, "remote add public https://github.com/acme/opp.git").Run())
+
+	upstream, push, err := cmd.FindGithubRemotes(ctx, r.Repo, "cupcicm")
+
+	require.NoError(t, err)
+	assert.Equal(t, cmd.GithubRemote{Name: "origin", Repo: "acme/opp"}, upstream)
+	assert.Equal(t, upstream, push)
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/google/go-github/v56/github"
+)
+
+// labeler applies labels and a milestone to PRs, from the flags of opp pr
+// and from the rules configured in pr.rules.
+type labeler struct {
+	Repo   *core.Repo
+	Issues core.GhIssues
+}
+
+// Apply adds the given labels and milestone to the PR, along with the ones of the
+// rules matching its commits. Labels opp has already applied once are skipped, so
+// that labels removed on github stay removed.
+// Failures are printed but do not fail the command. Only done on github.
+func (l *labeler) Apply(ctx context.Context, pr *core.LocalPr, commits []core.Commit, labels []string, milestone string) {
+	if !core.IsGithubForge() {
+		if len(labels) > 0 || milestone != "" {
+			fmt.Println(core.ErrOnlyOnGithub("labelling PRs"))
+		}
+		return
+	}
+	ruleLabels, ruleMilestone, err := l.matchRules(ctx, commits)
+	if err != nil {
+		fmt.Printf("Could not apply the label rules to %s: %s\n", pr.LocalBranch(), err)
+	}
+	if milestone == "" {
+		milestone = ruleMilestone
+	}
+	var toAdd []string
+	for _, label := range append(slices.Clone(labels), ruleLabels...) {
+		if !slices.Contains(pr.Labels(), label) && !slices.Contains(toAdd, label) {
+			toAdd = append(toAdd, label)
+		}
+	}
+	ctx, cancel := context.WithTimeoutCause(
+		ctx, core.GetGithubTimeout(),
+		fmt.Errorf("labelling PR too slow, increase github.timeout"),
+	)
+	defer cancel()
+	if len(toAdd) > 0 {
+		fmt.Printf("Adding labels %s... ", strings.Join(toAdd, ", "))
+		_, _, err := l.Issues.AddLabelsToIssue(ctx, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber, toAdd)
+		if err != nil {
+			PrintFailure(err)
+		} else {
+			PrintSuccess()
+			pr.AddLabels(toAdd)
+		}
+	}
+	if milestone != "" && milestone != pr.Milestone() {
+		fmt.Printf("Setting milestone %s... ", milestone)
+		if err := l.setMilestone(ctx, pr, milestone); err != nil {
+			PrintFailure(err)
+		} else {
+			PrintSuccess()
+			pr.SetMilestone(milestone)
+		}
+	}
+}
+
+// Relabel applies the rules of pr.rules to the current commits of the PR,
+// which may touch new paths since the PR was created.
+func (l *labeler) Relabel(ctx context.Context, pr *core.LocalPr) {
+	rules, err := core.GetLabelRules()
+	if err != nil || len(rules) == 0 {
+		return
+	}
+	commits, err := l.prCommits(ctx, pr)
+	if err != nil {
+		fmt.Printf("Could not list the commits of %s: %s\n", pr.LocalBranch(), err)
+		return
+	}
+	l.Apply(ctx, pr, commits, nil, "")
+}
+
+func (l *labeler) matchRules(ctx context.Context, commits []core.Commit) ([]string, string, error) {
+	rules, err := core.GetLabelRules()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid pr.rules: %w", err)
+	}
+	if len(rules) == 0 || len(commits) == 0 {
+		return nil, "", nil
+	}
+	// The first commit is the child-most one.
+	files, err := l.Repo.ChangedFiles(ctx, commits[len(commits)-1].Hash, commits[0].Hash)
+	if err != nil {
+		return nil, "", err
+	}
+	return core.MatchLabelRules(rules, files, commits)
+}
+
+// Returns the commits that are in the PR but not in its ancestor.
+func (l *labeler) prCommits(ctx context.Context, pr *core.LocalPr) ([]core.Commit, error) {
+	tip, err := l.Repo.GetLocalTip(pr)
+	if err != nil {
+		return nil, err
+	}
+	ancestor, err := pr.GetAncestor()
+	if err != nil || !ancestor.IsPr() {
+		return l.Repo.GetCommitsNotInBaseBranch(tip)
+	}
+	ancestorTip, err := l.Repo.GetLocalTip(ancestor)
+	if err != nil {
+		return nil, err
+	}
+	return l.Repo.GetCommitsBetween(ctx, ancestorTip, tip)
+}
+
+// Milestones are identified by their number on github, look it up from its title.
+func (l *labeler) setMilestone(ctx context.Context, pr *core.LocalPr, title string) error {
+	milestones, _, err := l.Issues.ListMilestones(
+		ctx, core.GetGithubOwner(), core.GetGithubRepoName(),
+		&github.MilestoneListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}},
+	)
+	if err != nil {
+		return err
+	}
+	for _, milestone := range milestones {
+		if milestone.GetTitle() == title {
+			_, _, err := l.Issues.Edit(
+				ctx, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber,
+				&github.IssueRequest{Milestone: milestone.Number},
+			)
+			return err
+		}
+	}
+	return fmt.Errorf("no open milestone called %s", title)
+}
@@ -25,15 +25,15 @@ If no PR is specified and you're on a PR branch, uses the current branch's PR.`,
 				fmt.Errorf("fetching PR too slow, increase github.timeout"),
 			)
 			defer cancel()
-			githubPr, _, err := gh(ctx).PullRequests().Get(ctx, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber)
+			forge, err := core.NewForge(ctx, gh)
 			if err != nil {
-				return fmt.Errorf("could not fetch PR #%d: %w", pr.PrNumber, err)
+				return cli.Exit(err, 1)
 			}
-			title := ""
-			if githubPr.Title != nil {
-				title = *githubPr.Title
+			forgePr, err := forge.GetPr(ctx, pr.PrNumber)
+			if err != nil {
+				return fmt.Errorf("could not fetch PR #%d: %w", pr.PrNumber, err)
 			}
-			core.ClipboardWrite(pr, title)
+			core.ClipboardWrite(pr, forgePr.Title)
 			fmt.Println(pr.Url())
 			return nil
 		},
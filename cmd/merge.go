@@ -4,15 +4,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
+	"strings"
 	"time"
 
 	"github.com/cupcicm/opp/core"
-	"github.com/google/go-github/v56/github"
+	"github.com/cupcicm/opp/core/story"
 	"github.com/urfave/cli/v3"
 )
 
 var (
+	ChainFlagUsage = strings.TrimSpace(`
+Merge all the PRs the given PR depends on, starting from the root of the chain.
+Each PR is rebased on the base branch and pushed, then merged once its checks have passed.
+Repos without CI can set github.checks.grace-period to 0 not to wait for checks that never come.
+`)
+	WaitFlagUsage = strings.TrimSpace(`
+Wait for all the checks of the PR to pass before merging it, instead of failing right away
+when some are still pending. Gives up after github.checks.timeout.
+`)
+	AutoFlagUsage = strings.TrimSpace(`
+Enable github auto-merge on the PR, using github.merge.method.
+With --chain, auto-merge is enabled on the root of the chain, and the rest of the chain waits for it.
+`)
 	ErrBeingEvaluated         = errors.New("still being checked by github")
 	mergeabilityCheckInterval = time.Second * 2
 	mergeabilityCheckTimeout  = time.Second * 30
@@ -20,54 +33,250 @@ var (
 
 type merger struct {
 	Repo         *core.Repo
+	Forge        core.Forge
 	PullRequests core.GhPullRequest
+	Checks       core.GhChecks
+	Repositories core.GhRepositories
+	AutoMerge    core.GhAutoMerge
+	StoryFetcher func(string, string) (story.StoryFetcher, error)
+	// Wait for the checks to pass before merging.
+	Wait bool
 }
 
-func MergeCommand(repo *core.Repo, gh func(context.Context) core.Gh) *cli.Command {
+func MergeCommand(repo *core.Repo, gh func(context.Context) core.Gh, sf func(string, string) (story.StoryFetcher, error)) *cli.Command {
 	cmd := &cli.Command{
 		Name:    "merge",
 		Aliases: []string{"m"},
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "chain",
+				Usage: ChainFlagUsage,
+			},
+			&cli.BoolFlag{
+				Name:    "wait",
+				Aliases: []string{"w"},
+				Usage:   WaitFlagUsage,
+			},
+			&cli.BoolFlag{
+				Name:  "auto",
+				Usage: AutoFlagUsage,
+			},
+			&cli.BoolFlag{
+				Name:  "cancel-auto",
+				Usage: "Disable github auto-merge on the PR (or the root of its chain).",
+			},
+		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			pr, mergingCurrentBranch, err := PrFromFirstArgument(repo, cmd)
 			if err != nil {
 				return err
 			}
-			merger := merger{Repo: repo, PullRequests: gh(ctx).PullRequests()}
+			forge, err := core.NewForge(ctx, gh)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			if !core.IsGithubForge() {
+				for _, flag := range []string{"wait", "auto", "cancel-auto"} {
+					if cmd.Bool(flag) {
+						return cli.Exit(core.ErrOnlyOnGithub("--"+flag), 1)
+					}
+				}
+			}
+			client := gh(ctx)
+			merger := merger{
+				Repo:         repo,
+				Forge:        forge,
+				PullRequests: client.PullRequests(),
+				Checks:       client.Checks(),
+				Repositories: client.Repositories(),
+				AutoMerge:    client.AutoMerge(),
+				StoryFetcher: sf,
+				Wait:         cmd.Bool("wait"),
+			}
+			if cmd.Bool("cancel-auto") {
+				return merger.CancelAutoMerge(ctx, pr)
+			}
+			if cmd.Bool("auto") && cmd.Bool("chain") {
+				return merger.EnableAutoMergeOnChain(ctx, pr)
+			}
+			if cmd.Bool("chain") {
+				return merger.MergeChain(ctx, pr)
+			}
 			ancestors := pr.AllAncestors()
 			if len(ancestors) >= 1 {
 				fmt.Printf("%s is not mergeable because it has unmerged dependent PRs.\n", pr.Url())
-				return fmt.Errorf("please merge %s first", ancestors[0].LocalBranch())
+				return fmt.Errorf("please merge %s first, or use opp merge --chain", ancestors[0].LocalBranch())
 			}
-			fmt.Print("Checking mergeability... ")
-
-			isMergeable, err := merger.IsMergeable(ctx, pr)
-
-			if errors.Is(err, ErrBeingEvaluated) {
-				isMergeable, err = merger.WaitForMergeability(ctx, pr)
+			if cmd.Bool("auto") {
+				return merger.EnableAutoMerge(ctx, pr)
 			}
-			if !isMergeable {
-				PrintFailure(nil)
+			if err := merger.CheckAndMerge(ctx, pr); err != nil {
 				return cli.Exit(err, 1)
 			}
-			PrintSuccess()
-			mergeContext, cancel := context.WithTimeoutCause(
-				ctx, core.GetGithubTimeout(),
-				fmt.Errorf("merging too slow, increase github.timeout"),
-			)
-			defer cancel()
-			if err := merger.Merge(mergeContext, pr); err != nil {
-				return cli.Exit("could not merge", 1)
-			}
 			if mergingCurrentBranch {
-				repo.Checkout(mergeContext, repo.BaseBranch())
+				repo.Checkout(ctx, repo.BaseBranch())
+			}
+			if err := merger.CleanupAfterMerge(ctx, pr); err != nil {
+				return cli.Exit(err, 1)
 			}
-			repo.CleanupAfterMerge(mergeContext, pr)
 			return nil
 		},
 	}
 	return cmd
 }
 
+// CheckAndMerge waits until github has decided whether the PR is mergeable,
+// then merges it if it is.
+func (m *merger) CheckAndMerge(ctx context.Context, pr *core.LocalPr) error {
+	if m.Wait {
+		if err := m.WaitForChecks(ctx, pr); err != nil {
+			return err
+		}
+	}
+	fmt.Print("Checking mergeability... ")
+
+	isMergeable, err := m.IsMergeable(ctx, pr)
+
+	if errors.Is(err, ErrBeingEvaluated) {
+		isMergeable, err = m.WaitForMergeability(ctx, pr)
+	}
+	if !isMergeable {
+		PrintFailure(nil)
+		return err
+	}
+	PrintSuccess()
+	mergeContext, cancel := context.WithTimeoutCause(
+		ctx, core.GetGithubTimeout(),
+		fmt.Errorf("merging too slow, increase github.timeout"),
+	)
+	defer cancel()
+	if err := m.Merge(mergeContext, pr); err != nil {
+		return fmt.Errorf("could not merge: %w", err)
+	}
+	return nil
+}
+
+// MergeChain merges pr and all of its ancestors, starting with the root of the chain.
+// After each merge, the next PR is retargeted to the base branch on github, then rebased
+// and pushed like opp rebase and opp push would do, and merged in turn once its checks
+// have passed.
+// Merged PRs are cleaned up as we go, so when a step fails, running the same command
+// again resumes from the first PR that has not been merged yet.
+func (m *merger) MergeChain(ctx context.Context, pr *core.LocalPr) error {
+	chain := append(pr.AllAncestors(), pr)
+	if len(chain) > 1 && !m.Repo.NoLocalChanges(ctx) {
+		return cli.Exit("there are uncommitted changes. Cannot merge a PR chain", 1)
+	}
+	initialRef, err := m.Repo.GetHeadRef(ctx)
+	if err != nil {
+		return err
+	}
+	for i, current := range chain {
+		if i > 0 {
+			hasBeenMerged, err := m.prepareNextInChain(ctx, current)
+			if err != nil {
+				return chainInterrupted(pr, err)
+			}
+			if hasBeenMerged {
+				continue
+			}
+			if err := m.WaitForReevaluation(ctx, current); err != nil {
+				return chainInterrupted(pr, err)
+			}
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(chain), current.Url())
+		err := m.CheckAndMerge(ctx, current)
+		if errors.Is(err, ErrAlreadyMerged) {
+			// Merged by a previous run that could not clean it up.
+			fmt.Printf("%s has already been merged.\n", current.LocalBranch())
+		} else if err != nil {
+			return chainInterrupted(pr, err)
+		}
+		// Also changes the base of the next PR on github.
+		if err := m.CleanupAfterMerge(ctx, current); err != nil {
+			return chainInterrupted(pr, err)
+		}
+	}
+	if m.Repo.CheckoutRef(ctx, initialRef) != nil {
+		m.Repo.Checkout(ctx, m.Repo.BaseBranch())
+	}
+	return nil
+}
+
+// CleanupAfterMerge deletes the branches of the merged PR, and updates
+// the stack of PRs in the description of the PRs that depended on it.
+func (m *merger) CleanupAfterMerge(ctx context.Context, pr *core.LocalPr) error {
+	dependents, err := m.Repo.CleanupAfterMerge(ctx, pr)
+	if err != nil {
+		return err
+	}
+	stacks := stack{Repo: m.Repo, PullRequests: m.PullRequests}
+	stacks.Update(ctx, dependents...)
+	return nil
+}
+
+// WaitForReevaluation waits for github to decide again whether a PR that has just been
+// pushed can be merged: until its checks have run, it is reported as unstable or blocked.
+func (m *merger) WaitForReevaluation(ctx context.Context, pr *core.LocalPr) error {
+	if m.Wait {
+		// CheckAndMerge waits for the checks already.
+		return nil
+	}
+	if !core.IsGithubForge() {
+		// The checks are only read on github.
+		return nil
+	}
+	return m.WaitForChecks(ctx, pr)
+}
+
+// Rebases the PR on top of the base branch that now contains its merged ancestor,
+// and pushes it.
+// Returns true when the PR turns out to be already merged.
+func (m *merger) prepareNextInChain(ctx context.Context, pr *core.LocalPr) (bool, error) {
+	if err := m.Repo.Fetch(ctx); err != nil {
+		return false, fmt.Errorf("error during fetch: %w", err)
+	}
+	pr.ReloadState()
+	hasBeenMerged, err := rebase(ctx, m.Repo, pr, false)
+	if err != nil || hasBeenMerged {
+		return hasBeenMerged, err
+	}
+	return false, push(ctx, m.Repo, pr)
+}
+
+// retargeter makes the PRs point to the base branch on the forge, before the
+// branch they were based on gets deleted. Stops at the first failure.
+func retargeter(repo *core.Repo, gh func(context.Context) core.Gh) core.Retargeter {
+	return func(ctx context.Context, prs []*core.LocalPr) error {
+		ctx, cancel := context.WithTimeoutCause(
+			ctx, core.GetGithubTimeout(),
+			fmt.Errorf("changing the base of a PR too slow, increase github.timeout"),
+		)
+		defer cancel()
+		forge, err := core.NewForge(ctx, gh)
+		if err != nil {
+			return err
+		}
+		base := repo.BaseBranch().RemoteName()
+		for _, pr := range prs {
+			fmt.Printf("Changing the base of %s to %s... ", pr.LocalBranch(), base)
+			if err := forge.RetargetPr(ctx, pr.PrNumber, base); err != nil {
+				PrintFailure(err)
+				return fmt.Errorf("could not change the base of %s: %w", pr.LocalBranch(), err)
+			}
+			PrintSuccess()
+		}
+		return nil
+	}
+}
+
+func chainInterrupted(pr *core.LocalPr, err error) error {
+	return fmt.Errorf(
+		"%w\nonce fixed, run opp merge --chain %s to merge the rest of the chain",
+		err, pr.LocalBranch(),
+	)
+}
+
 // Is this PR, separately from its ancestor, mergeable in itself ?
 func (m *merger) IsMergeable(ctx context.Context, pr *core.LocalPr) (bool, error) {
 	mergeableContext, cancel := context.WithTimeoutCause(
@@ -75,26 +284,25 @@ func (m *merger) IsMergeable(ctx context.Context, pr *core.LocalPr) (bool, error
 		fmt.Errorf("checking if mergeable is too slow, increase github.timeout"),
 	)
 	defer cancel()
-	githubPr, _, err := m.PullRequests.Get(mergeableContext, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber)
+	forgePr, err := m.Forge.GetPr(mergeableContext, pr.PrNumber)
 	if err != nil {
 		return false, err
 	}
-	if githubPr.Merged != nil && *githubPr.Merged {
-		return false, errors.New("already merged")
+	if forgePr.Merged {
+		return false, ErrAlreadyMerged
 	}
-	if githubPr.Mergeable == nil {
+	switch forgePr.Mergeability {
+	case core.MergeabilityPending:
 		return false, ErrBeingEvaluated
-	}
-	switch *githubPr.MergeableState {
-	case "dirty":
+	case core.MergeabilityConflicting:
 		return false, fmt.Errorf("cannot be merged cleanly into %s", m.Repo.BaseBranch().RemoteName())
-	case "blocked":
+	case core.MergeabilityBlocked:
 		return false, errors.New("not authorized to merge")
-	case "unstable":
+	case core.MergeabilityUnstable:
 		return false, errors.New("has some failing checks")
-	case "draft":
+	case core.MergeabilityDraft:
 		return false, errors.New("draft PR")
-	case "clean":
+	case core.MergeabilityClean:
 		return true, nil
 	default:
 		return false, errors.New("not mergeable")
@@ -127,13 +335,9 @@ func (m *merger) Merge(ctx context.Context, pr *core.LocalPr) error {
 		return err
 	}
 	fmt.Printf("Merging %s... ", pr.LocalBranch())
-	merge, r, err := m.PullRequests.Merge(ctx, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber, "",
-		&github.PullRequestOptions{
-			SHA:         tip,
-			MergeMethod: core.GetGithubMergeMethod(),
-		})
-	if r != nil && r.StatusCode == http.StatusConflict {
-		PrintFailure("wrong remote tip")
+	sha, err := m.Forge.MergePr(ctx, pr.PrNumber, tip, core.GetGithubMergeMethod())
+	if errors.Is(err, core.ErrRemoteTipChanged) {
+		PrintFailure(err)
 		return fmt.Errorf("did not merge %s", pr.LocalBranch())
 	}
 	if err != nil {
@@ -141,10 +345,25 @@ func (m *merger) Merge(ctx context.Context, pr *core.LocalPr) error {
 		return err
 	}
 	PrintSuccess()
-	pr.AddKnownTip(merge.GetSHA())
+	pr.AddKnownTip(sha)
+	m.finishStory(ctx, pr)
 	return nil
 }
 
+// Moves the story of the PR to done. Failures are only reported: the PR has been merged.
+func (m *merger) finishStory(ctx context.Context, pr *core.LocalPr) {
+	if pr.Story() == "" || m.StoryFetcher == nil {
+		return
+	}
+	stories, err := story.NewStoryService(m.StoryFetcher, nil)
+	if err == nil {
+		err = stories.Finish(ctx, pr.Story())
+	}
+	if err != nil {
+		fmt.Printf("Could not update the story %s: %s\n", pr.Story(), err)
+	}
+}
+
 func SetShortMergeabilityIntervalForTests() func() {
 	initial := mergeabilityCheckInterval
 	mergeabilityCheckInterval = time.Millisecond
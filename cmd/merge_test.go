@@ -2,12 +2,17 @@ package cmd_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/cupcicm/opp/cmd"
 	"github.com/cupcicm/opp/core"
 	"github.com/cupcicm/opp/core/tests"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v56/github"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestCannotMergeIfDependentPRs(t *testing.T) {
@@ -32,6 +37,7 @@ func TestMergeKeepsTrackOfAncestorTips(t *testing.T) {
 
 	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
 	r.GithubMock.PullRequestsMock.CallMerge(2, "8f4ca5d979bc19b7c836655a6432d690f78316af")
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
 
 	// Check that pr3 knows about the tip of its ancestor (pr2)
 	assert.Len(t, pr3.AncestorTips(), 1)
@@ -61,6 +67,7 @@ func TestMergeWaitsForMergeability(t *testing.T) {
 	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeabilityBeingEvaluated(2)
 	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
 	r.GithubMock.PullRequestsMock.CallMerge(2, "8f4ca5d979bc19b7c836655a6432d690f78316af")
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
 
 	// Check that pr3 knows about the tip of its ancestor (pr2)
 	assert.Len(t, pr3.AncestorTips(), 1)
@@ -76,3 +83,237 @@ func TestMergeWaitsForMergeability(t *testing.T) {
 	assert.Len(t, pr3.AncestorTips(), 2)
 	assert.Contains(t, pr3.AncestorTips(), "8f4ca5d979bc19b7c836655a6432d690f78316af", pr2Tip)
 }
+
+func TestMergeChain(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+	r.Repo.Checkout(context.Background(), pr3)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.CallMergeAndUpdateBase(pr2)
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
+	// pr/3 has just been pushed, its checks run before it is merged.
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus()
+	r.GithubMock.ChecksMock.CallListCheckRuns([3]string{"build", "completed", "success"})
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(3, true)
+	r.CallMergeAndUpdateBase(pr3)
+
+	assert.Nil(t, r.Run("merge", "--chain"))
+
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+	assert.Empty(t, core.Must(r.AllLocalPrs()))
+	assert.Equal(t, "master", core.Must(r.GetCurrentBranchName(context.Background())))
+}
+
+func TestMergeChainWaitsForTheChecksOfThePushedPr(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	reset := cmd.SetShortChecksIntervalForTests()
+	defer reset()
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.CallMergeAndUpdateBase(pr2)
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus()
+	r.GithubMock.ChecksMock.CallListCheckRuns([3]string{"build", "in_progress", ""})
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus()
+	r.GithubMock.ChecksMock.CallListCheckRuns([3]string{"build", "completed", "success"})
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(3, true)
+	r.CallMergeAndUpdateBase(pr3)
+
+	assert.Nil(t, r.Run("merge", "--chain", "pr/3"))
+
+	r.GithubMock.ChecksMock.AssertExpectations(t)
+	assert.Empty(t, core.Must(r.AllLocalPrs()))
+}
+
+func TestMergeChainCanBeResumed(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.CallMergeAndUpdateBase(pr2)
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus()
+	r.GithubMock.ChecksMock.CallListCheckRuns([3]string{"build", "completed", "success"})
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(3, false)
+
+	assert.NotNil(t, r.Run("merge", "--chain", "pr/3"))
+
+	// pr/2 has been merged, pr/3 now depends on master.
+	assert.Len(t, core.Must(r.AllLocalPrs()), 1)
+	pr3.ReloadState()
+	assert.Equal(t, "master", core.Must(pr3.GetAncestor()).LocalName())
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(3, true)
+	r.CallMergeAndUpdateBase(pr3)
+
+	assert.Nil(t, r.Run("merge", "--chain", "pr/3"))
+	assert.Empty(t, core.Must(r.AllLocalPrs()))
+}
+
+func TestMergeWaitsForChecks(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	reset := cmd.SetShortChecksIntervalForTests()
+	defer reset()
+
+	pr2 := r.CreatePr(t, "HEAD", 2)
+
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus([2]string{"ci/lint", "pending"})
+	r.GithubMock.ChecksMock.CallListCheckRuns([3]string{"build", "in_progress", ""})
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus([2]string{"ci/lint", "success"})
+	r.GithubMock.ChecksMock.CallListCheckRuns([3]string{"build", "completed", "success"})
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.GithubMock.PullRequestsMock.CallMerge(2, core.Must(r.GetLocalTip(pr2)))
+
+	assert.Nil(t, r.Run("merge", "--wait", "pr/2"))
+
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+	assert.Empty(t, core.Must(r.AllLocalPrs()))
+}
+
+func TestMergeAbortsOnFailingChecks(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	reset := cmd.SetShortChecksIntervalForTests()
+	defer reset()
+
+	r.CreatePr(t, "HEAD", 2)
+
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus([2]string{"ci/lint", "pending"})
+	r.GithubMock.ChecksMock.CallListCheckRuns([3]string{"build", "completed", "failure"})
+
+	err := r.Run("merge", "--wait", "pr/2")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "build: https://ci.example.com/build")
+		assert.NotContains(t, err.Error(), "ci/lint")
+	}
+	r.GithubMock.PullRequestsMock.AssertNotCalled(t, "Merge")
+	assert.Len(t, core.Must(r.AllLocalPrs()), 1)
+}
+
+func TestMergeWaitsForChecksToBeRegistered(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	reset := cmd.SetShortChecksIntervalForTests()
+	defer reset()
+
+	pr2 := r.CreatePr(t, "HEAD", 2)
+
+	// Right after a push, github does not know about the checks yet.
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus()
+	r.GithubMock.ChecksMock.CallListCheckRuns()
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus()
+	r.GithubMock.ChecksMock.CallListCheckRuns([3]string{"build", "completed", "success"})
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.GithubMock.PullRequestsMock.CallMerge(2, core.Must(r.GetLocalTip(pr2)))
+
+	assert.Nil(t, r.Run("merge", "--wait", "pr/2"))
+
+	r.GithubMock.ChecksMock.AssertExpectations(t)
+	assert.Empty(t, core.Must(r.AllLocalPrs()))
+}
+
+func TestMergeWithoutGracePeriodTrustsPrsWithoutChecks(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	reset := cmd.SetShortChecksIntervalForTests()
+	defer reset()
+	viper.Set("github.checks.grace-period", 0)
+
+	pr2 := r.CreatePr(t, "HEAD", 2)
+
+	// The repo has no CI: the first empty answer is enough.
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus()
+	r.GithubMock.ChecksMock.CallListCheckRuns()
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.GithubMock.PullRequestsMock.CallMerge(2, core.Must(r.GetLocalTip(pr2)))
+
+	assert.Nil(t, r.Run("merge", "--wait", "pr/2"))
+
+	r.GithubMock.ChecksMock.AssertExpectations(t)
+	assert.Empty(t, core.Must(r.AllLocalPrs()))
+}
+
+func TestMergeReadsAllThePagesOfChecks(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	reset := cmd.SetShortChecksIntervalForTests()
+	defer reset()
+
+	r.CreatePr(t, "HEAD", 2)
+
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatusPage(2, [2]string{"ci/lint", "success"})
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus([2]string{"ci/deploy", "success"})
+	r.GithubMock.ChecksMock.CallListCheckRunsPage(2, [3]string{"build", "completed", "success"})
+	r.GithubMock.ChecksMock.CallListCheckRuns([3]string{"test", "completed", "failure"})
+
+	err := r.Run("merge", "--wait", "pr/2")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "test: https://ci.example.com/test")
+	}
+	r.GithubMock.PullRequestsMock.AssertNotCalled(t, "Merge")
+}
+
+func TestMergeRetargetsDependentPrsBeforeDeletingTheBranch(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^^", 2)
+	r.CreatePr(t, "HEAD^", 3)
+	r.CreatePr(t, "HEAD", 4, "--base", "2")
+
+	remoteBranch := plumbing.NewBranchReferenceName(pr2.RemoteBranch())
+	for _, dependent := range []int{3, 4} {
+		r.GithubMock.PullRequestsMock.On("Edit", mock.Anything, "cupcicm", "opp", dependent, mock.MatchedBy(func(pull *github.PullRequest) bool {
+			return pull.GetBase().GetRef() == "master"
+		})).Run(func(mock.Arguments) {
+			// Github would close the PR if its base branch was already deleted.
+			_, err := r.GithubRepo.Reference(remoteBranch, true)
+			assert.NoError(t, err)
+		}).Return(&github.PullRequest{}, nil, nil).Once()
+	}
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.GithubMock.PullRequestsMock.CallMerge(2, core.Must(r.GetLocalTip(pr2)))
+
+	assert.Nil(t, r.Run("merge", "pr/2"))
+
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+	_, err := r.GithubRepo.Reference(remoteBranch, true)
+	assert.Error(t, err)
+}
+
+func TestMergeChainStopsWhenRetargetingFails(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.CallMergeAndUpdateBase(pr2)
+	r.GithubMock.PullRequestsMock.On("Edit", mock.Anything, "cupcicm", "opp", 3, mock.Anything).Return(
+		(*github.PullRequest)(nil), nil, errors.New("github is down"),
+	).Once()
+
+	err := r.Run("merge", "--chain", "pr/3")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "github is down")
+	}
+
+	// Deleting the branch of pr/2 would close pr/3.
+	_, err = r.GithubRepo.Reference(plumbing.NewBranchReferenceName(pr2.RemoteBranch()), true)
+	assert.NoError(t, err)
+	assert.Len(t, core.Must(r.AllLocalPrs()), 2)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMerged(2)
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
+	r.GithubMock.RepositoriesMock.CallGetCombinedStatus()
+	r.GithubMock.ChecksMock.CallListCheckRuns([3]string{"build", "completed", "success"})
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(3, true)
+	r.CallMergeAndUpdateBase(pr3)
+
+	assert.Nil(t, r.Run("merge", "--chain", "pr/3"))
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+	assert.Empty(t, core.Must(r.AllLocalPrs()))
+}
@@ -5,12 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/cupcicm/opp/core"
 	"github.com/cupcicm/opp/core/story"
-	"github.com/google/go-github/v56/github"
 	"github.com/urfave/cli/v3"
 )
 
@@ -37,7 +39,25 @@ When set, tries to extract the commits used to create the PR from the current br
 This means that the current branch will not retain the commits you used to create the PR, they
 will be "moved" to the PR branch, and will not stay in your main branch.
 `)
-	Description = strings.TrimSpace(`
+	ReviewerFlagUsage = strings.TrimSpace(`
+Request a review from this user, or from this team when written org/team.
+Can be repeated. Added to the reviewers configured in pr.reviewers.
+`)
+	AssigneeFlagUsage   = "Assign the PR to this user, or to yourself with \"me\". Can be repeated."
+	CodeownersFlagUsage = strings.TrimSpace(`
+Also request reviews from the owners of the files modified by the PR, as listed
+in the CODEOWNERS file of the repo. Can be enabled by default with pr.codeowners.
+`)
+	EditFlagUsage = strings.TrimSpace(`
+Open the title and body of the PR in your editor before creating it.
+Saving an empty file aborts the creation of the PR.
+`)
+	LabelFlagUsage = strings.TrimSpace(`
+Add this label to the PR. Can be repeated. Added to the labels of the rules
+configured in pr.rules that match the commits of the PR.
+`)
+	MilestoneFlagUsage = "Add the PR to the open milestone with this title."
+	Description        = strings.TrimSpace(`
 Starting from either HEAD, or the provided reference (HEAD~1, a74c9e, a_branch, ...) and walking
 back, gathers commits until it finds either the tip of a PR branch (e.g. pr/xxx) or the base branch
 and creates a PR that contains these commits.
@@ -50,7 +70,7 @@ whether it reached the base branch or the tip of another PR first when walking b
 `)
 )
 
-func PrCommand(in io.Reader, repo *core.Repo, gh func(context.Context) core.Gh, sf func(string, string) story.StoryFetcher) *cli.Command {
+func PrCommand(in io.Reader, repo *core.Repo, gh func(context.Context) core.Gh, sf func(string, string) (story.StoryFetcher, error)) *cli.Command {
 	cmd := &cli.Command{
 		Name:        "pr",
 		Aliases:     []string{"pull-request", "new"},
@@ -82,13 +102,46 @@ func PrCommand(in io.Reader, repo *core.Repo, gh func(context.Context) core.Gh,
 				Aliases: []string{"x"},
 				Usage:   ExtractFlagUsage,
 			},
+			&cli.BoolFlag{
+				Name:    "edit",
+				Aliases: []string{"e"},
+				Usage:   EditFlagUsage,
+			},
+			&cli.StringSliceFlag{
+				Name:    "reviewer",
+				Aliases: []string{"r"},
+				Usage:   ReviewerFlagUsage,
+			},
+			&cli.StringSliceFlag{
+				Name:    "assignee",
+				Aliases: []string{"a"},
+				Usage:   AssigneeFlagUsage,
+			},
+			&cli.BoolFlag{
+				Name:  "codeowners",
+				Usage: CodeownersFlagUsage,
+			},
+			&cli.StringSliceFlag{
+				Name:    "label",
+				Aliases: []string{"l"},
+				Usage:   LabelFlagUsage,
+			},
+			&cli.StringFlag{
+				Name:    "milestone",
+				Aliases: []string{"m"},
+				Usage:   MilestoneFlagUsage,
+			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			initialRef, err := repo.GetHeadRef(ctx)
 			if err != nil {
 				return err
 			}
-			pr := create{Repo: repo, Github: gh(ctx), StoryFetcher: sf}
+			forge, err := core.NewForge(ctx, gh)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			pr := create{Repo: repo, Github: gh(ctx), Forge: forge, StoryFetcher: sf}
 			args, err := pr.SanitizeArgs(ctx, cmd)
 			if err != nil {
 				return err
@@ -131,9 +184,11 @@ func PrCommand(in io.Reader, repo *core.Repo, gh func(context.Context) core.Gh,
 }
 
 type create struct {
-	Repo         *core.Repo
-	Github       core.Gh
-	StoryFetcher func(string, string) story.StoryFetcher
+	Repo   *core.Repo
+	Github core.Gh
+	// Creates the PR, the rest of Github is only used on github.
+	Forge        core.Forge
+	StoryFetcher func(string, string) (story.StoryFetcher, error)
 }
 
 type args struct {
@@ -146,6 +201,12 @@ type args struct {
 	Detached       bool
 	InitialBranch  core.Branch
 	Extract        bool
+	Edit           bool
+	Reviewers      []string
+	Assignees      []string
+	Codeowners     bool
+	Labels         []string
+	Milestone      string
 }
 
 func (c *create) SanitizeArgs(ctx context.Context, cmd *cli.Command) (*args, error) {
@@ -190,8 +251,8 @@ func (c *create) SanitizeArgs(ctx context.Context, cmd *cli.Command) (*args, err
 	ancestor, commits, err := c.Repo.FindBranchingPoint(headCommit)
 	if err != nil {
 		return nil, cli.Exit(fmt.Sprintf(
-			"%s does not descend from %s/%s",
-			headCommit, core.GetRemoteName(), core.GetBaseBranch(),
+			"%s does not descend from %s",
+			headCommit, core.RemoteRef(c.Repo.BaseBranch()),
 		), 1)
 	}
 	tip := core.Must(c.Repo.GetLocalTip(ancestor))
@@ -214,6 +275,12 @@ func (c *create) SanitizeArgs(ctx context.Context, cmd *cli.Command) (*args, err
 		Interactive: cmd.Bool("interactive"),
 		DraftPr:     cmd.Bool("draft"),
 		Extract:     extract,
+		Edit:        cmd.Bool("edit"),
+		Reviewers:   append(core.GetPrReviewers(), cmd.StringSlice("reviewer")...),
+		Assignees:   assignees(cmd.StringSlice("assignee")),
+		Codeowners:  cmd.Bool("codeowners") || core.PrReviewersFromCodeowners(),
+		Labels:      cmd.StringSlice("label"),
+		Milestone:   cmd.String("milestone"),
 	}
 	if isOnBranch {
 		args.Detached = false
@@ -260,12 +327,12 @@ func (c *create) RebasePrCommits(ctx context.Context, previousArgs *args) (*args
 			true,
 		) {
 			return nil, cli.Exit(fmt.Errorf(
-				"one of the commits you chose cannot be replayed cleanly on %s/%s",
-				core.GetRemoteName(), previousArgs.AncestorBranch.RemoteName(),
+				"one of the commits you chose cannot be replayed cleanly on %s",
+				core.RemoteRef(previousArgs.AncestorBranch),
 			), 1)
 		}
 	} else {
-		fmt.Printf("Rebasing %d commits on top of %s/%s... ", len(previousArgs.Commits), core.GetRemoteName(), previousArgs.AncestorBranch.RemoteName())
+		fmt.Printf("Rebasing %d commits on top of %s... ", len(previousArgs.Commits), core.RemoteRef(previousArgs.AncestorBranch))
 		if !c.Repo.TryRebaseOntoSilently(
 			ctx,
 			previousArgs.Commits[len(previousArgs.Commits)-1].Hash,
@@ -278,8 +345,8 @@ func (c *create) RebasePrCommits(ctx context.Context, previousArgs *args) (*args
 			}
 			PrintFailure(nil)
 			return nil, cli.Exit(fmt.Errorf(
-				"one of these commits cannot be replayed cleanly on %s/%s:\n  - %s",
-				core.GetRemoteName(), previousArgs.AncestorBranch.RemoteName(), strings.Join(hashes, "\n  - "),
+				"one of these commits cannot be replayed cleanly on %s:\n  - %s",
+				core.RemoteRef(previousArgs.AncestorBranch), strings.Join(hashes, "\n  - "),
 			), 1)
 		}
 		PrintSuccess()
@@ -292,8 +359,8 @@ func (c *create) RebasePrCommits(ctx context.Context, previousArgs *args) (*args
 
 	if err != nil {
 		return nil, cli.Exit(fmt.Sprintf(
-			"%s does not descend from %s/%s",
-			headCommit, core.GetRemoteName(), core.GetBaseBranch(),
+			"%s does not descend from %s",
+			headCommit, core.RemoteRef(c.Repo.BaseBranch()),
 		), 1)
 	}
 
@@ -311,10 +378,20 @@ func (c *create) Create(ctx context.Context, in io.Reader, args *args) (*core.Lo
 
 	// The first commit is the child-most one.
 	lastCommit := args.Commits[0].Hash
-	title, body, err := c.GetBodyAndTitle(ctx, in, args.Commits)
+	stories, err := story.NewStoryService(c.StoryFetcher, in)
+	if err != nil {
+		return nil, fmt.Errorf("could not use the story tool: %w", err)
+	}
+	title, body, storyId, err := c.GetBodyAndTitle(ctx, stories, args.Commits, args.AncestorBranch)
 	if err != nil {
 		return nil, fmt.Errorf("could not get the pull request body and title: %w", err)
 	}
+	if args.Edit {
+		title, body, err = c.EditBodyAndTitle(ctx, title, body, args.Commits)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	pr, err := c.create(ctx, lastCommit, args.AncestorBranch, title, body, args.DraftPr)
 	if err != nil {
@@ -328,26 +405,88 @@ func (c *create) Create(ctx context.Context, in io.Reader, args *args) (*core.Lo
 	if err != nil {
 		err = fmt.Errorf("pr has been created but could not set tracking branch")
 	}
+	// Failing to request reviews, to label the PR or to update the stack of PRs
+	// should not undo it, it is only reported.
+	c.requestReviews(ctx, localPr, args)
+	labels := labeler{Repo: c.Repo, Issues: c.Github.Issues()}
+	labels.Apply(ctx, localPr, args.Commits, args.Labels, args.Milestone)
+	stacks := stack{Repo: c.Repo, PullRequests: c.Github.PullRequests()}
+	stacks.Update(ctx, localPr)
+	if storyId != "" {
+		localPr.SetStory(storyId)
+		if err := stories.StartReview(ctx, storyId, localPr.Url(), title); err != nil {
+			fmt.Printf("Could not update the story %s: %s\n", storyId, err)
+		}
+	}
 	fmt.Println(localPr.Url())
 	core.ClipboardWrite(localPr, title)
 	return localPr, err
 }
 
-func (c *create) GetBodyAndTitle(ctx context.Context, in io.Reader, commits []core.Commit) (string, string, error) {
+// GetBodyAndTitle returns the title and body of the PR, and the story it is for if any.
+func (c *create) GetBodyAndTitle(ctx context.Context, stories story.StoryService, commits []core.Commit, ancestor core.Branch) (string, string, string, error) {
 	rawTitle, rawBody := c.getRawBodyAndTitle(commits)
 	commitMessages := make([]string, len(commits))
 	for i, c := range commits {
 		commitMessages[i] = c.Message
 	}
-	storyService := story.NewStoryService(c.StoryFetcher, in)
-	title, body, err := storyService.EnrichBodyAndTitle(ctx, commitMessages, rawTitle, rawBody)
+	tmpl, err := c.Repo.LoadPrTemplate()
+	if err != nil {
+		return "", "", "", fmt.Errorf("could not load the PR template: %w", err)
+	}
+	if tmpl == nil {
+		title, body, storyId, err := stories.EnrichBodyAndTitle(ctx, commitMessages, rawTitle, rawBody)
+		if err != nil {
+			return "", "", "", fmt.Errorf("could not enrich the PR with the Story: %w", err)
+		}
+		return title, body, storyId, nil
+	}
+	title, storyId, storyLink, err := stories.FindStory(ctx, commitMessages, rawTitle)
+	if err != nil {
+		return "", "", "", fmt.Errorf("could not enrich the PR with the Story: %w", err)
+	}
+	var body strings.Builder
+	err = tmpl.Execute(&body, core.PrTemplateData{
+		LongestMessage: rawBody,
+		Commits:        commitList(commits),
+		Story:          storyId,
+		StoryLink:      storyLink,
+		Chain:          chainList(ancestor),
+	})
 	if err != nil {
-		return "", "", fmt.Errorf("could not enrich the PR with the Story: %w", err)
+		return "", "", "", fmt.Errorf("could not fill the PR template: %w", err)
 	}
-	return title, body, nil
+	return title, strings.TrimSpace(body.String()), storyId, nil
+}
+
+// A bulleted list of the subjects of the commits, oldest first.
+func commitList(commits []core.Commit) string {
+	lines := make([]string, len(commits))
+	for i, commit := range commits {
+		subject, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+		// The first commit is the child-most one.
+		lines[len(commits)-1-i] = fmt.Sprintf("- %s", strings.TrimSpace(subject))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// A bulleted list of the PRs a PR based on ancestor depends on, root of the chain first.
+func chainList(ancestor core.Branch) string {
+	if !ancestor.IsPr() {
+		return ""
+	}
+	pr := ancestor.(*core.LocalPr)
+	chain := append(pr.AllAncestors(), pr)
+	lines := make([]string, len(chain))
+	for i, pr := range chain {
+		lines[i] = fmt.Sprintf("- #%d", pr.PrNumber)
+	}
+	return strings.Join(lines, "\n")
 }
 
 func (c *create) getRawBodyAndTitle(commits []core.Commit) (string, string) {
+	// Sort a copy, the callers rely on the commits being in git order.
+	commits = slices.Clone(commits)
 	sort.Slice(commits, func(i, j int) bool {
 		return len(commits[i].Message) > len(commits[j].Message)
 	})
@@ -355,6 +494,47 @@ func (c *create) getRawBodyAndTitle(commits []core.Commit) (string, string) {
 	return strings.TrimSpace(title), strings.TrimSpace(body)
 }
 
+const editScissors = "# ------------------------ >8 ------------------------"
+
+// EditBodyAndTitle lets the user change the title and body of the PR in their editor,
+// like git does for commit messages: the first line is the title and the rest the body.
+func (c *create) EditBodyAndTitle(ctx context.Context, title, body string, commits []core.Commit) (string, string, error) {
+	var content strings.Builder
+	fmt.Fprintf(&content, "%s\n\n%s\n\n", title, body)
+	fmt.Fprintln(&content, editScissors)
+	fmt.Fprintln(&content, "# Do not modify or remove the line above.")
+	fmt.Fprintln(&content, "# Everything below it will be ignored.")
+	fmt.Fprintln(&content, "# The first line is the title of the PR, the rest is its body.")
+	fmt.Fprintln(&content, "# An empty title aborts the creation of the PR.")
+	fmt.Fprintln(&content, "#")
+	fmt.Fprintln(&content, "# Commits in this PR:")
+	for _, commit := range commits {
+		subject, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+		fmt.Fprintf(&content, "#   %s %s\n", commit.Hash[:7], subject)
+	}
+	if err := os.MkdirAll(c.Repo.DotOpDir(), 0755); err != nil {
+		return "", "", err
+	}
+	file := path.Join(c.Repo.DotOpDir(), "PR_EDITMSG")
+	if err := os.WriteFile(file, []byte(content.String()), 0644); err != nil {
+		return "", "", err
+	}
+	defer os.Remove(file)
+	if err := c.Repo.Edit(ctx, file); err != nil {
+		return "", "", fmt.Errorf("editor failed: %w", err)
+	}
+	edited, err := os.ReadFile(file)
+	if err != nil {
+		return "", "", err
+	}
+	message, _, _ := strings.Cut(string(edited), editScissors)
+	title, body, _ = strings.Cut(strings.TrimSpace(message), "\n")
+	if strings.TrimSpace(title) == "" {
+		return "", "", errors.New("empty PR title, aborting")
+	}
+	return strings.TrimSpace(title), strings.TrimSpace(body), nil
+}
+
 func (c *create) createLocalBranchForPr(number int, hash string, ancestor core.Branch) {
 	branchName := core.LocalBranchForPr(number)
 	ctx := context.Background()
@@ -398,36 +578,31 @@ func (c *create) createOnce(
 		fmt.Errorf("creating PR too slow, increase github.timeout"),
 	)
 	defer cancel()
-	lastPr, err := c.getLastPrNumber(ctx)
+	lastPr, err := c.Forge.LastPrNumber(ctx)
 	if err != nil {
 		return 0, err
 	}
 	remote := core.RemoteBranchForPr(lastPr + 1)
-	base := ancestor.RemoteName()
+	head := core.GithubHead(remote)
+	base := c.Repo.GithubBase(ancestor)
 	err = c.Repo.Push(ctx, hash, remote)
 	if err != nil {
 		return 0, err
 	}
-	pull := github.NewPullRequest{
-		Title: &title,
-		Head:  &remote,
-		Base:  &base,
-		Body:  &body,
-		Draft: &draft,
-	}
-	pr, _, err := c.Github.PullRequests().Create(
-		ctx,
-		core.GetGithubOwner(),
-		core.GetGithubRepoName(),
-		&pull,
-	)
+	pr, err := c.Forge.CreatePr(ctx, core.NewPr{
+		Title: title,
+		Head:  head,
+		Base:  base,
+		Body:  body,
+		Draft: draft,
+	})
 	if err != nil {
 		return 0, err
 	}
-	if *pr.Number != lastPr+1 {
+	if pr.Number != lastPr+1 {
 		return lastPr + 1, ErrLostPrCreationRaceCondition
 	}
-	return *pr.Number, nil
+	return pr.Number, nil
 }
 
 func (c *create) undoCreatePr(ctx context.Context, prNumber int) {
@@ -436,29 +611,3 @@ func (c *create) undoCreatePr(ctx context.Context, prNumber int) {
 	// The local branch has not been created yet, no need to delete it.
 	c.Repo.DeleteRemoteBranch(ctx, pr)
 }
-
-// The Github API list pull requests and issues under "issues".
-func (c *create) getLastPrNumber(ctx context.Context) (int, error) {
-	issues, _, err := c.Github.Issues().ListByRepo(
-		ctx,
-		core.GetGithubOwner(),
-		core.GetGithubRepoName(),
-		&github.IssueListByRepoOptions{
-			State:     "all",
-			Sort:      "created",
-			Direction: "desc",
-			ListOptions: github.ListOptions{
-				Page:    0,
-				PerPage: 1,
-			},
-		},
-	)
-	if err != nil {
-		return 0, err
-	}
-
-	if len(issues) == 0 {
-		return 0, nil
-	}
-	return *issues[0].Number, nil
-}
@@ -8,6 +8,8 @@ import (
 	"github.com/cupcicm/opp/core/story"
 	"github.com/cupcicm/opp/core/tests"
 	"github.com/google/go-github/v56/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestPrStoryInCommits(t *testing.T) {
@@ -197,3 +199,34 @@ func TestPrStoryFetched(t *testing.T) {
 		})
 	}
 }
+
+func TestPrMovesStoryToReviewThenDone(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.Repo.GitExec(context.Background(), "checkout origin/master").Run()
+	r.Repo.GitExec(context.Background(), "checkout -b test_branch").Run()
+	wt := core.Must(r.Source.Worktree())
+	wt.Add("README.md")
+	r.Commit("[ABC-123] my title\n\nmy body")
+
+	pr := r.CreatePr(t, "HEAD", 2)
+
+	assert.Equal(t, "ABC-123", pr.Story())
+	r.StoryFetcherMock.AssertCalled(t, "MoveStory", mock.Anything, "ABC-123", "In Review")
+	r.StoryFetcherMock.AssertCalled(t, "AttachLink", mock.Anything, "ABC-123", pr.Url(), "[ABC-123] my title")
+	r.StoryFetcherMock.AssertNotCalled(t, "MoveStory", mock.Anything, "ABC-123", "Done")
+
+	assert.Nil(t, r.MergePr(t, pr))
+	r.StoryFetcherMock.AssertCalled(t, "MoveStory", mock.Anything, "ABC-123", "Done")
+}
+
+func TestPrWithoutStoryLeavesStoriesAlone(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr := r.CreatePr(t, "HEAD", 2)
+
+	assert.Empty(t, pr.Story())
+	assert.Nil(t, r.MergePr(t, pr))
+	r.StoryFetcherMock.AssertNotCalled(t, "MoveStory", mock.Anything, mock.Anything, mock.Anything)
+	r.StoryFetcherMock.AssertNotCalled(t, "AttachLink", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -2,13 +2,20 @@ package cmd_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/cupcicm/opp/core"
+	"github.com/cupcicm/opp/core/story"
 	"github.com/cupcicm/opp/core/tests"
 	"github.com/google/go-github/v56/github"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestCanCreatePR(t *testing.T) {
@@ -103,3 +110,203 @@ func TestCanSetAncestorWithDraft(t *testing.T) {
 		assert.Equal(t, "pr/2", ancestor.LocalName())
 	}
 }
+
+func TestCanRequestReviewersAndAssignees(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	viper.Set("pr.reviewers", []string{"bob"})
+
+	r.GithubMock.PullRequestsMock.CallRequestReviewers(2, []string{"bob", "alice"}, []string{"team"})
+	r.GithubMock.IssuesMock.CallAddAssignees(2, "cupcicm", "carol")
+	r.CreatePr(t, "HEAD", 2, "--reviewer", "alice", "-r", "cupcicm/team", "--assignee", "me", "-a", "carol")
+
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+	r.GithubMock.IssuesMock.AssertExpectations(t)
+}
+
+func TestCanRequestReviewsFromCodeowners(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	os.Mkdir(path.Join(r.Path(), ".github"), 0755)
+	os.WriteFile(path.Join(r.Path(), ".github", "CODEOWNERS"), []byte(strings.Join([]string{
+		"*  @cupcicm/everyone",
+		"3  @alice @cupcicm",
+		"4  @bob robot@example.com",
+	}, "\n")), 0644)
+
+	// The PR adds the files 0, 2, 3 and 4. The author of the PR is not asked to review it.
+	r.GithubMock.PullRequestsMock.CallRequestReviewers(2, []string{"alice", "bob"}, []string{"everyone"})
+	r.CreatePr(t, "HEAD", 2, "--codeowners")
+
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+}
+
+func TestFailingToRequestReviewersKeepsThePr(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.GithubMock.IssuesMock.On("AddAssignees", mock.Anything, "cupcicm", "opp", 2, []string{"ghost"}).Return(
+		&github.Issue{}, nil, errors.New("ghost is not a collaborator"),
+	).Once()
+	r.GithubMock.IssuesMock.CallListAndReturnPr(1)
+	r.GithubMock.PullRequestsMock.CallCreate(2)
+	r.StoryFetcherMock.CallFetchInProgressStories([]story.Story{}, false)
+
+	assert.Nil(t, r.Run("pr", "--assignee", "ghost", "HEAD"))
+	localPr := r.AssertHasPr(t, 2)
+	assert.True(t, localPr.StateIsLoaded())
+}
+
+func TestCanLabelPr(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	viper.Set("pr.rules", []map[string]any{
+		{"paths": []string{"4"}, "labels": []string{"four"}},
+		{"messages": []string{"^2$"}, "labels": []string{"two", "review"}, "milestone": "v2"},
+		{"paths": []string{"5"}, "labels": []string{"five"}},
+	})
+
+	r.GithubMock.IssuesMock.CallAddLabels(2, "review", "four", "two")
+	r.GithubMock.IssuesMock.CallSetMilestone(2, "v1")
+	localPr := r.CreatePr(t, "HEAD", 2, "--label", "review", "--milestone", "v1")
+
+	r.GithubMock.IssuesMock.AssertExpectations(t)
+	assert.Equal(t, []string{"review", "four", "two"}, localPr.Labels())
+	assert.Equal(t, "v1", localPr.Milestone())
+}
+
+func TestCanEditPrTitleAndBody(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	// Replace the title and write a body below it.
+	t.Setenv("GIT_EDITOR", "sed -i '1s/.*/Edited title/; 3i Edited body'")
+
+	title := "Edited title"
+	body := "Edited body"
+	draft := false
+	head := "cupcicm/pr/2"
+	base := "master"
+	r.CreatePrAssertPrDetails(t, "HEAD", 2, github.NewPullRequest{
+		Title: &title,
+		Head:  &head,
+		Base:  &base,
+		Body:  &body,
+		Draft: &draft,
+	}, "--edit")
+}
+
+func TestEmptyEditAbortsPrCreation(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	t.Setenv("GIT_EDITOR", "truncate -s 0")
+	r.StoryFetcherMock.CallFetchInProgressStories([]story.Story{}, false)
+
+	assert.Error(t, r.Run("pr", "--edit", "HEAD"))
+	r.GithubMock.PullRequestsMock.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	_, err := r.Source.Branch("pr/2")
+	assert.Error(t, err)
+}
+
+func TestCanUsePrTemplate(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD^", 2)
+	os.Mkdir(path.Join(r.Path(), ".github"), 0755)
+	os.WriteFile(path.Join(r.Path(), ".github", "pull_request_template.md"), []byte(strings.Join([]string{
+		"{{.StoryLink}}",
+		"",
+		"## Commits",
+		"{{.Commits}}",
+		"",
+		"## Depends on",
+		"{{.Chain}}",
+		"",
+		"{{.LongestMessage}}",
+	}, "\n")), 0644)
+	r.RewriteLastCommit("Do the thing [ABC-123]\n\nBecause.")
+
+	title := "Do the thing [ABC-123]"
+	body := strings.Join([]string{
+		"Linear [ABC-123](https://my.base.url/browse/ABC-123)",
+		"",
+		"## Commits",
+		"- Do the thing [ABC-123]",
+		"",
+		"## Depends on",
+		"- #2",
+		"",
+		"Because.",
+	}, "\n")
+	draft := false
+	head := "cupcicm/pr/3"
+	base := "cupcicm/pr/2"
+	r.CreatePrAssertPrDetails(t, "HEAD", 3, github.NewPullRequest{
+		Title: &title,
+		Head:  &head,
+		Base:  &base,
+		Body:  &body,
+		Draft: &draft,
+	})
+}
+
+func TestIgnoresGithubTemplatesThatAreNotValidTemplates(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	os.Mkdir(path.Join(r.Path(), ".github"), 0755)
+	os.WriteFile(path.Join(r.Path(), ".github", "pull_request_template.md"), []byte("Run {{ the linter }} first\n"), 0644)
+	r.RewriteLastCommit("Do the thing\n\nBecause.")
+
+	title := "Do the thing"
+	body := "Because."
+	draft := false
+	head := "cupcicm/pr/2"
+	base := "master"
+	r.CreatePrAssertPrDetails(t, "HEAD", 2, github.NewPullRequest{
+		Title: &title,
+		Head:  &head,
+		Base:  &base,
+		Body:  &body,
+		Draft: &draft,
+	})
+}
+
+func TestCanConfigurePrTemplate(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD^", 2)
+	viper.Set("pr.template", "template.md")
+	os.WriteFile(path.Join(r.Path(), "template.md"), []byte("Story: {{.Story}}\n{{.Commits}}\n"), 0644)
+
+	title := "4"
+	body := "Story: \n- 4"
+	draft := false
+	head := "cupcicm/pr/3"
+	base := "cupcicm/pr/2"
+	r.CreatePrAssertPrDetails(t, "HEAD", 3, github.NewPullRequest{
+		Title: &title,
+		Head:  &head,
+		Base:  &base,
+		Body:  &body,
+		Draft: &draft,
+	})
+}
+
+func TestCreatePrFromFork(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.PushToFork(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+
+	r.GithubMock.PullRequestsMock.AssertCalled(t, "Create", mock.Anything, "cupcicm", "opp", mock.MatchedBy(func(pull *github.NewPullRequest) bool {
+		return pull.GetHead() == "alice:cupcicm/pr/2" && pull.GetBase() == "master"
+	}))
+	// Github can only base PRs opened from a fork on the branches of upstream.
+	r.GithubMock.PullRequestsMock.AssertCalled(t, "Create", mock.Anything, "cupcicm", "opp", mock.MatchedBy(func(pull *github.NewPullRequest) bool {
+		return pull.GetHead() == "alice:cupcicm/pr/3" && pull.GetBase() == "master"
+	}))
+
+	// The branches are on the fork, the base branch comes from upstream.
+	ctx := context.Background()
+	assert.Equal(t, core.Must(r.GetLocalTip(pr2)), core.Must(r.GetRefHash(ctx, "refs/remotes/fork/cupcicm/pr/2")))
+	_, err := r.GetRefHash(ctx, "refs/remotes/origin/cupcicm/pr/2")
+	assert.Error(t, err)
+	assert.Equal(t, "origin/master\n", string(core.Must(r.GitExec(ctx, "rev-parse --abbrev-ref pr/2@{upstream}").Output())))
+	assert.Equal(t, "fork/cupcicm/pr/2\n", string(core.Must(r.GitExec(ctx, "rev-parse --abbrev-ref pr/3@{upstream}").Output())))
+
+	assert.NoError(t, r.Fetch(ctx))
+	assert.Equal(t, core.Must(r.GetLocalTip(pr3)), core.Must(r.GetRemoteTip(pr3)))
+	r.Repo.Checkout(ctx, pr3)
+	assert.Nil(t, r.Run("rebase"))
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/urfave/cli/v3"
 )
 
-func PushCommand(repo *core.Repo) *cli.Command {
+func PushCommand(repo *core.Repo, gh func(context.Context) core.Gh) *cli.Command {
 	cmd := &cli.Command{
 		Name:    "push",
 		Aliases: []string{"up", "p"},
@@ -27,7 +27,16 @@ func PushCommand(repo *core.Repo) *cli.Command {
 				return nil
 			}
 			pr := branch.(*core.LocalPr)
-			return push(ctx, repo, pr)
+			if err := push(ctx, repo, pr); err != nil {
+				return err
+			}
+			client := gh(ctx)
+			// The new commits may touch paths that match other label rules.
+			labels := labeler{Repo: repo, Issues: client.Issues()}
+			labels.Relabel(ctx, pr)
+			stacks := stack{Repo: repo, PullRequests: client.PullRequests()}
+			stacks.Update(ctx, pr)
+			return nil
 		},
 	}
 
@@ -0,0 +1,38 @@
+package cmd_test
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/cupcicm/opp/core/tests"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushAppliesNewLabels(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	viper.Set("pr.rules", []map[string]any{
+		{"messages": []string{"^2$"}, "labels": []string{"two"}},
+		{"paths": []string{"new"}, "labels": []string{"new"}},
+	})
+
+	r.GithubMock.IssuesMock.CallAddLabels(2, "two")
+	pr2 := r.CreatePr(t, "HEAD", 2)
+	r.Checkout(context.Background(), pr2)
+
+	os.WriteFile(path.Join(r.Path(), "new"), []byte("new"), 0644)
+	wt := core.Must(r.Source.Worktree())
+	wt.Add("new")
+	r.Commit("add a new file")
+
+	// "two" has already been applied, only "new" is added.
+	r.GithubMock.IssuesMock.CallAddLabels(2, "new")
+	assert.NoError(t, r.Run("push"))
+
+	r.GithubMock.IssuesMock.AssertExpectations(t)
+	pr2.ReloadState()
+	assert.Equal(t, []string{"two", "new"}, pr2.Labels())
+}
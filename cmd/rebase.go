@@ -5,20 +5,48 @@ import (
 	"errors"
 	"fmt"
 	"slices"
+	"strings"
 
 	"github.com/cupcicm/opp/core"
 	"github.com/urfave/cli/v3"
 )
 
-func RebaseCommand(repo *core.Repo) *cli.Command {
+var (
+	ErrRebaseInterrupted = errors.New("please finish the interactive rebase, then run opp rebase --continue (or opp rebase --abort)")
+	ErrRebaseInProgress  = errors.New("a rebase is in progress, run opp rebase --continue or opp rebase --abort")
+)
+
+func RebaseCommand(repo *core.Repo, gh func(context.Context) core.Gh) *cli.Command {
 	cmd := &cli.Command{
 		Name:    "rebase",
 		Aliases: []string{"reb", "r", "pull"},
 		Usage:   "rebase the current branch and dependent PRs if needed.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "Rebase all the local PRs, not only the current one.",
+			},
+			&cli.BoolFlag{
+				Name:  "continue",
+				Usage: "Resume the rebase of a PR chain after resolving a conflict.",
+			},
+			&cli.BoolFlag{
+				Name:  "abort",
+				Usage: "Stop the rebase of a PR chain, and put its PRs back where they were.",
+			},
+		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			if cmd.NArg() > 0 {
 				return errors.New("too many arguments")
 			}
+			switch {
+			case cmd.Bool("continue"):
+				return rebaseContinue(ctx, repo, gh)
+			case cmd.Bool("abort"):
+				return rebaseAbort(ctx, repo)
+			case cmd.Bool("all"):
+				return rebaseAllCommand(ctx, repo, gh)
+			}
 			pr, headIsAPr := repo.PrForHead()
 			if !headIsAPr {
 				return cli.Exit("You can run rebase only on local pr branches", 1)
@@ -33,41 +61,190 @@ func RebaseCommand(repo *core.Repo) *cli.Command {
 			if err != nil {
 				return err
 			}
-			if hasBeenMerged {
-				repo.Checkout(ctx, repo.BaseBranch())
-			} else {
-				repo.Checkout(ctx, pr)
-			}
-			return nil
+			return afterRebase(ctx, repo, gh, pr, hasBeenMerged)
 		},
 	}
 	return cmd
 }
 
+func afterRebase(ctx context.Context, repo *core.Repo, gh func(context.Context) core.Gh, pr *core.LocalPr, hasBeenMerged bool) error {
+	if hasBeenMerged {
+		repo.Checkout(ctx, repo.BaseBranch())
+		return nil
+	}
+	repo.Checkout(ctx, pr)
+	// Merged ancestors have been removed from the chain.
+	stacks := stack{Repo: repo, PullRequests: gh(ctx).PullRequests()}
+	stacks.Update(ctx, pr)
+	return nil
+}
+
 // Return true when the current PR has been merged and does not actually exist anymore.
 func rebase(ctx context.Context, repo *core.Repo, pr *core.LocalPr, first bool) (bool, error) {
+	if op, err := repo.StateStore().GetRebaseOperation(); err != nil || op != nil {
+		return false, cli.Exit(ErrRebaseInProgress, 1)
+	}
 	_, err := repo.GetLocalTip(pr)
 	if errors.Is(err, core.ErrReferenceNotFound) {
 		// The branch has been merged and deleted.
-		repo.CleanupAfterMerge(ctx, pr)
+		if _, err := repo.CleanupAfterMerge(ctx, pr); err != nil {
+			return false, err
+		}
 		return true, nil
 	}
 
-	ancestor, err := pr.GetAncestor()
-	if err != nil {
-		return false, cli.Exit(
-			fmt.Errorf(".opp/state/pr/%d is invalid, not sure what to rebase on", pr.PrNumber), 1)
+	// Stop at the first ancestor that has been merged and deleted:
+	// the PRs that come before it do not need to be rebased.
+	chain := []*core.LocalPr{pr}
+	var deleted *core.LocalPr
+	ancestors := pr.AllAncestors()
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		ancestor := ancestors[i]
+		if _, err := repo.GetLocalTip(ancestor); errors.Is(err, core.ErrReferenceNotFound) {
+			deleted = ancestor
+			break
+		}
+		chain = append(chain, ancestor)
 	}
+	slices.Reverse(chain)
 
-	ancestorCommit, err := FirstAncestorCommit(repo, pr)
+	op := &core.RebaseOperation{
+		Pr:           pr.PrNumber,
+		Parents:      make(map[int]string),
+		OriginalTips: make(map[int]string),
+	}
+	for _, current := range chain {
+		if _, err := current.GetAncestor(); err != nil {
+			return false, cli.Exit(
+				fmt.Errorf(".opp/state/pr/%d is invalid, not sure what to rebase on", current.PrNumber), 1)
+		}
+		// Where each PR starts needs to be found before its ancestors get rebased.
+		parent, err := FirstAncestorCommit(repo, current)
+		if err != nil {
+			return false, err
+		}
+		op.Chain = append(op.Chain, current.PrNumber)
+		op.Parents[current.PrNumber] = parent
+		op.OriginalTips[current.PrNumber] = core.Must(repo.GetLocalTip(current))
+	}
+	if deleted != nil {
+		if _, err := repo.CleanupAfterMerge(ctx, deleted); err != nil {
+			return false, err
+		}
+	}
+	if err := repo.StateStore().SaveRebaseOperation(op); err != nil {
+		return false, fmt.Errorf("could not save the progress of the rebase: %w", err)
+	}
+	return runRebase(ctx, repo, op, first)
+}
+
+// runRebase rebases the PRs of the chain that have not been rebased yet, root first,
+// and saves the progress after each of them.
+// Return true when the last PR of the chain has been merged and does not actually exist anymore.
+func runRebase(ctx context.Context, repo *core.Repo, op *core.RebaseOperation, first bool) (bool, error) {
+	if len(op.Done) == 0 && len(op.Chain) > 1 && core.RebaseWithUpdateRefs() && repo.SupportsUpdateRefs(ctx) {
+		if hasBeenMerged, ok := rebaseInOnePass(ctx, repo, op); ok {
+			repo.StateStore().DeleteRebaseOperation()
+			return hasBeenMerged, nil
+		}
+	}
+	for _, number := range op.Chain {
+		if slices.Contains(op.Done, number) {
+			continue
+		}
+		op.Pending = number
+		if err := repo.StateStore().SaveRebaseOperation(op); err != nil {
+			return false, fmt.Errorf("could not save the progress of the rebase: %w", err)
+		}
+		pr := core.NewLocalPr(repo, number)
+		hasBeenMerged, err := rebaseOnAncestor(ctx, repo, pr, op.Parents[number], first && number == op.Pr)
+		if err != nil {
+			return false, err
+		}
+		op.Done = append(op.Done, number)
+		op.Pending = 0
+		if err := repo.StateStore().SaveRebaseOperation(op); err != nil {
+			return false, fmt.Errorf("could not save the progress of the rebase: %w", err)
+		}
+		if hasBeenMerged && number == op.Pr {
+			repo.StateStore().DeleteRebaseOperation()
+			return true, nil
+		}
+	}
+	repo.StateStore().DeleteRebaseOperation()
+	return false, nil
+}
+
+// Rebases the whole chain with a single git rebase --update-refs, that moves the branches
+// of all the PRs of the chain at once. This only works when each PR still starts at the tip
+// of its ancestor.
+// Returns false when the chain needs to be rebased PR by PR instead.
+func rebaseInOnePass(ctx context.Context, repo *core.Repo, op *core.RebaseOperation) (bool, bool) {
+	root := core.NewLocalPr(repo, op.Chain[0])
+	leaf := core.NewLocalPr(repo, op.Pr)
+	for i, number := range op.Chain[1:] {
+		if op.Parents[number] != op.OriginalTips[op.Chain[i]] {
+			// The ancestor has been amended: the known tips are needed to find where the PR starts.
+			return false, false
+		}
+	}
+	branches, err := repo.LocalBranchesBetween(ctx, op.Parents[root.PrNumber], op.OriginalTips[leaf.PrNumber])
 	if err != nil {
-		return false, err
+		return false, false
+	}
+	// git moves all the branches inside the chain, but only the PRs of the chain must move.
+	others := make(map[string]string)
+	for branch, tip := range branches {
+		if number, err := core.ExtractPrNumber(branch); err != nil || !slices.Contains(op.Chain, number) {
+			others[branch] = tip
+		}
+	}
+	onto, err := root.GetAncestor()
+	if err != nil {
+		onto = repo.BaseBranch()
+	}
+	if onto.IsPr() {
+		return false, false
 	}
+	var names []string
+	for _, number := range op.Chain {
+		names = append(names, core.LocalBranchForPr(number))
+	}
+	fmt.Printf("Rebasing %s on %s... ", strings.Join(names, ", "), onto.LocalName())
+	if err := repo.Checkout(ctx, leaf); err != nil {
+		PrintFailure(err)
+		return false, false
+	}
+	if !repo.TryRebaseWithUpdateRefs(ctx, op.Parents[root.PrNumber], onto) {
+		PrintFailure(nil)
+		return false, false
+	}
+	PrintSuccess()
+	for branch, tip := range others {
+		repo.ResetBranch(ctx, core.NewBranch(repo, branch), tip)
+	}
+	hasBeenMerged := false
+	for _, number := range op.Chain {
+		// Reloads the state: the ancestor may have been cleaned because it was merged.
+		pr := core.NewLocalPr(repo, number)
+		hasBeenMerged = finishRebase(ctx, repo, pr)
+	}
+	return hasBeenMerged, true
+}
 
+// Rebases pr on its ancestor, that must already have been rebased.
+// Return true when the PR has been merged and does not actually exist anymore.
+func rebaseOnAncestor(ctx context.Context, repo *core.Repo, pr *core.LocalPr, parent string, first bool) (bool, error) {
+	// The ancestor may have been merged and cleaned, making pr depend on the base branch.
+	pr.ReloadState()
+	ancestor, err := pr.GetAncestor()
+	if err != nil {
+		ancestor = repo.BaseBranch()
+	}
 	if ancestor.IsPr() {
-		return rebaseOnDependentPr(ctx, repo, pr, ancestor.(*core.LocalPr), ancestorCommit, first)
+		return rebaseOnDependentPr(ctx, repo, pr, ancestor.(*core.LocalPr), parent, first)
 	} else {
-		return rebaseOnBaseBranch(ctx, repo, pr, ancestorCommit, first)
+		return rebaseOnBaseBranch(ctx, repo, pr, parent, first)
 	}
 }
 
@@ -93,19 +270,10 @@ func rebaseOnBaseBranch(
 		fmt.Printf("Here is an editor where you need to choose how to correctly rebase %s on top of the new %s\n", pr.LocalBranch(), base.RemoteName())
 		err := repo.InteractiveRebase(ctx, base)
 		if err != nil {
-			return false, errors.New("please finish the interactive rebase then re-run")
+			return false, ErrRebaseInterrupted
 		}
 	}
-	remoteBaseBranchTip := core.Must(repo.GetRemoteTip(repo.BaseBranch()))
-	localPrTip := core.Must(repo.GetLocalTip(pr))
-	pr.RememberCurrentTip()
-	if repo.IsAncestor(ctx, localPrTip, remoteBaseBranchTip) {
-		// PR has been merged : the local branch is now part
-		// of the history of the main branch.
-		repo.CleanupAfterMerge(ctx, pr)
-		return true, nil
-	}
-	return false, nil
+	return finishRebase(ctx, repo, pr), nil
 }
 
 // The strategy here is: try to rebase silently.
@@ -121,15 +289,6 @@ func rebaseOnDependentPr(
 	parent string,
 	first bool,
 ) (bool, error) {
-	hasBeenMerged, err := rebase(ctx, repo, ancestor, false)
-	if err != nil {
-		return false, err
-	}
-	if hasBeenMerged {
-		pr.ReloadState()
-		return rebaseOnBaseBranch(ctx, repo, pr, parent, first)
-	}
-
 	if !first {
 		fmt.Printf("Rebasing dependent PR %s...\n", pr.LocalBranch())
 	} else {
@@ -146,11 +305,124 @@ func rebaseOnDependentPr(
 		fmt.Printf("Please delete all lines that represent commits in %s\n", ancestor.LocalBranch())
 		err := repo.InteractiveRebase(ctx, ancestor)
 		if err != nil {
-			return false, errors.New("please finish the interactive rebase then re-run")
+			return false, ErrRebaseInterrupted
 		}
 	}
+	return finishRebase(ctx, repo, pr), nil
+}
+
+// Remembers the new tip of a PR that has just been rebased on its ancestor.
+// Return true when the PR has been merged and does not actually exist anymore.
+func finishRebase(ctx context.Context, repo *core.Repo, pr *core.LocalPr) bool {
 	pr.RememberCurrentTip()
-	return false, nil
+	if ancestor, err := pr.GetAncestor(); err == nil && ancestor.IsPr() {
+		return false
+	}
+	remoteBaseBranchTip := core.Must(repo.GetRemoteTip(repo.BaseBranch()))
+	localPrTip := core.Must(repo.GetLocalTip(pr))
+	if repo.IsAncestor(ctx, localPrTip, remoteBaseBranchTip) {
+		// PR has been merged : the local branch is now part
+		// of the history of the main branch.
+		if _, err := repo.CleanupAfterMerge(ctx, pr); err != nil {
+			// The PR stays, the next rebase tries again.
+			fmt.Println(err)
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// Whether the PR has been rebased on the current version of its ancestor.
+func isRebasedOnAncestor(ctx context.Context, repo *core.Repo, pr *core.LocalPr) bool {
+	tip, err := repo.GetLocalTip(pr)
+	if err != nil {
+		return false
+	}
+	ancestor, err := pr.GetAncestor()
+	if err != nil {
+		ancestor = repo.BaseBranch()
+	}
+	var ancestorTip string
+	if ancestor.IsPr() {
+		ancestorTip, err = repo.GetLocalTip(ancestor)
+	} else {
+		ancestorTip, err = repo.GetRemoteTip(ancestor)
+	}
+	return err == nil && repo.IsAncestor(ctx, ancestorTip, tip)
+}
+
+// Resumes the rebase interrupted by a conflict, once the user has resolved it.
+func rebaseContinue(ctx context.Context, repo *core.Repo, gh func(context.Context) core.Gh) error {
+	op, err := repo.StateStore().GetRebaseOperation()
+	if err != nil {
+		return cli.Exit(fmt.Errorf("could not read the rebase in progress: %w", err), 1)
+	}
+	if op == nil {
+		return cli.Exit("no opp rebase in progress", 1)
+	}
+	if repo.RebaseInProgress(ctx) {
+		if err := repo.ContinueRebase(ctx); err != nil {
+			return ErrRebaseInterrupted
+		}
+	}
+	if op.Pending != 0 {
+		pending := core.NewLocalPr(repo, op.Pending)
+		// When the user aborted the git rebase, the pending PR is rebased again.
+		if isRebasedOnAncestor(ctx, repo, pending) {
+			hasBeenMerged := finishRebase(ctx, repo, pending)
+			op.Done = append(op.Done, op.Pending)
+			op.Pending = 0
+			if hasBeenMerged && pending.PrNumber == op.Pr {
+				repo.StateStore().DeleteRebaseOperation()
+				return afterRebase(ctx, repo, gh, pending, true)
+			}
+			if err := repo.StateStore().SaveRebaseOperation(op); err != nil {
+				return fmt.Errorf("could not save the progress of the rebase: %w", err)
+			}
+		}
+	}
+	pr := core.NewLocalPr(repo, op.Pr)
+	hasBeenMerged, err := runRebase(ctx, repo, op, false)
+	if err != nil {
+		return err
+	}
+	return afterRebase(ctx, repo, gh, pr, hasBeenMerged)
+}
+
+// Unwinds the rebase in progress: the PRs of the chain go back to where they were
+// before opp rebase. The PRs found to be merged stay cleaned.
+func rebaseAbort(ctx context.Context, repo *core.Repo) error {
+	op, err := repo.StateStore().GetRebaseOperation()
+	if err != nil {
+		return cli.Exit(fmt.Errorf("could not read the rebase in progress: %w", err), 1)
+	}
+	if op == nil {
+		return cli.Exit("no opp rebase in progress", 1)
+	}
+	if repo.RebaseInProgress(ctx) {
+		if err := repo.AbortRebase(ctx); err != nil {
+			return cli.Exit(fmt.Errorf("could not abort the git rebase: %w", err), 1)
+		}
+	}
+	if err := repo.DetachHead(ctx); err != nil {
+		return cli.Exit(fmt.Errorf("could not detach HEAD: %w", err), 1)
+	}
+	for _, number := range op.Chain {
+		// Do not use core.NewLocalPr: it would create the state of cleaned PRs again.
+		branch := core.NewBranch(repo, core.LocalBranchForPr(number))
+		if _, err := repo.GetLocalTip(branch); err != nil {
+			continue
+		}
+		if err := repo.ResetBranch(ctx, branch, op.OriginalTips[number]); err != nil {
+			return cli.Exit(fmt.Errorf("could not reset %s: %w", branch.LocalName(), err), 1)
+		}
+	}
+	repo.StateStore().DeleteRebaseOperation()
+	if repo.Checkout(ctx, core.NewBranch(repo, core.LocalBranchForPr(op.Pr))) != nil {
+		repo.Checkout(ctx, repo.BaseBranch())
+	}
+	return nil
 }
 
 // Returns the hash of the first commit in the history of pr that belongs to its ancestor,
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/urfave/cli/v3"
+)
+
+type rebaseOutcome int
+
+const (
+	rebased rebaseOutcome = iota
+	merged
+	conflicted
+)
+
+// rebaseAll rebases every local PR chain, root first. A PR shared by
+// several chains is rebased only once.
+type rebaseAll struct {
+	Repo *core.Repo
+	// The commit where each PR starts, computed before anything is rebased.
+	parents  map[int]string
+	outcomes map[int]rebaseOutcome
+	// Why each conflicted PR could not be rebased.
+	reasons   map[int]string
+	Rebased   []*core.LocalPr
+	Merged    []*core.LocalPr
+	Conflicts []*core.LocalPr
+}
+
+func rebaseAllCommand(ctx context.Context, repo *core.Repo, gh func(context.Context) core.Gh) error {
+	if op, err := repo.StateStore().GetRebaseOperation(); err != nil || op != nil {
+		return cli.Exit(ErrRebaseInProgress, 1)
+	}
+	if err := repo.Fetch(ctx); err != nil {
+		return cli.Exit(fmt.Errorf("error during fetch: %w", err), 1)
+	}
+	if !repo.NoLocalChanges(ctx) {
+		return cli.Exit("there are uncommitted changes. Cannot run rebase", 1)
+	}
+	initialRef, err := repo.GetHeadRef(ctx)
+	if err != nil {
+		return err
+	}
+	r := rebaseAll{
+		Repo:     repo,
+		parents:  make(map[int]string),
+		outcomes: make(map[int]rebaseOutcome),
+		reasons:  make(map[int]string),
+	}
+	r.Run(ctx)
+	if repo.CheckoutRef(ctx, initialRef) != nil {
+		repo.Checkout(ctx, repo.BaseBranch())
+	}
+	r.PrintSummary()
+	// Merged ancestors have been removed from the chains.
+	stacks := stack{Repo: repo, PullRequests: gh(ctx).PullRequests()}
+	stacks.Update(ctx, r.Rebased...)
+	if len(r.Conflicts) > 0 {
+		return cli.Exit("some PRs could not be rebased: check them out and run opp rebase to resolve the conflicts", 1)
+	}
+	return nil
+}
+
+// Leaves returns the local PRs no other PR depends on.
+func (r *rebaseAll) Leaves(prs []core.LocalPr) []*core.LocalPr {
+	hasDependents := make(map[int]bool)
+	for _, pr := range prs {
+		if ancestor, err := pr.GetAncestor(); err == nil && ancestor.IsPr() {
+			hasDependents[ancestor.(*core.LocalPr).PrNumber] = true
+		}
+	}
+	var leaves []*core.LocalPr
+	for _, pr := range prs {
+		pr := pr
+		if !hasDependents[pr.PrNumber] {
+			leaves = append(leaves, &pr)
+		}
+	}
+	slices.SortFunc(leaves, func(pr1, pr2 *core.LocalPr) int {
+		return pr1.PrNumber - pr2.PrNumber
+	})
+	return leaves
+}
+
+func (r *rebaseAll) Run(ctx context.Context) {
+	prs := r.Repo.AllPrs(ctx)
+	for _, pr := range prs {
+		pr := pr
+		parent, err := FirstAncestorCommit(r.Repo, &pr)
+		if err != nil {
+			r.conflict(&pr, err.Error())
+			continue
+		}
+		r.parents[pr.PrNumber] = parent
+	}
+	for _, leaf := range r.Leaves(prs) {
+		for _, pr := range append(leaf.AllAncestors(), leaf) {
+			if _, done := r.outcomes[pr.PrNumber]; done {
+				continue
+			}
+			r.rebaseOne(ctx, pr)
+		}
+	}
+}
+
+// Rebases pr on top of its ancestor, that has already been rebased.
+// Conflicts are not resolved: the rebase is aborted and the PR reported.
+func (r *rebaseAll) rebaseOne(ctx context.Context, pr *core.LocalPr) {
+	if _, err := r.Repo.GetLocalTip(pr); errors.Is(err, core.ErrReferenceNotFound) {
+		if _, err := r.Repo.CleanupAfterMerge(ctx, pr); err != nil {
+			r.conflict(pr, err.Error())
+			return
+		}
+		r.outcomes[pr.PrNumber] = merged
+		r.Merged = append(r.Merged, pr)
+		return
+	}
+	// The ancestor may have been merged and cleaned.
+	pr.ReloadState()
+	ancestor, err := pr.GetAncestor()
+	if err != nil {
+		ancestor = r.Repo.BaseBranch()
+	}
+	if ancestorPr, ok := ancestor.(*core.LocalPr); ok && r.outcomes[ancestorPr.PrNumber] == conflicted {
+		r.conflict(pr, fmt.Sprintf("depends on %s", ancestorPr.LocalBranch()))
+		return
+	}
+	fmt.Printf("Rebasing %s on %s... ", pr.LocalBranch(), ancestor.LocalName())
+	if err := r.Repo.Checkout(ctx, pr); err != nil {
+		PrintFailure(err)
+		r.conflict(pr, fmt.Sprintf("could not be checked out: %s", err))
+		return
+	}
+	if !r.Repo.TryRebaseBranchOnto(ctx, r.parents[pr.PrNumber], ancestor) {
+		PrintFailure(nil)
+		r.conflict(pr, fmt.Sprintf("conflicts with %s", ancestor.LocalName()))
+		return
+	}
+	PrintSuccess()
+	pr.RememberCurrentTip()
+	if !ancestor.IsPr() {
+		remoteBaseBranchTip := core.Must(r.Repo.GetRemoteTip(r.Repo.BaseBranch()))
+		localPrTip := core.Must(r.Repo.GetLocalTip(pr))
+		if r.Repo.IsAncestor(ctx, localPrTip, remoteBaseBranchTip) {
+			// The PR is now part of the history of the base branch.
+			if _, err := r.Repo.CleanupAfterMerge(ctx, pr); err != nil {
+				r.conflict(pr, err.Error())
+				return
+			}
+			r.outcomes[pr.PrNumber] = merged
+			r.Merged = append(r.Merged, pr)
+			return
+		}
+	}
+	r.outcomes[pr.PrNumber] = rebased
+	r.Rebased = append(r.Rebased, pr)
+}
+
+func (r *rebaseAll) conflict(pr *core.LocalPr, reason string) {
+	r.outcomes[pr.PrNumber] = conflicted
+	r.reasons[pr.PrNumber] = reason
+	r.Conflicts = append(r.Conflicts, pr)
+}
+
+func (r *rebaseAll) PrintSummary() {
+	names := func(prs []*core.LocalPr) string {
+		var result []string
+		for _, pr := range prs {
+			result = append(result, pr.LocalBranch())
+		}
+		return strings.Join(result, ", ")
+	}
+	fmt.Println()
+	if len(r.Rebased) > 0 {
+		fmt.Printf("Rebased: %s\n", names(r.Rebased))
+	}
+	if len(r.Merged) > 0 {
+		fmt.Printf("Merged and cleaned: %s\n", names(r.Merged))
+	}
+	if len(r.Conflicts) > 0 {
+		fmt.Println("Needs manual rebase:")
+		for _, pr := range r.Conflicts {
+			fmt.Printf("  %s (%s)\n", pr.LocalBranch(), r.reasons[pr.PrNumber])
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/cupcicm/opp/cmd"
 	"github.com/cupcicm/opp/core"
 	"github.com/cupcicm/opp/core/tests"
 	"github.com/go-git/go-git/v5"
@@ -25,8 +26,10 @@ func TestRebaseCleansDependentBranches(t *testing.T) {
 	assert.Nil(t, r.Push(context.Background(), tip, "master"))
 
 	r.Checkout(context.Background(), pr3)
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
 
 	assert.Nil(t, r.Run("rebase"))
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
 
 	_, err := r.Repo.GetRefHash(context.Background(), "refs/heads/"+pr2.LocalBranch())
 	assert.ErrorIs(t, err, core.ErrReferenceNotFound)
@@ -38,6 +41,27 @@ func TestRebaseCleansDependentBranches(t *testing.T) {
 	assert.Equal(t, "master", core.Must(pr3.GetAncestor()).LocalName())
 }
 
+func TestRebaseReparentsOnDeletedAncestor(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	ctx := context.Background()
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+
+	// PR 2 gets merged into master, and its local branch deleted by hand.
+	assert.Nil(t, r.Push(ctx, core.Must(r.GetLocalTip(pr2)), "master"))
+	r.Checkout(ctx, pr3)
+	assert.NoError(t, r.GitExec(ctx, "branch -D %s", pr2.LocalBranch()).Run())
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
+
+	assert.Nil(t, r.Run("rebase"))
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+
+	assert.Equal(t, "master", core.Must(core.NewLocalPr(r.Repo, 3).GetAncestor()).LocalName())
+	_, err := core.LoadLocalPr(r.Repo, 2)
+	assert.Error(t, err)
+}
+
 func TestRebaseFindsPreviousTips(t *testing.T) {
 	r := tests.NewTestRepo(t)
 
@@ -124,3 +148,149 @@ func TestRebaseFindsTipWhenMerged(t *testing.T) {
 		assert.Equal(t, expectedCommitMessages[i], strings.TrimSpace(c.Message))
 	}
 }
+
+func TestRebaseAll(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^^^", 2)
+	pr3 := r.CreatePr(t, "HEAD^^", 3)
+	pr4 := r.CreatePr(t, "HEAD", 4, "--base", "2")
+
+	// PR 2 gets merged into master, and the user is on another branch.
+	tip := core.Must(r.GetLocalTip(pr2))
+	assert.Nil(t, r.Push(context.Background(), tip, "master"))
+	r.Repo.GitExec(context.Background(), "checkout -b other %s", tip).Run()
+	r.GithubMock.PullRequestsMock.CallEditBase(3, "master")
+	r.GithubMock.PullRequestsMock.CallEditBase(4, "master")
+
+	assert.Nil(t, r.Run("rebase", "--all"))
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+
+	_, err := r.Repo.GetRefHash(context.Background(), "refs/heads/"+pr2.LocalBranch())
+	assert.ErrorIs(t, err, core.ErrReferenceNotFound)
+	for _, pr := range []*core.LocalPr{pr3, pr4} {
+		pr = core.NewLocalPr(r.Repo, pr.PrNumber)
+		assert.Equal(t, "master", core.Must(pr.GetAncestor()).LocalName())
+		assert.True(t, r.IsAncestor(context.Background(), tip, core.Must(r.GetLocalTip(pr))))
+	}
+	assert.Equal(t, "other", core.Must(r.GetCurrentBranchName(context.Background())))
+}
+
+func TestRebaseAllReportsConflicts(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^^", 2)
+	pr3 := r.CreatePr(t, "HEAD^", 3)
+	pr4 := r.CreatePr(t, "HEAD", 4)
+
+	// The new version of pr/2 modifies file 3, that pr/3 also modifies.
+	r.Checkout(context.Background(), pr2)
+	os.WriteFile(path.Join(r.Path(), "3"), []byte("conflicts with 3"), 0644)
+	core.Must(r.Source.Worktree()).Add("3")
+	r.Commit("conflicts with 3")
+	r.Checkout(context.Background(), pr4)
+	pr4Tip := core.Must(r.GetLocalTip(pr4))
+
+	assert.Error(t, r.Run("rebase", "--all"))
+
+	assert.NoDirExists(t, path.Join(r.Path(), ".git", "rebase-merge"))
+	assert.Equal(t, pr4Tip, core.Must(r.GetLocalTip(pr4)))
+	assert.False(t, r.IsAncestor(context.Background(), core.Must(r.GetLocalTip(pr2)), core.Must(r.GetLocalTip(pr3))))
+	assert.Equal(t, pr4.LocalBranch(), core.Must(r.GetCurrentBranchName(context.Background())))
+}
+
+// Creates the chain pr/2 <- pr/3 <- pr/4, then amends pr/2 so that
+// rebasing pr/3 on it conflicts, and runs opp rebase from pr/4.
+func interruptedRebase(t *testing.T) *tests.TestRepo {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^^", 2)
+	r.CreatePr(t, "HEAD^", 3)
+	pr4 := r.CreatePr(t, "HEAD", 4)
+
+	r.Checkout(context.Background(), pr2)
+	os.WriteFile(path.Join(r.Path(), "3"), []byte("conflicts with 3"), 0644)
+	core.Must(r.Source.Worktree()).Add("3")
+	r.RewriteLastCommit("conflicts with 3")
+	assert.NoError(t, r.Run("push"))
+	r.Checkout(context.Background(), pr4)
+
+	assert.ErrorIs(t, r.Run("rebase"), cmd.ErrRebaseInterrupted)
+	op := core.Must(r.StateStore().GetRebaseOperation())
+	assert.Equal(t, []int{2, 3, 4}, op.Chain)
+	assert.Equal(t, []int{2}, op.Done)
+	assert.Equal(t, 3, op.Pending)
+	return r
+}
+
+func TestRebaseContinue(t *testing.T) {
+	r := interruptedRebase(t)
+
+	// Another rebase cannot start before this one is finished.
+	assert.Error(t, r.Run("rebase"))
+
+	// The user resolves the conflict by hand.
+	r.GitExec(context.Background(), "rebase --abort").Run()
+	r.GitExec(context.Background(), "reset --hard pr/2").Run()
+	os.WriteFile(path.Join(r.Path(), "3"), []byte("resolved"), 0644)
+	core.Must(r.Source.Worktree()).Add("3")
+	r.Commit("3")
+
+	assert.NoError(t, r.Run("rebase", "--continue"))
+
+	assert.Nil(t, core.Must(r.StateStore().GetRebaseOperation()))
+	assert.Equal(t, "pr/4", core.Must(r.GetCurrentBranchName(context.Background())))
+	commits := core.Must(r.Source.Log(&git.LogOptions{}))
+	for _, expected := range []string{"4", "3", "conflicts with 3", "1", "0"} {
+		c := core.Must(commits.Next())
+		assert.Equal(t, expected, strings.TrimSpace(c.Message))
+	}
+}
+
+func TestRebaseAbort(t *testing.T) {
+	r := interruptedRebase(t)
+	pr3 := core.NewLocalPr(r.Repo, 3)
+	op := core.Must(r.StateStore().GetRebaseOperation())
+
+	assert.NoError(t, r.Run("rebase", "--abort"))
+
+	assert.False(t, r.RebaseInProgress(context.Background()))
+	assert.Nil(t, core.Must(r.StateStore().GetRebaseOperation()))
+	assert.Equal(t, op.OriginalTips[3], core.Must(r.GetLocalTip(pr3)))
+	assert.Equal(t, "pr/4", core.Must(r.GetCurrentBranchName(context.Background())))
+	assert.Error(t, r.Run("rebase", "--continue"))
+}
+
+func TestRebaseChainInOnePass(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.CreatePr(t, "HEAD^^", 2)
+	r.CreatePr(t, "HEAD^", 3)
+	pr4 := r.CreatePr(t, "HEAD", 4)
+
+	// Someone else pushes to master.
+	r.GitExec(context.Background(), "checkout -b upstream origin/master").Run()
+	os.WriteFile(path.Join(r.Path(), "9"), []byte("upstream"), 0644)
+	core.Must(r.Source.Worktree()).Add("9")
+	upstream := r.Commit("upstream")
+	assert.NoError(t, r.Push(context.Background(), upstream.String(), "master"))
+	r.Checkout(context.Background(), pr4)
+	r.GitExec(context.Background(), "branch -D upstream").Run()
+	master := core.Must(r.GetLocalTip(r.BaseBranch()))
+
+	assert.NoError(t, r.Run("rebase"))
+
+	for _, number := range []int{2, 3, 4} {
+		pr := core.NewLocalPr(r.Repo, number)
+		tip := core.Must(r.GetLocalTip(pr))
+		assert.True(t, r.IsAncestor(context.Background(), upstream.String(), tip))
+		if number > 2 {
+			assert.Contains(t, pr.AncestorTips(), core.Must(r.GetLocalTip(core.Must(pr.GetAncestor()))))
+		}
+	}
+	// pr/2 and pr/3 have been moved by git itself, not rebased one by one.
+	reflog := string(core.Must(r.GitExec(context.Background(), "reflog show -1 pr/3").Output()))
+	assert.Contains(t, reflog, "rewritten during rebase")
+	// The local master branch points to the old tip of pr/4, but must not move.
+	assert.Equal(t, master, core.Must(r.GetLocalTip(r.BaseBranch())))
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/google/go-github/v56/github"
+)
+
+// Replaces "me" by the github login of the user.
+func assignees(raw []string) []string {
+	result := make([]string, 0, len(raw))
+	for _, assignee := range raw {
+		if assignee == "me" {
+			assignee = core.GetGithubUsername()
+		}
+		if !slices.Contains(result, assignee) {
+			result = append(result, assignee)
+		}
+	}
+	return result
+}
+
+// requestReviews requests reviews and adds assignees on a freshly created PR.
+// Failures are printed but do not fail the creation of the PR. Only done on github.
+func (c *create) requestReviews(ctx context.Context, pr *core.LocalPr, args *args) {
+	if !core.IsGithubForge() {
+		if len(args.Reviewers) > 0 || len(args.Assignees) > 0 || args.Codeowners {
+			fmt.Println(core.ErrOnlyOnGithub("requesting reviews"))
+		}
+		return
+	}
+	reviewers := slices.Clone(args.Reviewers)
+	if args.Codeowners {
+		owners, err := c.codeowners(ctx, args.Commits)
+		if err != nil {
+			fmt.Printf("Could not find the code owners of %s: %s\n", pr.LocalBranch(), err)
+		}
+		reviewers = append(reviewers, owners...)
+	}
+	ctx, cancel := context.WithTimeoutCause(
+		ctx, core.GetGithubTimeout(),
+		fmt.Errorf("requesting reviews too slow, increase github.timeout"),
+	)
+	defer cancel()
+	request := reviewersRequest(reviewers)
+	if len(request.Reviewers) > 0 || len(request.TeamReviewers) > 0 {
+		fmt.Printf("Requesting reviews from %s... ", strings.Join(append(slices.Clone(request.Reviewers), request.TeamReviewers...), ", "))
+		_, _, err := c.Github.PullRequests().RequestReviewers(
+			ctx, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber, request,
+		)
+		if err != nil {
+			PrintFailure(err)
+		} else {
+			PrintSuccess()
+		}
+	}
+	if len(args.Assignees) > 0 {
+		fmt.Printf("Assigning %s... ", strings.Join(args.Assignees, ", "))
+		_, _, err := c.Github.Issues().AddAssignees(
+			ctx, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber, args.Assignees,
+		)
+		if err != nil {
+			PrintFailure(err)
+		} else {
+			PrintSuccess()
+		}
+	}
+}
+
+// Splits reviewers between users and teams (org/team), without duplicates.
+// The author of the PR cannot review it, so they are left out.
+func reviewersRequest(reviewers []string) github.ReviewersRequest {
+	request := github.ReviewersRequest{}
+	for _, reviewer := range reviewers {
+		reviewer = strings.TrimPrefix(reviewer, "@")
+		if _, team, isTeam := strings.Cut(reviewer, "/"); isTeam {
+			if !slices.Contains(request.TeamReviewers, team) {
+				request.TeamReviewers = append(request.TeamReviewers, team)
+			}
+			continue
+		}
+		if reviewer == "" || strings.EqualFold(reviewer, core.GetGithubUsername()) {
+			continue
+		}
+		if !slices.Contains(request.Reviewers, reviewer) {
+			request.Reviewers = append(request.Reviewers, reviewer)
+		}
+	}
+	return request
+}
+
+// Returns the owners of the files modified by the commits, in the order they appear.
+// Owners that are not github users or teams (emails) are skipped.
+func (c *create) codeowners(ctx context.Context, commits []core.Commit) ([]string, error) {
+	codeowners, err := c.Repo.LoadCodeowners()
+	if err != nil || codeowners == nil {
+		return nil, err
+	}
+	// The first commit is the child-most one.
+	files, err := c.Repo.ChangedFiles(ctx, commits[len(commits)-1].Hash, commits[0].Hash)
+	if err != nil {
+		return nil, err
+	}
+	var owners []string
+	for _, file := range files {
+		for _, owner := range codeowners.Owners(file) {
+			if strings.HasPrefix(owner, "@") && !slices.Contains(owners, owner) {
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners, nil
+}
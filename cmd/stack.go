@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/google/go-github/v56/github"
+)
+
+const (
+	stackStart = "<!-- opp:stack -->"
+	stackEnd   = "<!-- /opp:stack -->"
+)
+
+// stack maintains, in the description of the PRs of a chain, a block listing
+// all the PRs of the chain.
+type stack struct {
+	Repo         *core.Repo
+	PullRequests core.GhPullRequest
+}
+
+type stackLookup struct {
+	pr  *github.PullRequest
+	err error
+}
+
+// Update rewrites the stack block of all the PRs in the same chains as prs.
+// PRs that are not part of a chain anymore lose their block.
+// Failures are printed but do not fail the command. Only done on github.
+func (s *stack) Update(ctx context.Context, prs ...*core.LocalPr) {
+	if !core.PrStackEnabled() || !core.IsGithubForge() || len(prs) == 0 {
+		return
+	}
+	all := s.Repo.AllPrs(ctx)
+	parents := make(map[int]int, len(all))
+	for _, pr := range all {
+		parents[pr.PrNumber] = 0
+		if ancestor, err := pr.GetAncestor(); err == nil && ancestor.IsPr() {
+			parents[pr.PrNumber] = ancestor.(*core.LocalPr).PrNumber
+		}
+	}
+	root := func(number int) int {
+		for parents[number] != 0 {
+			number = parents[number]
+		}
+		return number
+	}
+	roots := make(map[int]bool)
+	for _, pr := range prs {
+		if _, exists := parents[pr.PrNumber]; exists {
+			roots[root(pr.PrNumber)] = true
+		}
+	}
+	var members []int
+	for number := range parents {
+		if roots[root(number)] {
+			members = append(members, number)
+		}
+	}
+	slices.Sort(members)
+
+	ctx, cancel := context.WithTimeoutCause(
+		ctx, core.GetGithubTimeout(),
+		fmt.Errorf("updating the stack of PRs too slow, increase github.timeout"),
+	)
+	defer cancel()
+	lookups, err := core.ParallelMap(ctx, members, core.GetGithubConcurrency(), func(ctx context.Context, number int) stackLookup {
+		pr, _, err := s.PullRequests.Get(ctx, core.GetGithubOwner(), core.GetGithubRepoName(), number)
+		return stackLookup{pr: pr, err: err}
+	})
+	if err != nil {
+		fmt.Printf("Could not update the stack of PRs: %s\n", err)
+		return
+	}
+	for _, number := range members {
+		lookup := lookups[number]
+		if lookup.err != nil {
+			fmt.Printf("Could not update the stack of %s: %s\n", core.LocalBranchForPr(number), lookup.err)
+			continue
+		}
+		body := lookup.pr.GetBody()
+		newBody := removeStackBlock(body)
+		if chain := stackOf(number, parents); len(chain) > 1 {
+			newBody = setStackBlock(body, renderStack(number, chain, lookups))
+		}
+		if newBody == body {
+			continue
+		}
+		fmt.Printf("Updating the stack of %s... ", core.LocalBranchForPr(number))
+		_, _, err := s.PullRequests.Edit(
+			ctx, core.GetGithubOwner(), core.GetGithubRepoName(), number,
+			&github.PullRequest{Body: &newBody},
+		)
+		if err != nil {
+			PrintFailure(err)
+			continue
+		}
+		PrintSuccess()
+	}
+}
+
+// Returns the ancestors of the PR, the PR and its descendants, in chain order.
+func stackOf(number int, parents map[int]int) []int {
+	var ancestors []int
+	for parent := parents[number]; parent != 0; parent = parents[parent] {
+		ancestors = append(ancestors, parent)
+	}
+	slices.Reverse(ancestors)
+	return append(append(ancestors, number), descendantsOf(number, parents)...)
+}
+
+func descendantsOf(number int, parents map[int]int) []int {
+	var children []int
+	for child, parent := range parents {
+		if parent == number {
+			children = append(children, child)
+		}
+	}
+	slices.Sort(children)
+	var descendants []int
+	for _, child := range children {
+		descendants = append(descendants, child)
+		descendants = append(descendants, descendantsOf(child, parents)...)
+	}
+	return descendants
+}
+
+func renderStack(current int, chain []int, lookups map[int]stackLookup) string {
+	lines := []string{stackStart, "**Stack of PRs**", ""}
+	for _, number := range chain {
+		line := fmt.Sprintf("- #%d", number)
+		if lookup := lookups[number]; lookup.err == nil && lookup.pr != nil {
+			line = fmt.Sprintf("%s %s", line, lookup.pr.GetTitle())
+		}
+		if number == current {
+			line += " 👈"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(append(lines, stackEnd), "\n")
+}
+
+// Replaces the stack block of the body, or adds it at the end when there is none.
+func setStackBlock(body, block string) string {
+	before, rest, found := strings.Cut(body, stackStart)
+	if found {
+		if _, after, found := strings.Cut(rest, stackEnd); found {
+			return before + block + after
+		}
+	}
+	if strings.TrimSpace(body) == "" {
+		return block
+	}
+	return strings.TrimRight(body, "\n") + "\n\n" + block
+}
+
+func removeStackBlock(body string) string {
+	before, rest, found := strings.Cut(body, stackStart)
+	if !found {
+		return body
+	}
+	_, after, found := strings.Cut(rest, stackEnd)
+	if !found {
+		return body
+	}
+	return strings.TrimSpace(strings.TrimRight(before, "\n") + after)
+}
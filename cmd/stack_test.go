@@ -0,0 +1,63 @@
+package cmd_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cupcicm/opp/core/tests"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func stackBlock(lines ...string) string {
+	return strings.Join(append(append([]string{"<!-- opp:stack -->", "**Stack of PRs**", ""}, lines...), "<!-- /opp:stack -->"), "\n")
+}
+
+func TestStackIsAddedToChainedPrs(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	viper.Set("pr.stack", true)
+
+	// A PR alone is not part of a stack.
+	r.GithubMock.PullRequestsMock.CallGetAndReturnBody(2, "Two", "Body 2")
+	r.CreatePr(t, "HEAD^", 2)
+	r.GithubMock.PullRequestsMock.AssertNotCalled(t, "Edit", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnBody(2, "Two", "Body 2")
+	r.GithubMock.PullRequestsMock.CallGetAndReturnBody(3, "Three", "")
+	r.GithubMock.PullRequestsMock.CallEditBody(2, "Body 2\n\n"+stackBlock("- #2 Two 👈", "- #3 Three"))
+	r.GithubMock.PullRequestsMock.CallEditBody(3, stackBlock("- #2 Two", "- #3 Three 👈"))
+	r.CreatePr(t, "HEAD", 3)
+
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+}
+
+func TestStackIsReplacedInPlaceOnPush(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	r.CreatePr(t, "HEAD^", 2)
+	pr3 := r.CreatePr(t, "HEAD", 3)
+	viper.Set("pr.stack", true)
+	r.Repo.Checkout(context.Background(), pr3)
+
+	outdated := "Before\n\n" + stackBlock("- #1 Merged", "- #2 Two", "- #3 Three 👈") + "\n\nAfter"
+	r.GithubMock.PullRequestsMock.CallGetAndReturnBody(2, "Two", "Before\n\n"+stackBlock("- #2 Two 👈", "- #3 Three"))
+	r.GithubMock.PullRequestsMock.CallGetAndReturnBody(3, "Three", outdated)
+	r.GithubMock.PullRequestsMock.CallEditBody(3, "Before\n\n"+stackBlock("- #2 Two", "- #3 Three 👈")+"\n\nAfter")
+	assert.NoError(t, r.Run("push"))
+
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+}
+
+func TestStackIsRemovedAfterMerge(t *testing.T) {
+	r := tests.NewTestRepo(t)
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	r.CreatePr(t, "HEAD", 3)
+	viper.Set("pr.stack", true)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnBody(3, "Three", "Body 3\n\n"+stackBlock("- #2 Two", "- #3 Three 👈"))
+	r.GithubMock.PullRequestsMock.CallEditBody(3, "Body 3")
+	assert.NoError(t, r.MergePr(t, pr2))
+
+	r.GithubMock.PullRequestsMock.AssertExpectations(t)
+}
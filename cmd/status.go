@@ -2,57 +2,120 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
+	"text/template"
 
 	"github.com/cupcicm/opp/core"
+	"github.com/google/go-github/v56/github"
 	"github.com/urfave/cli/v3"
 	"golang.org/x/exp/slices"
 )
 
+var FormatFlagUsage = strings.TrimSpace(`
+Print each PR using the given go template, e.g. --format '{{.Number}} {{.UpToDate}}'.
+See --json for the available fields.
+`)
+
 type status struct {
-	Out          io.Writer
-	Repo         *core.Repo
-	PullRequests core.GhPullRequest
+	Out           io.Writer
+	Repo          *core.Repo
+	Forge         core.Forge
+	PullRequests  core.GhPullRequest
+	ReviewThreads core.GhReviewThreads
+	// Looking up the reviews costs three more github calls per PR,
+	// so it is skipped when the output does not show them.
+	Reviews bool
+}
+
+// The PrStatus fields that are filled by addReviews.
+var reviewFields = []string{"ReviewDecision", "Approvals", "ChangesRequestedBy", "PendingReviewers", "UnresolvedThreads"}
+
+// PrStatus is what opp status knows about a local PR. It is shared by
+// the text, json and template outputs.
+type PrStatus struct {
+	Number    int    `json:"number"`
+	Url       string `json:"url"`
+	Title     string `json:"title"`
+	Ancestor  string `json:"ancestor"`
+	ChainRoot int    `json:"chain_root"`
+	LocalTip  string `json:"local_tip"`
+	RemoteTip string `json:"remote_tip"`
+	UpToDate  bool   `json:"up_to_date"`
+	Mergeable bool   `json:"mergeable"`
+	// The mergeable_state reported by github (clean, dirty, blocked...).
+	// The merge status of the other forges is mapped onto it.
+	MergeableState string `json:"mergeable_state"`
+	// Why the PR is not mergeable, empty when it is.
+	Reason string `json:"reason,omitempty"`
+	Draft  bool   `json:"draft"`
+	// Either approved, changes_requested, or empty when no reviewer decided yet.
+	ReviewDecision     string   `json:"review_decision"`
+	Approvals          int      `json:"approvals"`
+	ChangesRequestedBy []string `json:"changes_requested_by"`
+	// Users and teams whose review has been requested but who have not reviewed yet.
+	PendingReviewers  []string `json:"pending_reviewers"`
+	UnresolvedThreads int      `json:"unresolved_threads"`
+	AutoMerge         bool     `json:"auto_merge"`
 }
 
 func StatusCommand(out io.Writer, repo *core.Repo, gh func(context.Context) core.Gh) *cli.Command {
 	cmd := &cli.Command{
 		Name:    "status",
 		Aliases: []string{"s"},
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Print one json record per local PR.",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: FormatFlagUsage,
+			},
+		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			if cmd.NArg() > 0 {
 				return cli.Exit("too many arguments", 1)
 			}
-			status := status{Out: out, Repo: repo, PullRequests: gh(ctx).PullRequests()}
+			forge, err := core.NewForge(ctx, gh)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			client := gh(ctx)
+			status := status{
+				Out:           out,
+				Repo:          repo,
+				Forge:         forge,
+				PullRequests:  client.PullRequests(),
+				ReviewThreads: client.ReviewThreads(),
+				Reviews:       cmd.Bool("json") || needsReviews(cmd.String("format")),
+			}
 			repo.Fetch(ctx)
-			localPrs := repo.AllPrs(ctx)
-			alreadyMentioned := make(map[int]bool)
-			slices.SortFunc(localPrs, func(pr1 core.LocalPr, pr2 core.LocalPr) int {
-				if len(pr1.AllAncestors()) > len(pr2.AllAncestors()) {
-					return -1
-				}
-				return 1
-			})
-			for _, pr := range localPrs {
-				if _, ok := alreadyMentioned[pr.PrNumber]; ok {
-					continue
-				}
-				alreadyMentioned[pr.PrNumber] = true
-				ancestors := pr.AllAncestors()
-				if len(ancestors) >= 1 {
-					fmt.Fprintf(out, "PR chain #%d\n", ancestors[0].PrNumber)
-					for i, ancestor := range append(ancestors, &pr) {
-						alreadyMentioned[ancestor.PrNumber] = true
+			chains := status.Chains(ctx)
+			statuses, err := status.GetPrStatuses(ctx, chains)
+			if err != nil {
+				return err
+			}
+			switch {
+			case cmd.Bool("json"):
+				return status.PrintJson(status.Flatten(chains, statuses))
+			case cmd.String("format") != "":
+				return status.PrintTemplate(status.Flatten(chains, statuses), cmd.String("format"))
+			}
+			for _, chain := range chains {
+				if len(chain) > 1 {
+					fmt.Fprintf(out, "PR chain #%d\n", chain[0].PrNumber)
+					for i, pr := range chain {
 						fmt.Fprintf(out, "  %d. ", i+1)
-						status.PrintStatus(ctx, ancestor, 3)
+						status.PrintStatus(statuses[pr.PrNumber], 3)
 					}
-
 				} else {
-					fmt.Fprintf(out, "PR #%d. ", pr.PrNumber)
-					status.PrintStatus(ctx, &pr, 0)
+					fmt.Fprintf(out, "PR #%d. ", chain[0].PrNumber)
+					status.PrintStatus(statuses[chain[0].PrNumber], 0)
 				}
 			}
 			return nil
@@ -61,62 +124,289 @@ func StatusCommand(out io.Writer, repo *core.Repo, gh func(context.Context) core
 	return cmd
 }
 
-func (m *status) PrintStatus(ctx context.Context, pr *core.LocalPr, indent int) {
-	mergeable, err := m.isMergeable(ctx, pr)
-	isUpToDate := core.Must(m.isUpToDate(ctx, pr))
+// Chains groups the local PRs by chain, each chain starting with its root.
+// PRs that do not depend on other PRs and have no dependent PRs are a chain by themselves.
+func (s *status) Chains(ctx context.Context) [][]*core.LocalPr {
+	localPrs := s.Repo.AllPrs(ctx)
+	alreadyMentioned := make(map[int]bool)
+	slices.SortFunc(localPrs, func(pr1 core.LocalPr, pr2 core.LocalPr) int {
+		if len(pr1.AllAncestors()) > len(pr2.AllAncestors()) {
+			return -1
+		}
+		return 1
+	})
+	var chains [][]*core.LocalPr
+	for _, pr := range localPrs {
+		pr := pr
+		if _, ok := alreadyMentioned[pr.PrNumber]; ok {
+			continue
+		}
+		chain := append(pr.AllAncestors(), &pr)
+		for _, inChain := range chain {
+			alreadyMentioned[inChain.PrNumber] = true
+		}
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+// GetPrStatuses gets the status of every PR in the chains, running the github
+// lookups in parallel. A PR that belongs to several chains is looked up only once.
+func (s *status) GetPrStatuses(ctx context.Context, chains [][]*core.LocalPr) (map[int]PrStatus, error) {
+	prs := make(map[int]*core.LocalPr)
+	var numbers []int
+	for _, chain := range chains {
+		for _, pr := range chain {
+			prs[pr.PrNumber] = pr
+			numbers = append(numbers, pr.PrNumber)
+		}
+	}
+	return core.ParallelMap(ctx, numbers, core.GetGithubConcurrency(), func(ctx context.Context, number int) PrStatus {
+		return s.GetPrStatus(ctx, prs[number])
+	})
+}
+
+// Flatten returns the statuses in chain order. A PR that belongs
+// to several chains appears only once.
+func (s *status) Flatten(chains [][]*core.LocalPr, statuses map[int]PrStatus) []PrStatus {
+	seen := make(map[int]bool)
+	var flat []PrStatus
+	for _, chain := range chains {
+		for _, pr := range chain {
+			if seen[pr.PrNumber] {
+				continue
+			}
+			seen[pr.PrNumber] = true
+			flat = append(flat, statuses[pr.PrNumber])
+		}
+	}
+	return flat
+}
+
+func (s *status) GetPrStatus(ctx context.Context, pr *core.LocalPr) PrStatus {
+	root := pr
+	if ancestors := pr.AllAncestors(); len(ancestors) > 0 {
+		root = ancestors[0]
+	}
+	result := PrStatus{
+		Number:    pr.PrNumber,
+		Url:       pr.Url(),
+		ChainRoot: root.PrNumber,
+		AutoMerge: pr.AutoMerge(),
+	}
+	if ancestor, err := pr.GetAncestor(); err == nil {
+		result.Ancestor = ancestor.LocalName()
+	}
+	result.LocalTip, _ = s.Repo.GetLocalTip(pr)
+	result.RemoteTip, _ = s.Repo.GetRemoteTip(pr)
+	result.UpToDate = result.LocalTip != "" && result.LocalTip == result.RemoteTip
+
+	forgePr, err := s.Forge.GetPr(ctx, pr.PrNumber)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	result.Title = forgePr.Title
+	result.Draft = forgePr.Draft
+	result.MergeableState = string(forgePr.Mergeability)
+	result.Mergeable, err = s.isMergeable(forgePr)
+	if err != nil {
+		result.Reason = err.Error()
+	}
+	if s.Reviews && core.IsGithubForge() {
+		s.addReviews(ctx, pr, &result)
+	}
+	return result
+}
+
+func (s *status) PrintStatus(prStatus PrStatus, indent int) {
 	var mergeableString string
 	var isUpToDateString string
-	fmt.Fprintln(m.Out, pr.Url())
-	if mergeable {
+	fmt.Fprintln(s.Out, prStatus.Url)
+	if prStatus.Mergeable {
 		mergeableString = "✅"
 	} else {
-		mergeableString = fmt.Sprintf("❌ - %s", err)
+		mergeableString = fmt.Sprintf("❌ - %s", prStatus.Reason)
 	}
-	if isUpToDate {
+	if prStatus.UpToDate {
 		isUpToDateString = "✅"
 	} else {
 		isUpToDateString = "❌"
 	}
-	fmt.Fprintf(m.Out, "%smergeable  %s\n", strings.Repeat(" ", indent+2), mergeableString)
-	fmt.Fprintf(m.Out, "%sup-to-date %s\n", strings.Repeat(" ", indent+2), isUpToDateString)
+	fmt.Fprintf(s.Out, "%smergeable  %s\n", strings.Repeat(" ", indent+2), mergeableString)
+	fmt.Fprintf(s.Out, "%sup-to-date %s\n", strings.Repeat(" ", indent+2), isUpToDateString)
+	if core.IsGithubForge() {
+		// The reviews are only looked up on github.
+		fmt.Fprintf(s.Out, "%sreviews    %s\n", strings.Repeat(" ", indent+2), reviewsString(prStatus))
+	}
+	if prStatus.AutoMerge {
+		autoMergeString := "✅"
+		if _, err := core.ExtractPrNumber(prStatus.Ancestor); err == nil {
+			autoMergeString = fmt.Sprintf("⏳ - waiting for %s", prStatus.Ancestor)
+		}
+		fmt.Fprintf(s.Out, "%sauto-merge %s\n", strings.Repeat(" ", indent+2), autoMergeString)
+	}
 }
 
-// Is this PR, separately from its ancestor, mergeable in itself ?
-func (s *status) isMergeable(ctx context.Context, pr *core.LocalPr) (bool, error) {
-	githubPr, _, err := s.PullRequests.Get(ctx, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber)
+func (s *status) PrintJson(statuses []PrStatus) error {
+	encoder := json.NewEncoder(s.Out)
+	for _, prStatus := range statuses {
+		if err := encoder.Encode(prStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *status) PrintTemplate(statuses []PrStatus, format string) error {
+	tmpl, err := template.New("status").Parse(format)
 	if err != nil {
-		return false, err
+		return cli.Exit(fmt.Errorf("invalid --format: %w", err), 1)
 	}
-	if githubPr.Merged != nil && *githubPr.Merged {
-		return false, errors.New("already merged")
+	for _, prStatus := range statuses {
+		if err := tmpl.Execute(s.Out, prStatus); err != nil {
+			return err
+		}
+		fmt.Fprintln(s.Out)
 	}
-	if githubPr.Mergeable == nil {
-		return false, errors.New("still being checked by github")
+	return nil
+}
+
+// Is this PR, separately from its ancestor, mergeable in itself ?
+func (s *status) isMergeable(forgePr *core.Pr) (bool, error) {
+	if forgePr.Merged {
+		return false, errors.New("already merged")
 	}
-	switch *githubPr.MergeableState {
-	case "dirty":
+	switch forgePr.Mergeability {
+	case core.MergeabilityPending:
+		return false, fmt.Errorf("still being checked by %s", core.GetForgeType())
+	case core.MergeabilityConflicting:
 		return false, fmt.Errorf("cannot be merged cleanly into %s", s.Repo.BaseBranch().RemoteName())
-	case "blocked":
+	case core.MergeabilityBlocked:
 		return false, errors.New("not authorized to merge")
-	case "unstable":
+	case core.MergeabilityUnstable:
 		return false, errors.New("has some failing or pending checks")
-	case "draft":
+	case core.MergeabilityDraft:
 		return false, errors.New("draft PR")
-	case "clean":
+	case core.MergeabilityClean:
 		return true, nil
 	default:
 		return false, errors.New("not mergeable")
 	}
 }
 
-func (s *status) isUpToDate(ctx context.Context, pr *core.LocalPr) (bool, error) {
-	remote, err := s.Repo.GetRemoteTip(pr)
+// The text and json outputs always show the reviews, a template
+// only when it uses one of the review fields.
+func needsReviews(format string) bool {
+	if format == "" {
+		return true
+	}
+	for _, field := range reviewFields {
+		if strings.Contains(format, "."+field) {
+			return true
+		}
+	}
+	return false
+}
+
+// Like github, only the last review of each reviewer counts, and a single
+// reviewer requesting changes is enough to block the PR.
+// What cannot be looked up is reported on stderr, the rest is still shown.
+func (s *status) addReviews(ctx context.Context, pr *core.LocalPr, result *PrStatus) {
+	reviews, err := s.listReviews(ctx, pr.PrNumber)
 	if err != nil {
-		return false, err
+		fmt.Fprintf(os.Stderr, "warning: could not get the reviews of %s: %s\n", pr.LocalBranch(), err)
+	}
+	latest := make(map[string]string)
+	var reviewers []string
+	for _, review := range reviews {
+		switch review.GetState() {
+		case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+			login := review.GetUser().GetLogin()
+			if _, ok := latest[login]; !ok {
+				reviewers = append(reviewers, login)
+			}
+			latest[login] = review.GetState()
+		}
 	}
-	local, err := s.Repo.GetLocalTip(pr)
+	for _, login := range reviewers {
+		switch latest[login] {
+		case "APPROVED":
+			result.Approvals++
+		case "CHANGES_REQUESTED":
+			result.ChangesRequestedBy = append(result.ChangesRequestedBy, login)
+		}
+	}
+	if len(result.ChangesRequestedBy) > 0 {
+		result.ReviewDecision = "changes_requested"
+	} else if result.Approvals > 0 {
+		result.ReviewDecision = "approved"
+	}
+	result.PendingReviewers, err = s.listPendingReviewers(ctx, pr.PrNumber)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not get the requested reviewers of %s: %s\n", pr.LocalBranch(), err)
+	}
+	result.UnresolvedThreads, err = s.ReviewThreads.CountUnresolved(ctx, core.GetGithubOwner(), core.GetGithubRepoName(), pr.PrNumber)
 	if err != nil {
-		return false, err
+		fmt.Fprintf(os.Stderr, "warning: could not count the unresolved threads of %s: %s\n", pr.LocalBranch(), err)
+	}
+}
+
+func (s *status) listReviews(ctx context.Context, number int) ([]*github.PullRequestReview, error) {
+	var reviews []*github.PullRequestReview
+	options := &github.ListOptions{PerPage: 100}
+	for {
+		page, response, err := s.PullRequests.ListReviews(ctx, core.GetGithubOwner(), core.GetGithubRepoName(), number, options)
+		if err != nil {
+			return reviews, err
+		}
+		reviews = append(reviews, page...)
+		if response == nil || response.NextPage == 0 {
+			return reviews, nil
+		}
+		options.Page = response.NextPage
+	}
+}
+
+// The users and teams (as org/slug) whose review has been requested.
+func (s *status) listPendingReviewers(ctx context.Context, number int) ([]string, error) {
+	owner := core.GetGithubOwner()
+	var pending []string
+	options := &github.ListOptions{PerPage: 100}
+	for {
+		requested, response, err := s.PullRequests.ListReviewers(ctx, owner, core.GetGithubRepoName(), number, options)
+		if err != nil {
+			return pending, err
+		}
+		for _, user := range requested.Users {
+			pending = append(pending, user.GetLogin())
+		}
+		for _, team := range requested.Teams {
+			pending = append(pending, fmt.Sprintf("%s/%s", owner, team.GetSlug()))
+		}
+		if response == nil || response.NextPage == 0 {
+			return pending, nil
+		}
+		options.Page = response.NextPage
+	}
+}
+
+func reviewsString(prStatus PrStatus) string {
+	emoji := "⏳"
+	if len(prStatus.ChangesRequestedBy) > 0 {
+		emoji = "❌"
+	} else if prStatus.Approvals > 0 && prStatus.UnresolvedThreads == 0 {
+		emoji = "✅"
+	}
+	parts := []string{fmt.Sprintf("%d approval(s)", prStatus.Approvals)}
+	if len(prStatus.ChangesRequestedBy) > 0 {
+		parts = append(parts, fmt.Sprintf("changes requested by %s", strings.Join(prStatus.ChangesRequestedBy, ", ")))
+	}
+	if len(prStatus.PendingReviewers) > 0 {
+		parts = append(parts, fmt.Sprintf("waiting for %s", strings.Join(prStatus.PendingReviewers, ", ")))
+	}
+	if prStatus.UnresolvedThreads > 0 {
+		parts = append(parts, fmt.Sprintf("%d unresolved thread(s)", prStatus.UnresolvedThreads))
 	}
-	return local == remote, nil
+	return fmt.Sprintf("%s - %s", emoji, strings.Join(parts, ", "))
 }
@@ -2,9 +2,11 @@ package cmd_test
 
 import (
 	"context"
+	"encoding/json"
 	"strings"
 	"testing"
 
+	"github.com/cupcicm/opp/cmd"
 	"github.com/cupcicm/opp/core"
 	"github.com/cupcicm/opp/core/tests"
 	"github.com/stretchr/testify/assert"
@@ -22,10 +24,10 @@ func TestStatus(t *testing.T) {
 	pr3Ref := "refs/heads/" + core.LocalBranchForPr(3)
 	r.Repo.GitExec(context.Background(), "symbolic-ref %s %s", pr4Ref, pr3Ref).Run()
 
-	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
-	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(3, false)
-	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(4, true)
-	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(5, false)
+	r.GithubMock.CallStatus(2, true)
+	r.GithubMock.CallStatus(3, false)
+	r.GithubMock.CallStatus(4, true)
+	r.GithubMock.CallStatus(5, false)
 
 	assert.Nil(t, r.Run("status"))
 	assert.Equal(t, strings.TrimSpace(`
@@ -33,13 +35,139 @@ func TestStatus(t *testing.T) {
   1. https://github.com/cupcicm/opp/pull/2
      mergeable  ✅
      up-to-date ✅
+     reviews    ⏳ - 0 approval(s)
   2. https://github.com/cupcicm/opp/pull/3
      mergeable  ❌ - cannot be merged cleanly into master
      up-to-date ✅
+     reviews    ⏳ - 0 approval(s)
   3. https://github.com/cupcicm/opp/pull/4
      mergeable  ✅
      up-to-date ❌
+     reviews    ⏳ - 0 approval(s)
   4. https://github.com/cupcicm/opp/pull/5
      mergeable  ❌ - cannot be merged cleanly into master
-     up-to-date ✅`), strings.TrimSpace(r.Out.String()))
+     up-to-date ✅
+     reviews    ⏳ - 0 approval(s)`), strings.TrimSpace(r.Out.String()))
+}
+
+func TestStatusJson(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	pr2 := r.CreatePr(t, "HEAD^", 2)
+	r.CreatePr(t, "HEAD", 3)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(3, false)
+	r.GithubMock.PullRequestsMock.CallListReviews(2, [2]string{"alice", "CHANGES_REQUESTED"}, [2]string{"alice", "APPROVED"})
+	r.GithubMock.PullRequestsMock.CallListReviews(3, [2]string{"alice", "APPROVED"}, [2]string{"bob", "CHANGES_REQUESTED"})
+	for pr := 2; pr <= 3; pr++ {
+		r.GithubMock.PullRequestsMock.CallListReviewers(pr)
+		r.GithubMock.ReviewThreadsMock.CallCountUnresolved(pr, 0)
+	}
+
+	assert.Nil(t, r.Run("status", "--json"))
+
+	lines := strings.Split(strings.TrimSpace(r.Out.String()), "\n")
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+	var first, second cmd.PrStatus
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &second))
+
+	assert.Equal(t, 2, first.Number)
+	assert.Equal(t, 2, first.ChainRoot)
+	assert.Equal(t, "master", first.Ancestor)
+	assert.Equal(t, core.Must(r.GetLocalTip(pr2)), first.LocalTip)
+	assert.True(t, first.UpToDate)
+	assert.True(t, first.Mergeable)
+	assert.Equal(t, "clean", first.MergeableState)
+	assert.Equal(t, "approved", first.ReviewDecision)
+
+	assert.Equal(t, 3, second.Number)
+	assert.Equal(t, 2, second.ChainRoot)
+	assert.Equal(t, "pr/2", second.Ancestor)
+	assert.False(t, second.Mergeable)
+	assert.Equal(t, "dirty", second.MergeableState)
+	assert.Equal(t, "cannot be merged cleanly into master", second.Reason)
+	assert.Equal(t, "changes_requested", second.ReviewDecision)
+}
+
+func TestStatusTemplate(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.CreatePr(t, "HEAD", 2)
+
+	// The template does not show the reviews: they are not looked up.
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+
+	assert.Nil(t, r.Run("status", "--format", "#{{.Number}} {{.Mergeable}} {{.UpToDate}}"))
+	assert.Equal(t, "#2 true true\n", r.Out.String())
+}
+
+func TestStatusTemplateWithReviews(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.CreatePr(t, "HEAD", 2)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.GithubMock.PullRequestsMock.CallListReviews(2, [2]string{"alice", "APPROVED"})
+	r.GithubMock.PullRequestsMock.CallListReviewers(2)
+	r.GithubMock.ReviewThreadsMock.CallCountUnresolved(2, 0)
+
+	assert.Nil(t, r.Run("status", "--format", "#{{.Number}} {{.ReviewDecision}}"))
+	assert.Equal(t, "#2 approved\n", r.Out.String())
+}
+
+func TestStatusLooksUpSharedAncestorsOnce(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.CreatePr(t, "HEAD^^", 2)
+	r.CreatePr(t, "HEAD^", 3)
+	r.CreatePr(t, "HEAD", 4, "--base", "2")
+
+	// Get is mocked only once per PR: the mock fails if pr/2 is looked up twice.
+	for pr := 2; pr <= 4; pr++ {
+		r.GithubMock.CallStatus(pr, true)
+	}
+
+	assert.Nil(t, r.Run("status"))
+	r.GithubMock.PullRequestsMock.AssertNumberOfCalls(t, "Get", 3)
+	assert.Equal(t, 2, strings.Count(r.Out.String(), "https://github.com/cupcicm/opp/pull/2\n"))
+}
+
+func TestStatusShowsReviews(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.CreatePr(t, "HEAD", 2)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeableState(2, "blocked")
+	r.GithubMock.PullRequestsMock.CallListReviews(2,
+		[2]string{"alice", "APPROVED"},
+		[2]string{"bob", "APPROVED"},
+		[2]string{"carol", "APPROVED"},
+		[2]string{"carol", "CHANGES_REQUESTED"},
+		[2]string{"dave", "COMMENTED"},
+	)
+	r.GithubMock.PullRequestsMock.CallListReviewers(2, "erin", "cupcicm/backend")
+	r.GithubMock.ReviewThreadsMock.CallCountUnresolved(2, 3)
+
+	assert.Nil(t, r.Run("status"))
+	assert.Contains(t, r.Out.String(),
+		"reviews    ❌ - 2 approval(s), changes requested by carol, waiting for erin, cupcicm/backend, 3 unresolved thread(s)\n")
+}
+
+func TestStatusReadsAllThePagesOfReviews(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.CreatePr(t, "HEAD", 2)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(2, true)
+	r.GithubMock.PullRequestsMock.CallListReviewsPage(2, 2, [2]string{"alice", "APPROVED"})
+	r.GithubMock.PullRequestsMock.CallListReviewsPage(2, 0, [2]string{"alice", "CHANGES_REQUESTED"})
+	r.GithubMock.PullRequestsMock.CallListReviewers(2)
+	r.GithubMock.ReviewThreadsMock.CallCountUnresolved(2, 0)
+
+	assert.Nil(t, r.Run("status"))
+	assert.Contains(t, r.Out.String(), "reviews    ❌ - 0 approval(s), changes requested by alice\n")
 }
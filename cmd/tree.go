@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/urfave/cli/v3"
+)
+
+// tree prints the local PRs as a graph, rooted at the branches they are based on.
+type tree struct {
+	Out   io.Writer
+	Repo  *core.Repo
+	Forge core.Forge
+}
+
+// treeNode is a branch of the graph: either a PR, or the base branch at the root.
+type treeNode struct {
+	Pr       *core.LocalPr
+	Branch   core.Branch
+	Children []*treeNode
+	// Only set for PRs.
+	Commits int
+	Ahead   int
+	Behind  int
+	Pushed  bool
+	// Only set for PRs, and only with --remote.
+	Remote string
+}
+
+func TreeCommand(out io.Writer, repo *core.Repo, gh func(context.Context) core.Gh) *cli.Command {
+	cmd := &cli.Command{
+		Name:    "tree",
+		Aliases: []string{"log"},
+		Usage:   "Show all the local PRs as a graph, each PR under the PR it depends on.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "remote",
+				Usage: "Fetch and show the state of the PRs on github.",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if cmd.NArg() > 0 {
+				return cli.Exit("too many arguments", 1)
+			}
+			t := tree{Out: out, Repo: repo}
+			if cmd.Bool("remote") {
+				forge, err := core.NewForge(ctx, gh)
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+				t.Forge = forge
+				repo.Fetch(ctx)
+			}
+			roots := t.Build(ctx)
+			if t.Forge != nil {
+				if err := t.addRemoteStates(ctx, roots); err != nil {
+					return err
+				}
+			}
+			for _, root := range roots {
+				t.Print(root)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+// Build returns the roots of the graph: the branches that are not PRs and that
+// PRs depend on. The base branch is always the first root.
+func (t *tree) Build(ctx context.Context) []*treeNode {
+	prs := t.Repo.AllPrs(ctx)
+	nodes := make(map[string]*treeNode, len(prs))
+	for _, pr := range prs {
+		pr := pr
+		nodes[pr.LocalName()] = &treeNode{Pr: &pr, Branch: &pr}
+	}
+	base := &treeNode{Branch: t.Repo.BaseBranch()}
+	roots := []*treeNode{base}
+	rootsByName := map[string]*treeNode{base.Branch.LocalName(): base}
+
+	slices.SortFunc(prs, func(pr1, pr2 core.LocalPr) int {
+		return pr1.PrNumber - pr2.PrNumber
+	})
+	for _, pr := range prs {
+		node := nodes[pr.LocalName()]
+		ancestor, err := pr.GetAncestor()
+		if err != nil {
+			ancestor = t.Repo.BaseBranch()
+		}
+		parent, isLocalPr := nodes[ancestor.LocalName()]
+		if !isLocalPr {
+			parent = rootsByName[ancestor.LocalName()]
+			if parent == nil {
+				parent = &treeNode{Branch: ancestor}
+				rootsByName[ancestor.LocalName()] = parent
+				roots = append(roots, parent)
+			}
+		}
+		parent.Children = append(parent.Children, node)
+		t.addLocalState(ctx, node, ancestor)
+	}
+	return roots
+}
+
+// Counts the commits of the PR on top of its ancestor, and how far the
+// local branch is from the remote branch. Works without network access.
+func (t *tree) addLocalState(ctx context.Context, node *treeNode, ancestor core.Branch) {
+	localTip, err := t.Repo.GetLocalTip(node.Pr)
+	if err != nil {
+		return
+	}
+	ancestorRef := ancestor.LocalName()
+	if !ancestor.IsPr() {
+		ancestorRef = core.RemoteRef(ancestor)
+	}
+	node.Commits, _ = t.Repo.CountCommits(ctx, ancestorRef, localTip)
+	remoteTip, err := t.Repo.GetRemoteTip(node.Pr)
+	if err != nil {
+		return
+	}
+	node.Pushed = true
+	node.Ahead, _ = t.Repo.CountCommits(ctx, remoteTip, localTip)
+	node.Behind, _ = t.Repo.CountCommits(ctx, localTip, remoteTip)
+}
+
+func (t *tree) addRemoteStates(ctx context.Context, roots []*treeNode) error {
+	var all []*treeNode
+	var walk func(*treeNode)
+	walk = func(node *treeNode) {
+		if node.Pr != nil {
+			all = append(all, node)
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+	numbers := make([]int, 0, len(all))
+	for _, node := range all {
+		numbers = append(numbers, node.Pr.PrNumber)
+	}
+	lookups, err := core.ParallelMap(ctx, numbers, core.GetGithubConcurrency(), func(ctx context.Context, number int) prLookup {
+		forgePr, err := t.Forge.GetPr(ctx, number)
+		return prLookup{pr: forgePr, err: err}
+	})
+	if err != nil {
+		return err
+	}
+	for _, node := range all {
+		lookup := lookups[node.Pr.PrNumber]
+		if lookup.err != nil {
+			node.Remote = fmt.Sprintf("[unknown: %s]", lookup.err)
+			continue
+		}
+		state := lookup.pr.State
+		switch {
+		case lookup.pr.Merged:
+			state = "merged"
+		case state == "open" && lookup.pr.Draft:
+			state = "draft"
+		}
+		node.Remote = strings.TrimSpace(fmt.Sprintf("[%s] %s", state, lookup.pr.Title))
+	}
+	return nil
+}
+
+func (t *tree) Print(root *treeNode) {
+	fmt.Fprintln(t.Out, root.Branch.LocalName())
+	t.printChildren(root, "")
+}
+
+func (t *tree) printChildren(node *treeNode, prefix string) {
+	for i, child := range node.Children {
+		branch, indent := "├── ", "│   "
+		if i == len(node.Children)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Fprintf(t.Out, "%s%s%s\n", prefix, branch, child.String())
+		t.printChildren(child, prefix+indent)
+	}
+}
+
+func (n *treeNode) String() string {
+	commits := fmt.Sprintf("%d commits", n.Commits)
+	if n.Commits == 1 {
+		commits = "1 commit"
+	}
+	line := fmt.Sprintf("%s (%s, %s)", n.Pr.LocalBranch(), commits, n.divergence())
+	if n.Remote != "" {
+		line = fmt.Sprintf("%s %s", line, n.Remote)
+	}
+	return line
+}
+
+func (n *treeNode) divergence() string {
+	switch {
+	case !n.Pushed:
+		return "not pushed"
+	case n.Ahead == 0 && n.Behind == 0:
+		return "up-to-date"
+	case n.Behind == 0:
+		return fmt.Sprintf("%d ahead", n.Ahead)
+	case n.Ahead == 0:
+		return fmt.Sprintf("%d behind", n.Behind)
+	default:
+		return fmt.Sprintf("%d ahead, %d behind", n.Ahead, n.Behind)
+	}
+}
@@ -0,0 +1,44 @@
+package cmd_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cupcicm/opp/core/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTree(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.CreatePr(t, "HEAD^^^", 2)
+	pr3 := r.CreatePr(t, "HEAD^^", 3)
+	r.CreatePr(t, "HEAD", 4, "--base", "2")
+
+	r.Repo.Checkout(context.Background(), pr3)
+	r.Commit("local only")
+
+	assert.Nil(t, r.Run("tree"))
+	assert.Equal(t, strings.TrimSpace(`
+master
+└── pr/2 (2 commits, up-to-date)
+    ├── pr/3 (2 commits, 1 ahead)
+    └── pr/4 (2 commits, up-to-date)`), strings.TrimSpace(r.Out.String()))
+}
+
+func TestTreeRemote(t *testing.T) {
+	r := tests.NewTestRepo(t)
+
+	r.CreatePr(t, "HEAD^", 2)
+	r.CreatePr(t, "HEAD", 3)
+
+	r.GithubMock.PullRequestsMock.CallGetAndReturnBody(2, "Two", "")
+	r.GithubMock.PullRequestsMock.CallGetAndReturnMerged(3)
+
+	assert.Nil(t, r.Run("log", "--remote"))
+	assert.Equal(t, strings.TrimSpace(`
+master
+└── pr/2 (4 commits, up-to-date) [open] Two
+    └── pr/3 (1 commit, up-to-date) [merged]`), strings.TrimSpace(r.Out.String()))
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"context"
+	"strings"
+
+	"github.com/machinebox/graphql"
+)
+
+const enableAutoMergeMutation = `
+mutation enableAutoMerge($pullRequestId: ID!, $mergeMethod: PullRequestMergeMethod) {
+	enablePullRequestAutoMerge(input: {pullRequestId: $pullRequestId, mergeMethod: $mergeMethod}) {
+		clientMutationId
+	}
+}
+`
+
+const disableAutoMergeMutation = `
+mutation disableAutoMerge($pullRequestId: ID!) {
+	disablePullRequestAutoMerge(input: {pullRequestId: $pullRequestId}) {
+		clientMutationId
+	}
+}
+`
+
+// GhAutoMerge drives github's native auto-merge, which is only available
+// through the GraphQL API.
+// Pull requests are identified by their GraphQL node id.
+type GhAutoMerge interface {
+	Enable(ctx context.Context, pullRequestID string, mergeMethod string) error
+	Disable(ctx context.Context, pullRequestID string) error
+}
+
+type githubAutoMerge struct {
+	client *graphql.Client
+}
+
+func (a *githubAutoMerge) Enable(ctx context.Context, pullRequestID string, mergeMethod string) error {
+	req := graphql.NewRequest(enableAutoMergeMutation)
+	req.Var("pullRequestId", pullRequestID)
+	// The REST API uses lowercase merge methods, GraphQL uses an uppercase enum.
+	req.Var("mergeMethod", strings.ToUpper(mergeMethod))
+	return a.client.Run(ctx, req, &struct{}{})
+}
+
+func (a *githubAutoMerge) Disable(ctx context.Context, pullRequestID string) error {
+	req := graphql.NewRequest(disableAutoMergeMutation)
+	req.Var("pullRequestId", pullRequestID)
+	return a.client.Run(ctx, req, &struct{}{})
+}
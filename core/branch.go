@@ -20,12 +20,21 @@ type branch struct {
 	Repo  *Repo
 	Name  string
 	Local bool
+	// The upstream remote when empty.
+	remote string
 }
 
 type Branch interface {
 	IsPr() bool
 	LocalName() string
 	RemoteName() string
+	// The git remote the branch lives in.
+	Remote() string
+}
+
+// RemoteRef is the remote-tracking branch of b, e.g. origin/master.
+func RemoteRef(b Branch) string {
+	return fmt.Sprintf("%s/%s", b.Remote(), b.RemoteName())
 }
 
 func (b *LocalPr) ReloadState() {
@@ -45,6 +54,20 @@ func NewLocalPr(repo *Repo, prNumber int) *LocalPr {
 	return &pr
 }
 
+// LoadLocalPr returns a PR with its state, without creating the state when it does not exist.
+func LoadLocalPr(repo *Repo, prNumber int) (*LocalPr, error) {
+	pr := LocalPr{
+		Repo:     repo,
+		PrNumber: prNumber,
+	}
+	state, err := repo.StateStore().LoadBranchState(&pr)
+	if err != nil {
+		return nil, err
+	}
+	pr.state = state
+	return &pr, nil
+}
+
 func (pr *LocalPr) StateIsLoaded() bool {
 	return pr.state != nil
 }
@@ -57,6 +80,16 @@ func NewBranch(repo *Repo, name string) Branch {
 	return &branch
 }
 
+// NewBranchOnRemote is a branch that lives in another remote than upstream,
+// like the branch of a PR in the fork.
+func NewBranchOnRemote(repo *Repo, remote string, name string) Branch {
+	return &branch{
+		Repo:   repo,
+		Name:   name,
+		remote: remote,
+	}
+}
+
 func (b *LocalPr) IsPr() bool {
 	return true
 }
@@ -69,6 +102,10 @@ func (b *LocalPr) RemoteName() string {
 	return b.RemoteBranch()
 }
 
+func (b *LocalPr) Remote() string {
+	return GetPushRemoteName()
+}
+
 func (b *branch) IsPr() bool {
 	return false
 }
@@ -81,8 +118,15 @@ func (b *branch) RemoteName() string {
 	return b.Name
 }
 
+func (b *branch) Remote() string {
+	if b.remote != "" {
+		return b.remote
+	}
+	return GetUpstreamRemoteName()
+}
+
 func (b *LocalPr) Url() string {
-	return fmt.Sprintf("https://github.com/%s/pull/%d", GetGithubRepo(), b.PrNumber)
+	return PrUrl(b.PrNumber)
 }
 
 func (b *LocalPr) GetAncestor() (Branch, error) {
@@ -96,6 +140,11 @@ func (b *LocalPr) GetAncestor() (Branch, error) {
 	return NewLocalPr(b.Repo, number), nil
 }
 
+// AncestorName is the name of the branch this PR depends on, as saved in its state.
+func (b *LocalPr) AncestorName() string {
+	return b.state.Ancestor.Name
+}
+
 func (b *LocalPr) AncestorTips() []string {
 	ancestor, err := b.GetAncestor()
 	if err != nil {
@@ -118,6 +167,11 @@ func (b *LocalPr) AddKnownTip(tip string) {
 	b.Repo.StateStore().SaveBranchState(b, b.state)
 }
 
+func (b *LocalPr) AddAncestorKnownTip(tip string) {
+	b.state.Ancestor.KnownTips = append(b.state.Ancestor.KnownTips, tip)
+	b.Repo.StateStore().SaveBranchState(b, b.state)
+}
+
 func (b *LocalPr) SetKnownTipsFromAncestor(ancestor *LocalPr) {
 	b.state.Ancestor.KnownTips = ancestor.state.KnownTips
 	b.Repo.StateStore().SaveBranchState(b, b.state)
@@ -128,6 +182,42 @@ func (b *LocalPr) SetAncestor(branch Branch) {
 	b.Repo.StateStore().SaveBranchState(b, b.state)
 }
 
+func (b *LocalPr) AutoMerge() bool {
+	return b.state.AutoMerge
+}
+
+func (b *LocalPr) SetAutoMerge(autoMerge bool) {
+	b.state.AutoMerge = autoMerge
+	b.Repo.StateStore().SaveBranchState(b, b.state)
+}
+
+func (b *LocalPr) Labels() []string {
+	return b.state.Labels
+}
+
+func (b *LocalPr) AddLabels(labels []string) {
+	b.state.Labels = append(b.state.Labels, labels...)
+	b.Repo.StateStore().SaveBranchState(b, b.state)
+}
+
+func (b *LocalPr) Milestone() string {
+	return b.state.Milestone
+}
+
+func (b *LocalPr) SetMilestone(milestone string) {
+	b.state.Milestone = milestone
+	b.Repo.StateStore().SaveBranchState(b, b.state)
+}
+
+func (b *LocalPr) Story() string {
+	return b.state.Story
+}
+
+func (b *LocalPr) SetStory(story string) {
+	b.state.Story = story
+	b.Repo.StateStore().SaveBranchState(b, b.state)
+}
+
 // Returns all ancestor but not itself.
 func (b *LocalPr) AllAncestors() []*LocalPr {
 	all := b.allAncestors(make([]*LocalPr, 0))[1:]
@@ -136,6 +226,12 @@ func (b *LocalPr) AllAncestors() []*LocalPr {
 }
 
 func (b *LocalPr) allAncestors(descendents []*LocalPr) []*LocalPr {
+	for _, descendent := range descendents {
+		if descendent.PrNumber == b.PrNumber {
+			// The ancestry has a cycle, opp doctor reports it.
+			return descendents
+		}
+	}
 	descendents = append(descendents, b)
 	ancestor, err := b.GetAncestor()
 	if err != nil {
@@ -153,13 +249,30 @@ func (b *LocalPr) LocalBranch() string {
 }
 
 func (b *LocalPr) RemoteBranch() string {
+	if b.state != nil && b.state.RemoteBranch != "" {
+		return b.state.RemoteBranch
+	}
 	return RemoteBranchForPr(b.PrNumber)
 }
 
+func (b *LocalPr) SetRemoteBranch(branch string) {
+	b.state.RemoteBranch = branch
+	b.Repo.StateStore().SaveBranchState(b, b.state)
+}
+
 func RemoteBranchForPr(number int) string {
 	return fmt.Sprintf("%s/pr/%d", GetGithubUsername(), number)
 }
 
+// GithubHead is the head of the PR whose branch is branch: owner:branch when
+// the branch has been pushed to a fork.
+func GithubHead(branch string) string {
+	if IsForkWorkflow() {
+		return fmt.Sprintf("%s:%s", GetForkOwner(), branch)
+	}
+	return branch
+}
+
 func LocalBranchForPr(number int) string {
 	return fmt.Sprintf("pr/%d", number)
 }
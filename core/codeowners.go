@@ -0,0 +1,105 @@
+package core
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// The places where github looks for a CODEOWNERS file, in order.
+var codeownersLocations = []string{
+	".github/CODEOWNERS",
+	"CODEOWNERS",
+	"docs/CODEOWNERS",
+}
+
+type codeownersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// Codeowners maps the files of the repo to their owners, following
+// the rules of github's CODEOWNERS file.
+type Codeowners struct {
+	rules []codeownersRule
+}
+
+// LoadCodeowners reads the CODEOWNERS file of the repo.
+// Returns nil when the repo does not have one.
+func (r *Repo) LoadCodeowners() (*Codeowners, error) {
+	for _, location := range codeownersLocations {
+		file, err := os.Open(path.Join(r.Path(), location))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return ParseCodeowners(bufio.NewScanner(file))
+	}
+	return nil, nil
+}
+
+func ParseCodeowners(scanner *bufio.Scanner) (*Codeowners, error) {
+	c := &Codeowners{}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		c.rules = append(c.rules, codeownersRule{
+			pattern: pathPattern(fields[0]),
+			owners:  fields[1:],
+		})
+	}
+	return c, scanner.Err()
+}
+
+// Owners returns the owners of the given file. Like github, the last matching rule wins.
+func (c *Codeowners) Owners(file string) []string {
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].pattern.MatchString(file) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// Converts a gitignore-like pattern to a regexp matching the paths it applies to.
+func pathPattern(pattern string) *regexp.Regexp {
+	// A slash at the start or in the middle anchors the pattern at the root of the repo.
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	var re strings.Builder
+	if anchored {
+		re.WriteString("^")
+	} else {
+		re.WriteString("^(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i += 1
+		case pattern[i] == '*':
+			re.WriteString("[^/]*")
+		case pattern[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		}
+	}
+	// A pattern matching a directory applies to everything inside it.
+	re.WriteString("(/.*)?$")
+	return regexp.MustCompile(re.String())
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeowners(t *testing.T) {
+	codeowners, err := ParseCodeowners(bufio.NewScanner(strings.NewReader(`
+# Default owners
+*           @cupcicm/everyone
+*.go        @gopher
+/docs/      @writer
+cmd/**/test_*.go @tester @cupcicm/qa
+README.md   docs@example.com
+`)))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		file   string
+		owners []string
+	}{
+		{"Makefile", []string{"@cupcicm/everyone"}},
+		{"core/repo.go", []string{"@gopher"}},
+		{"docs/index.md", []string{"@writer"}},
+		{"docs/sub/page.md", []string{"@writer"}},
+		{"other/docs/index.md", []string{"@cupcicm/everyone"}},
+		{"cmd/test_pr.go", []string{"@tester", "@cupcicm/qa"}},
+		{"cmd/sub/test_pr.go", []string{"@tester", "@cupcicm/qa"}},
+		{"core/test_pr.go", []string{"@gopher"}},
+		{"README.md", []string{"docs@example.com"}},
+		{"sub/README.md", []string{"docs@example.com"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			require.Equal(t, tc.owners, codeowners.Owners(tc.file))
+		})
+	}
+}
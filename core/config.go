@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"strings"
 	"time"
 
@@ -8,20 +9,133 @@ import (
 )
 
 func init() {
+	viper.SetDefault("forge.type", "github")
+	viper.SetDefault("github.host", "github.com")
+	viper.SetDefault("gitlab.host", "gitlab.com")
 	viper.SetDefault("github.merge.method", "rebase")
 	viper.SetDefault("github.timeout", 30*time.Second)
+	viper.SetDefault("github.checks.timeout", 30*time.Minute)
+	viper.SetDefault("github.checks.grace-period", time.Minute)
+	viper.SetDefault("github.concurrency", 8)
 	viper.SetDefault("repo.push-command", "push")
+	viper.SetDefault("repo.update-refs", true)
+	viper.SetDefault("pr.stack", true)
 	viper.SetDefault("story.enrich", true)
+	viper.SetDefault("story.link-pr", true)
+	viper.SetDefault("story.states.in-review", "In Review")
+	viper.SetDefault("story.states.done", "Done")
+}
+
+// The service hosting the repo and its PRs: github, gitlab or gitea.
+// Forgejo is a fork of gitea with the same API.
+func GetForgeType() string {
+	forge := viper.GetString("forge.type")
+	if forge == "forgejo" {
+		return "gitea"
+	}
+	return forge
+}
+
+func IsGithubForge() bool {
+	return GetForgeType() == "github"
+}
+
+// The base of the URLs of the web pages of the forge, without a trailing slash.
+func GetForgeWebUrl() string {
+	switch GetForgeType() {
+	case "gitlab":
+		return GetGitlabWebUrl()
+	case "gitea":
+		return GetGiteaWebUrl()
+	default:
+		return GetGithubWebUrl()
+	}
+}
+
+// The host of gitlab: gitlab.com, or the hostname (or URL) of a self-managed instance.
+func GetGitlabHost() string {
+	return viper.GetString("gitlab.host")
+}
+
+func GetGitlabWebUrl() string {
+	return webUrl(GetGitlabHost())
+}
+
+func GetGitlabToken() string {
+	token, _ := ResolveToken(context.Background(), GitlabCredential())
+	return token
+}
+
+// The hostname (or URL) of the Gitea or Forgejo instance.
+func GetGiteaHost() string {
+	return viper.GetString("gitea.host")
+}
+
+func GetGiteaWebUrl() string {
+	return webUrl(GetGiteaHost())
+}
+
+func GetGiteaToken() string {
+	token, _ := ResolveToken(context.Background(), GiteaCredential())
+	return token
+}
+
+// The token of the forge chosen by forge.type.
+func GetForgeToken() string {
+	token, _ := ResolveToken(context.Background(), ForgeCredential())
+	return token
 }
 
 func GetGithubToken() string {
-	return viper.GetString("github.token")
+	token, _ := ResolveToken(context.Background(), GithubCredential())
+	return token
 }
 
 func GetGithubUsername() string {
 	return viper.GetString("github.login")
 }
 
+// The host of github: github.com, or the hostname of a GitHub Enterprise server.
+// It can also be a full URL, e.g. http://localhost:8080 for a server that does not use https.
+func GetGithubHost() string {
+	return viper.GetString("github.host")
+}
+
+// Whether opp talks to a GitHub Enterprise server instead of github.com.
+func IsGithubEnterprise() bool {
+	return GetGithubHost() != "github.com"
+}
+
+// The base of the URLs of the github web pages, without a trailing slash.
+func GetGithubWebUrl() string {
+	return webUrl(GetGithubHost())
+}
+
+func webUrl(host string) string {
+	host = strings.TrimSuffix(host, "/")
+	if strings.Contains(host, "://") {
+		return host
+	}
+	return "https://" + host
+}
+
+// The base URL of the github REST API, with a trailing slash.
+func GetGithubApiUrl() string {
+	if !IsGithubEnterprise() {
+		return "https://api.github.com/"
+	}
+	return GetGithubWebUrl() + "/api/v3/"
+}
+
+// The endpoint of the github GraphQL API.
+func GetGithubGraphqlUrl() string {
+	if !IsGithubEnterprise() {
+		return "https://api.github.com/graphql"
+	}
+	return GetGithubWebUrl() + "/api/graphql"
+}
+
+// The path of the repo on the forge, owner/name on github, group/project on gitlab.
 func GetGithubRepo() string {
 	return viper.GetString("repo.github")
 }
@@ -44,6 +158,38 @@ func GetRemoteName() string {
 	return viper.GetString("repo.remote")
 }
 
+// The remote of the repo PRs are opened against, where the base branch is.
+// repo.remote unless repo.upstream is set, e.g. when pushing to a fork.
+func GetUpstreamRemoteName() string {
+	if upstream := viper.GetString("repo.upstream"); upstream != "" {
+		return upstream
+	}
+	return GetRemoteName()
+}
+
+// The remote the PR branches are pushed to.
+// repo.remote unless repo.push-remote is set, e.g. to a personal fork.
+func GetPushRemoteName() string {
+	if pushRemote := viper.GetString("repo.push-remote"); pushRemote != "" {
+		return pushRemote
+	}
+	return GetRemoteName()
+}
+
+// Whether the PR branches are pushed to a fork of the repo the PRs are opened against.
+func IsForkWorkflow() bool {
+	return GetPushRemoteName() != GetUpstreamRemoteName()
+}
+
+// The owner of the fork the PR branches are pushed to: the owner part of repo.fork, or github.login.
+func GetForkOwner() string {
+	fork := viper.GetString("repo.fork")
+	if slash := strings.Index(fork, "/"); slash > 0 {
+		return fork[:slash]
+	}
+	return GetGithubUsername()
+}
+
 func GetBaseBranch() string {
 	return viper.GetString("repo.branch")
 }
@@ -52,6 +198,12 @@ func GetPushCommand() string {
 	return viper.GetString("repo.push-command")
 }
 
+// Whether opp rebases a whole PR chain at once with git rebase --update-refs,
+// when git is recent enough. When false, the PRs are always rebased one by one.
+func RebaseWithUpdateRefs() bool {
+	return viper.GetBool("repo.update-refs")
+}
+
 func GetGithubMergeMethod() string {
 	return viper.GetString("github.merge.method")
 }
@@ -60,6 +212,51 @@ func GetGithubTimeout() time.Duration {
 	return viper.GetDuration("github.timeout")
 }
 
+// How long opp merge --wait waits for the checks of a PR to complete.
+func GetGithubChecksTimeout() time.Duration {
+	return viper.GetDuration("github.checks.timeout")
+}
+
+// Github takes some time to register the checks of a commit that has just been
+// pushed: opp merge --wait only trusts a commit without checks once this has passed.
+// Repos without CI can set it to 0.
+func GetGithubChecksGracePeriod() time.Duration {
+	return viper.GetDuration("github.checks.grace-period")
+}
+
+// How many github API calls opp makes at the same time.
+func GetGithubConcurrency() int {
+	return viper.GetInt("github.concurrency")
+}
+
+// Reviewers requested on every new PR, users or org/team.
+func GetPrReviewers() []string {
+	return viper.GetStringSlice("pr.reviewers")
+}
+
+// Whether opp pr requests reviews from the owners of the modified files, found in CODEOWNERS.
+func PrReviewersFromCodeowners() bool {
+	return viper.GetBool("pr.codeowners")
+}
+
+// The path of the template used for the body of new PRs, relative to the root of the repo.
+// When empty, opp uses the PR template of github if the repo has one.
+func GetPrTemplate() string {
+	return viper.GetString("pr.template")
+}
+
+// Whether opp maintains the list of the PRs of a chain in the description of each of them.
+func PrStackEnabled() bool {
+	return viper.GetBool("pr.stack")
+}
+
+// The rules in pr.rules that decide which labels and milestone opp applies to PRs.
+func GetLabelRules() ([]LabelRule, error) {
+	var rules []LabelRule
+	err := viper.UnmarshalKey("pr.rules", &rules)
+	return rules, err
+}
+
 func GetStoryTool() string {
 	return viper.GetString("story.tool")
 }
@@ -73,5 +270,37 @@ func EnrichPrBodyWithStoryEnabled() bool {
 }
 
 func GetStoryToolToken() string {
+	token, _ := ResolveToken(context.Background(), StoryCredential())
+	return token
+}
+
+// story.token as it is in the config file, without asking the credential providers.
+func GetStoryToolConfigToken() string {
 	return viper.GetString("story.token")
 }
+
+// The API of the story tool, when it is not the default one of the tool
+// (e.g. for self-hosted instances, or the generic http tool).
+func GetStoryToolApiUrl() string {
+	return viper.GetString("story.api-url")
+}
+
+// For story tools that authenticate with a user and a token, like Jira cloud.
+func GetStoryToolUser() string {
+	return viper.GetString("story.user")
+}
+
+// The state stories are moved to when their PR is created. Empty to leave them as they are.
+func GetStoryInReviewState() string {
+	return viper.GetString("story.states.in-review")
+}
+
+// The state stories are moved to when their PR is merged. Empty to leave them as they are.
+func GetStoryDoneState() string {
+	return viper.GetString("story.states.done")
+}
+
+// Whether the PR is linked from its story when it is created.
+func LinkPrFromStoryEnabled() bool {
+	return viper.GetBool("story.link-pr")
+}
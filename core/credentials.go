@@ -0,0 +1,375 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Credential is a token opp needs, like github.token or story.token.
+// It is looked up in the providers of credentials.providers, in order.
+type Credential struct {
+	// The config key of the token. <key>-command is the command that prints it.
+	Key string
+	// The host the token is for, to find it in git and in the gh CLI. Empty when unknown.
+	Host string
+	// The environment variables that can hold the token, most specific first.
+	EnvVars []string
+}
+
+// CredentialProvider is somewhere tokens can be found.
+type CredentialProvider struct {
+	// What opp init shows when offering to store a token there.
+	Description string
+	// Returns "" when the provider does not have the token.
+	Lookup func(ctx context.Context, c Credential) (string, error)
+	// Nil for the providers opp can only read from.
+	Store func(ctx context.Context, c Credential, login, token string) error
+}
+
+var credentialProviders = make(map[string]CredentialProvider)
+
+func RegisterCredentialProvider(name string, provider CredentialProvider) {
+	credentialProviders[name] = provider
+}
+
+func LookupCredentialProvider(name string) (CredentialProvider, bool) {
+	provider, found := credentialProviders[name]
+	return provider, found
+}
+
+// Like the gh CLI, GH_TOKEN and GITHUB_TOKEN are only for github.com,
+// a GitHub Enterprise server has its own variables.
+func GithubCredential() Credential {
+	envVars := []string{"OPP_GITHUB_TOKEN", "GH_TOKEN", "GITHUB_TOKEN"}
+	if IsGithubEnterprise() {
+		envVars = []string{"OPP_GITHUB_TOKEN", "GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	return Credential{
+		Key:     "github.token",
+		Host:    hostname(GetGithubWebUrl()),
+		EnvVars: envVars,
+	}
+}
+
+func GitlabCredential() Credential {
+	return Credential{
+		Key:     "gitlab.token",
+		Host:    hostname(GetGitlabWebUrl()),
+		EnvVars: []string{"OPP_GITLAB_TOKEN", "GITLAB_TOKEN"},
+	}
+}
+
+func GiteaCredential() Credential {
+	return Credential{
+		Key:     "gitea.token",
+		Host:    hostname(GetGiteaWebUrl()),
+		EnvVars: []string{"OPP_GITEA_TOKEN", "GITEA_TOKEN"},
+	}
+}
+
+// The story tools are not git hosts, their token is only looked up
+// in the environment, in story.token-command and in the config.
+func StoryCredential() Credential {
+	return Credential{
+		Key:     "story.token",
+		EnvVars: []string{"OPP_STORY_TOKEN"},
+	}
+}
+
+// Credentials are all the tokens opp can look up.
+func Credentials() []Credential {
+	return []Credential{GithubCredential(), GitlabCredential(), GiteaCredential(), StoryCredential()}
+}
+
+// The credential of the forge chosen by forge.type.
+func ForgeCredential() Credential {
+	switch GetForgeType() {
+	case "gitlab":
+		return GitlabCredential()
+	case "gitea":
+		return GiteaCredential()
+	default:
+		return GithubCredential()
+	}
+}
+
+// ResolveToken returns the token from the first provider that has it,
+// and the name of that provider. Providers that fail are reported on stderr.
+// Each credential is only resolved once per run: the commands and git are
+// not asked again, and a failing provider is only reported once.
+func ResolveToken(ctx context.Context, c Credential) (string, string) {
+	resolvedMu.Lock()
+	defer resolvedMu.Unlock()
+	key := strings.Join(append([]string{c.Key, c.Host}, c.EnvVars...), "\x00")
+	if found, ok := resolved[key]; ok {
+		return found.token, found.provider
+	}
+	token, provider := resolveToken(ctx, c)
+	resolved[key] = resolvedToken{token, provider}
+	return token, provider
+}
+
+func resolveToken(ctx context.Context, c Credential) (string, string) {
+	for _, name := range viper.GetStringSlice("credentials.providers") {
+		provider, found := credentialProviders[name]
+		if !found {
+			fmt.Fprintf(os.Stderr, "warning: unknown credential provider %q in credentials.providers\n", name)
+			continue
+		}
+		token, err := provider.Lookup(ctx, c)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not get %s from %s: %s\n", c.Key, name, err)
+			continue
+		}
+		if token != "" {
+			return token, name
+		}
+	}
+	return "", ""
+}
+
+func hostname(webUrl string) string {
+	u, err := url.Parse(webUrl)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+type resolvedToken struct {
+	token    string
+	provider string
+}
+
+var (
+	resolvedMu sync.Mutex
+	resolved   = make(map[string]resolvedToken)
+)
+
+// ForgetResolvedTokens makes the next ResolveToken look the tokens up
+// again, for the tests that change them between runs.
+func ForgetResolvedTokens() {
+	resolvedMu.Lock()
+	defer resolvedMu.Unlock()
+	resolved = make(map[string]resolvedToken)
+}
+
+func init() {
+	viper.SetDefault("credentials.providers", []string{"env", "command", "gh", "git", "user-config", "config"})
+	RegisterCredentialProvider("env", CredentialProvider{
+		Description: "an environment variable",
+		Lookup: func(ctx context.Context, c Credential) (string, error) {
+			for _, name := range c.EnvVars {
+				if token := strings.TrimSpace(os.Getenv(name)); token != "" {
+					return token, nil
+				}
+			}
+			return "", nil
+		},
+	})
+	RegisterCredentialProvider("command", CredentialProvider{
+		Description: "a password manager, through a command like pass show opp/token",
+		Lookup: func(ctx context.Context, c Credential) (string, error) {
+			command := viper.GetString(c.Key + "-command")
+			if command == "" {
+				return "", nil
+			}
+			return RunTokenCommand(ctx, command)
+		},
+	})
+	RegisterCredentialProvider("gh", CredentialProvider{
+		Description: "the gh CLI",
+		Lookup:      lookupGhHostsFile,
+	})
+	RegisterCredentialProvider("git", CredentialProvider{
+		Description: "your git credential helper",
+		Lookup: func(ctx context.Context, c Credential) (string, error) {
+			if c.Host == "" {
+				return "", nil
+			}
+			return gitCredentialFill(ctx, c.Host)
+		},
+		Store: func(ctx context.Context, c Credential, login, token string) error {
+			if c.Host == "" {
+				return fmt.Errorf("no host to store %s for", c.Key)
+			}
+			input := fmt.Sprintf("protocol=https\nhost=%s\nusername=%s\npassword=%s\n\n", c.Host, login, token)
+			_, err := gitCredential(ctx, "approve", input)
+			return err
+		},
+	})
+	RegisterCredentialProvider("user-config", CredentialProvider{
+		Description: "your own config file, " + UserConfigFile(),
+		Lookup: func(ctx context.Context, c Credential) (string, error) {
+			config, err := readUserConfig()
+			if err != nil {
+				return "", err
+			}
+			value, _ := lookupKey(config, c.Key).(string)
+			return value, nil
+		},
+		Store: func(ctx context.Context, c Credential, login, token string) error {
+			config, err := readUserConfig()
+			if err != nil {
+				return err
+			}
+			setKey(config, c.Key, token)
+			return writeUserConfig(config)
+		},
+	})
+	RegisterCredentialProvider("config", CredentialProvider{
+		Description: "the config file of the repo, .opp/config.yaml",
+		Lookup: func(ctx context.Context, c Credential) (string, error) {
+			return viper.GetString(c.Key), nil
+		},
+		Store: func(ctx context.Context, c Credential, login, token string) error {
+			viper.Set(c.Key, token)
+			return nil
+		},
+	})
+}
+
+// RunTokenCommand runs command in a shell, and returns what it prints.
+func RunTokenCommand(ctx context.Context, command string) (string, error) {
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	// Like pass, the token is on the first line.
+	token, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(token), nil
+}
+
+// The hosts file of the gh CLI, host: {oauth_token: ...}. Recent versions of gh
+// keep the token in the keyring of the system instead, opp cannot read it there.
+func lookupGhHostsFile(ctx context.Context, c Credential) (string, error) {
+	if c.Key != "github.token" || c.Host == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(ghHostsFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var hosts map[string]struct {
+		OauthToken string `yaml:"oauth_token"`
+	}
+	if err := yaml.Unmarshal(content, &hosts); err != nil {
+		return "", fmt.Errorf("could not read %s: %w", ghHostsFile(), err)
+	}
+	return hosts[c.Host].OauthToken, nil
+}
+
+func ghHostsFile() string {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return path.Join(dir, "hosts.yml")
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return path.Join(dir, "gh", "hosts.yml")
+	}
+	home, _ := os.UserHomeDir()
+	return path.Join(home, ".config", "gh", "hosts.yml")
+}
+
+func gitCredentialFill(ctx context.Context, host string) (string, error) {
+	output, err := gitCredential(ctx, "fill", fmt.Sprintf("protocol=https\nhost=%s\n\n", host))
+	if err != nil {
+		// No helper knows about the host, and git could not ask.
+		return "", nil
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if password, found := strings.CutPrefix(line, "password="); found {
+			return password, nil
+		}
+	}
+	return "", nil
+}
+
+// Runs git credential without ever prompting the user.
+func gitCredential(ctx context.Context, action, input string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "credential", action)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GCM_INTERACTIVE=never", "GIT_ASKPASS=true")
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// UserConfigFile is the config file opp reads when the repo has none.
+// Unlike .opp/config.yaml, it is outside of the working tree.
+func UserConfigFile() string {
+	home, _ := os.UserHomeDir()
+	return path.Join(home, ".config", "opp", "config.yaml")
+}
+
+// viper only reads the first config file it finds, so the user config file
+// is read directly when the repo has its own.
+func readUserConfig() (map[string]any, error) {
+	config := make(map[string]any)
+	content, err := os.ReadFile(UserConfigFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", UserConfigFile(), err)
+	}
+	if config == nil {
+		config = make(map[string]any)
+	}
+	return config, nil
+}
+
+func writeUserConfig(config map[string]any) error {
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(UserConfigFile()), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(UserConfigFile(), content, 0600)
+}
+
+// Gets a dotted key like github.token in nested maps.
+func lookupKey(config map[string]any, key string) any {
+	var value any = config
+	for _, part := range strings.Split(key, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[part]
+	}
+	return value
+}
+
+func setKey(config map[string]any, key string, value any) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		m, ok := config[part].(map[string]any)
+		if !ok {
+			m = make(map[string]any)
+			config[part] = m
+		}
+		config = m
+	}
+	config[parts[len(parts)-1]] = value
+}
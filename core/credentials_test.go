@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useProviders(t *testing.T, providers ...string) {
+	viper.Set("credentials.providers", providers)
+	ForgetResolvedTokens()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GH_CONFIG_DIR", t.TempDir())
+	t.Setenv("GIT_CONFIG_GLOBAL", path.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, name := range []string{"OPP_GITHUB_TOKEN", "GH_TOKEN", "GITHUB_TOKEN", "GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN", "OPP_STORY_TOKEN"} {
+		t.Setenv(name, "")
+	}
+	viper.Set("github.host", "github.com")
+	viper.Set("github.token", "")
+	viper.Set("github.token-command", "")
+	viper.Set("story.token", "")
+	viper.Set("story.token-command", "")
+}
+
+func TestTheFirstProviderWins(t *testing.T) {
+	useProviders(t, "env", "config")
+	viper.Set("github.token", "config token")
+
+	token, provider := ResolveToken(context.Background(), GithubCredential())
+	assert.Equal(t, "config token", token)
+	assert.Equal(t, "config", provider)
+
+	t.Setenv("GH_TOKEN", "env token")
+	ForgetResolvedTokens()
+	token, provider = ResolveToken(context.Background(), GithubCredential())
+	assert.Equal(t, "env token", token)
+	assert.Equal(t, "env", provider)
+}
+
+func TestTokenCommand(t *testing.T) {
+	useProviders(t, "command", "config")
+	viper.Set("story.token-command", "printf 'story token\\nlogin: me\\n'")
+
+	assert.Equal(t, "story token", GetStoryToolToken())
+}
+
+func TestFailingTokenCommandFallsBack(t *testing.T) {
+	useProviders(t, "command", "config")
+	viper.Set("story.token-command", "exit 1")
+	viper.Set("story.token", "config token")
+
+	assert.Equal(t, "config token", GetStoryToolToken())
+}
+
+func TestFailingTokenCommandRunsOnce(t *testing.T) {
+	useProviders(t, "command", "config")
+	runs := path.Join(t.TempDir(), "runs")
+	viper.Set("story.token-command", "echo run >> "+runs+"; exit 1")
+	viper.Set("story.token", "config token")
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "config token", GetStoryToolToken())
+	}
+	content, err := os.ReadFile(runs)
+	require.NoError(t, err)
+	assert.Equal(t, "run\n", string(content))
+}
+
+func TestGithubEnterpriseEnvVars(t *testing.T) {
+	useProviders(t, "env")
+	t.Setenv("GH_TOKEN", "github.com token")
+	t.Setenv("GH_ENTERPRISE_TOKEN", "enterprise token")
+
+	assert.Equal(t, "github.com token", GetGithubToken())
+
+	viper.Set("github.host", "github.example.com")
+	defer viper.Set("github.host", "github.com")
+	assert.Equal(t, "enterprise token", GetGithubToken())
+}
+
+func TestGhHostsFile(t *testing.T) {
+	useProviders(t, "gh")
+	require.NoError(t, os.WriteFile(path.Join(os.Getenv("GH_CONFIG_DIR"), "hosts.yml"), []byte(`
+github.com:
+    user: cupcicm
+    oauth_token: gh token
+    git_protocol: ssh
+`), 0600))
+
+	assert.Equal(t, "gh token", GetGithubToken())
+	token, _ := ResolveToken(context.Background(), GitlabCredential())
+	assert.Equal(t, "", token)
+}
+
+func TestGitCredentialHelper(t *testing.T) {
+	useProviders(t, "git")
+	store := path.Join(t.TempDir(), "credentials")
+	require.NoError(t, exec.Command("git", "config", "--global", "credential.helper", "store --file="+store).Run())
+	ctx := context.Background()
+	assert.Equal(t, "", GetGithubToken())
+
+	git, _ := LookupCredentialProvider("git")
+	require.NoError(t, git.Store(ctx, GithubCredential(), "cupcicm", "git token"))
+	ForgetResolvedTokens()
+
+	assert.Equal(t, "git token", GetGithubToken())
+}
+
+func TestUserConfigFile(t *testing.T) {
+	useProviders(t, "user-config", "config")
+	require.NoError(t, os.MkdirAll(path.Dir(UserConfigFile()), 0700))
+	require.NoError(t, os.WriteFile(UserConfigFile(), []byte("github:\n  login: cupcicm\n"), 0600))
+	ctx := context.Background()
+
+	userConfig, _ := LookupCredentialProvider("user-config")
+	require.NoError(t, userConfig.Store(ctx, GithubCredential(), "cupcicm", "user token"))
+
+	assert.Equal(t, "user token", GetGithubToken())
+	config, err := readUserConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "cupcicm", lookupKey(config, "github.login"))
+	info, err := os.Stat(UserConfigFile())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
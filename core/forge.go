@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Forge is the service hosting the repo and its PRs: github, gitlab where PRs are
+// called merge requests, or gitea. It covers what opp needs from all of them, the
+// features only github has (reviewers, labels, checks, auto-merge...) use Gh directly.
+type Forge interface {
+	CreatePr(ctx context.Context, pr NewPr) (*Pr, error)
+	GetPr(ctx context.Context, number int) (*Pr, error)
+	// Merges the PR if its head is still sha, and returns the merge commit.
+	// Fails with ErrRemoteTipChanged when the head has moved.
+	MergePr(ctx context.Context, number int, sha string, method string) (string, error)
+	// The number of the last PR created, or 0 when there is none yet.
+	// The next PR gets the next number.
+	LastPrNumber(ctx context.Context) (int, error)
+	Comment(ctx context.Context, number int, body string) error
+	// Changes the branch the PR gets merged into.
+	RetargetPr(ctx context.Context, number int, base string) error
+}
+
+var ErrRemoteTipChanged = errors.New("wrong remote tip")
+
+type NewPr struct {
+	Title string
+	Body  string
+	// The branch of the PR, as returned by GithubHead.
+	Head  string
+	Base  string
+	Draft bool
+}
+
+type Pr struct {
+	Number int
+	Title  string
+	Body   string
+	// Either open or closed.
+	State  string
+	Merged bool
+	Draft  bool
+	Head   string
+	// The repo the head branch is in, owner/name.
+	HeadRepo     string
+	Base         string
+	Mergeability Mergeability
+}
+
+// Mergeability is whether a PR can be merged, in the words of github.
+// The other forges map their merge status onto it.
+type Mergeability string
+
+const (
+	// The forge has not decided yet.
+	MergeabilityPending     Mergeability = ""
+	MergeabilityClean       Mergeability = "clean"
+	MergeabilityConflicting Mergeability = "dirty"
+	MergeabilityBlocked     Mergeability = "blocked"
+	MergeabilityUnstable    Mergeability = "unstable"
+	MergeabilityDraft       Mergeability = "draft"
+)
+
+// NewForge returns the forge chosen by forge.type. gh is only called when it is github.
+func NewForge(ctx context.Context, gh func(context.Context) Gh) (Forge, error) {
+	switch GetForgeType() {
+	case "github":
+		return NewGithubForge(gh(ctx)), nil
+	case "gitlab":
+		return NewGitlabForge(GetGitlabWebUrl(), GetGitlabToken(), GetGithubRepo()), nil
+	case "gitea":
+		if GetGiteaHost() == "" {
+			return nil, errors.New("gitea.host is not set")
+		}
+		return NewGiteaForge(GetGiteaWebUrl(), GetGiteaToken(), GetGithubRepo()), nil
+	default:
+		return nil, fmt.Errorf("unknown forge.type %q, use github, gitlab, gitea or forgejo", GetForgeType())
+	}
+}
+
+// The URL of the web page of a PR.
+func PrUrl(number int) string {
+	switch GetForgeType() {
+	case "gitlab":
+		return fmt.Sprintf("%s/%s/-/merge_requests/%d", GetGitlabWebUrl(), GetGithubRepo(), number)
+	case "gitea":
+		return fmt.Sprintf("%s/%s/pulls/%d", GetGiteaWebUrl(), GetGithubRepo(), number)
+	default:
+		return fmt.Sprintf("%s/%s/pull/%d", GetGithubWebUrl(), GetGithubRepo(), number)
+	}
+}
+
+// ErrOnlyOnGithub is returned by the commands that need a feature only github has.
+func ErrOnlyOnGithub(feature string) error {
+	return fmt.Errorf("%s is only supported on github, not on %s", feature, GetForgeType())
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GiteaForge talks to the API of a Gitea or Forgejo instance, where pull requests
+// and issues share their numbers like on github.
+type GiteaForge struct {
+	client restClient
+	repo   string
+}
+
+func NewGiteaForge(webUrl, token, repo string) *GiteaForge {
+	return &GiteaForge{
+		client: restClient{
+			forge:  "gitea",
+			apiUrl: strings.TrimSuffix(webUrl, "/") + "/api/v1",
+			authenticate: func(req *http.Request) {
+				req.Header.Set("Authorization", "token "+token)
+			},
+		},
+		repo: repo,
+	}
+}
+
+// IsGiteaInstance asks the server at webUrl whether it runs gitea or forgejo.
+func IsGiteaInstance(ctx context.Context, webUrl string) bool {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	client := restClient{forge: "gitea", apiUrl: strings.TrimSuffix(webUrl, "/") + "/api/v1", authenticate: func(*http.Request) {}}
+	var version struct {
+		Version string `json:"version"`
+	}
+	return client.call(ctx, http.MethodGet, "/version", nil, &version) == nil && version.Version != ""
+}
+
+type giteaPullRequest struct {
+	Number    int    `json:"number"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	State     string `json:"state"`
+	Merged    bool   `json:"merged"`
+	Mergeable bool   `json:"mergeable"`
+	Draft     bool   `json:"draft"`
+	// Only set once merged.
+	MergeCommitSha string        `json:"merge_commit_sha"`
+	Head           giteaPrBranch `json:"head"`
+	Base           giteaPrBranch `json:"base"`
+}
+
+type giteaPrBranch struct {
+	Ref  string `json:"ref"`
+	Sha  string `json:"sha"`
+	Repo struct {
+		FullName string `json:"full_name"`
+	} `json:"repo"`
+}
+
+func (f *GiteaForge) CreatePr(ctx context.Context, pr NewPr) (*Pr, error) {
+	title := pr.Title
+	if pr.Draft {
+		// Gitea marks PRs as work in progress with a prefix of their title.
+		title = "WIP: " + title
+	}
+	var created giteaPullRequest
+	err := f.client.call(ctx, http.MethodPost, f.repoPath("pulls"), map[string]any{
+		"head":  pr.Head,
+		"base":  pr.Base,
+		"title": title,
+		"body":  pr.Body,
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return fromGiteaPr(&created), nil
+}
+
+func (f *GiteaForge) GetPr(ctx context.Context, number int) (*Pr, error) {
+	pr, err := f.getPr(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return fromGiteaPr(pr), nil
+}
+
+// The merge style is the github.merge.method (merge, rebase or squash),
+// or one of the styles only gitea has, like rebase-merge or fast-forward-only.
+func (f *GiteaForge) MergePr(ctx context.Context, number int, sha string, method string) (string, error) {
+	err := f.client.call(ctx, http.MethodPost, f.repoPath("pulls/%d/merge", number), map[string]any{
+		"Do":             method,
+		"head_commit_id": sha,
+	}, nil)
+	if isStatus(err, http.StatusConflict) {
+		return "", ErrRemoteTipChanged
+	}
+	if err != nil {
+		return "", err
+	}
+	// Gitea does not answer with the merge commit.
+	pr, err := f.getPr(ctx, number)
+	if err != nil {
+		return "", err
+	}
+	return pr.MergeCommitSha, nil
+}
+
+func (f *GiteaForge) LastPrNumber(ctx context.Context) (int, error) {
+	var issues []struct {
+		Number int `json:"number"`
+	}
+	err := f.client.call(ctx, http.MethodGet, f.repoPath("issues?state=all&limit=1"), nil, &issues)
+	if err != nil {
+		return 0, err
+	}
+	if len(issues) == 0 {
+		return 0, nil
+	}
+	return issues[0].Number, nil
+}
+
+func (f *GiteaForge) Comment(ctx context.Context, number int, body string) error {
+	return f.client.call(ctx, http.MethodPost, f.repoPath("issues/%d/comments", number), map[string]any{"body": body}, nil)
+}
+
+func (f *GiteaForge) RetargetPr(ctx context.Context, number int, base string) error {
+	return f.client.call(ctx, http.MethodPatch, f.repoPath("pulls/%d", number), map[string]any{"base": base}, nil)
+}
+
+// Login returns the login of the owner of the token.
+func (f *GiteaForge) Login(ctx context.Context) (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := f.client.call(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+		return "", err
+	}
+	return user.Login, nil
+}
+
+func (f *GiteaForge) getPr(ctx context.Context, number int) (*giteaPullRequest, error) {
+	var pr giteaPullRequest
+	if err := f.client.call(ctx, http.MethodGet, f.repoPath("pulls/%d", number), nil, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (f *GiteaForge) repoPath(format string, args ...any) string {
+	return fmt.Sprintf("/repos/%s/", f.repo) + fmt.Sprintf(format, args...)
+}
+
+// Gitea only says whether a PR can be merged without conflicts.
+func fromGiteaPr(giteaPr *giteaPullRequest) *Pr {
+	pr := &Pr{
+		Number:   giteaPr.Number,
+		Title:    giteaPr.Title,
+		Body:     giteaPr.Body,
+		State:    giteaPr.State,
+		Merged:   giteaPr.Merged,
+		Draft:    giteaPr.Draft || strings.HasPrefix(giteaPr.Title, "WIP:"),
+		Head:     giteaPr.Head.Ref,
+		HeadRepo: giteaPr.Head.Repo.FullName,
+		Base:     giteaPr.Base.Ref,
+	}
+	switch {
+	case pr.Draft:
+		pr.Mergeability = MergeabilityDraft
+	case giteaPr.Mergeable:
+		pr.Mergeability = MergeabilityClean
+	default:
+		pr.Mergeability = MergeabilityConflicting
+	}
+	return pr
+}
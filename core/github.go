@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/google/go-github/v56/github"
+	"github.com/machinebox/graphql"
 	"golang.org/x/oauth2"
 )
 
@@ -12,20 +13,41 @@ type GhPullRequest interface {
 	Create(ctx context.Context, owner string, repo string, pull *github.NewPullRequest) (*github.PullRequest, *github.Response, error)
 	Get(ctx context.Context, owner string, repo string, number int) (*github.PullRequest, *github.Response, error)
 	Merge(ctx context.Context, owner string, repo string, number int, commitMessage string, options *github.PullRequestOptions) (*github.PullRequestMergeResult, *github.Response, error)
+	Edit(ctx context.Context, owner string, repo string, number int, pull *github.PullRequest) (*github.PullRequest, *github.Response, error)
+	ListReviews(ctx context.Context, owner string, repo string, number int, opts *github.ListOptions) ([]*github.PullRequestReview, *github.Response, error)
+	ListReviewers(ctx context.Context, owner string, repo string, number int, opts *github.ListOptions) (*github.Reviewers, *github.Response, error)
+	RequestReviewers(ctx context.Context, owner string, repo string, number int, reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error)
 }
 
 type GhIssues interface {
 	ListByRepo(ctx context.Context, owner string, repo string, opts *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error)
 	CreateComment(ctx context.Context, owner string, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+	AddAssignees(ctx context.Context, owner string, repo string, number int, assignees []string) (*github.Issue, *github.Response, error)
+	AddLabelsToIssue(ctx context.Context, owner string, repo string, number int, labels []string) ([]*github.Label, *github.Response, error)
+	ListMilestones(ctx context.Context, owner string, repo string, opts *github.MilestoneListOptions) ([]*github.Milestone, *github.Response, error)
+	Edit(ctx context.Context, owner string, repo string, number int, issue *github.IssueRequest) (*github.Issue, *github.Response, error)
+}
+
+type GhChecks interface {
+	ListCheckRunsForRef(ctx context.Context, owner string, repo string, ref string, opts *github.ListCheckRunsOptions) (*github.ListCheckRunsResults, *github.Response, error)
+}
+
+type GhRepositories interface {
+	GetCombinedStatus(ctx context.Context, owner string, repo string, ref string, opts *github.ListOptions) (*github.CombinedStatus, *github.Response, error)
 }
 
 type Gh interface {
 	PullRequests() GhPullRequest
 	Issues() GhIssues
+	Checks() GhChecks
+	Repositories() GhRepositories
+	AutoMerge() GhAutoMerge
+	ReviewThreads() GhReviewThreads
 }
 
 type GithubClient struct {
 	*github.Client
+	graphql *graphql.Client
 }
 
 func (c *GithubClient) PullRequests() GhPullRequest {
@@ -36,10 +58,50 @@ func (c *GithubClient) Issues() GhIssues {
 	return c.Client.Issues
 }
 
+func (c *GithubClient) Checks() GhChecks {
+	return c.Client.Checks
+}
+
+func (c *GithubClient) Repositories() GhRepositories {
+	return c.Client.Repositories
+}
+
+func (c *GithubClient) AutoMerge() GhAutoMerge {
+	return &githubAutoMerge{client: c.graphql}
+}
+
+func (c *GithubClient) ReviewThreads() GhReviewThreads {
+	return &githubReviewThreads{client: c.graphql}
+}
+
+// The token is only looked up by the first request: the commands that build a client
+// on gitlab or gitea never run the token command or the git credential helper for github.
 func NewClient(ctx context.Context) *GithubClient {
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: GetGithubToken()},
-	)
+	return newClient(ctx, githubTokenSource{})
+}
+
+// NewClientWithToken is used by opp init, before the token is stored anywhere.
+func NewClientWithToken(ctx context.Context, token string) *GithubClient {
+	return newClient(ctx, oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	))
+}
+
+type githubTokenSource struct{}
+
+func (githubTokenSource) Token() (*oauth2.Token, error) {
+	return &oauth2.Token{AccessToken: GetGithubToken()}, nil
+}
+
+func newClient(ctx context.Context, ts oauth2.TokenSource) *GithubClient {
 	tc := oauth2.NewClient(ctx, ts)
-	return &GithubClient{Client: github.NewClient(tc)}
+	client := github.NewClient(tc)
+	if IsGithubEnterprise() {
+		// Also derives the upload URL, /api/uploads/ on the same host.
+		client = Must(client.WithEnterpriseURLs(GetGithubApiUrl(), GetGithubApiUrl()))
+	}
+	return &GithubClient{
+		Client:  client,
+		graphql: graphql.NewClient(GetGithubGraphqlUrl(), graphql.WithHTTPClient(tc)),
+	}
 }
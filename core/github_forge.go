@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/go-github/v56/github"
+)
+
+type githubForge struct {
+	gh Gh
+}
+
+func NewGithubForge(gh Gh) Forge {
+	return &githubForge{gh: gh}
+}
+
+func (f *githubForge) CreatePr(ctx context.Context, pr NewPr) (*Pr, error) {
+	githubPr, _, err := f.gh.PullRequests().Create(ctx, GetGithubOwner(), GetGithubRepoName(), &github.NewPullRequest{
+		Title: &pr.Title,
+		Head:  &pr.Head,
+		Base:  &pr.Base,
+		Body:  &pr.Body,
+		Draft: &pr.Draft,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromGithubPr(githubPr), nil
+}
+
+func (f *githubForge) GetPr(ctx context.Context, number int) (*Pr, error) {
+	githubPr, _, err := f.gh.PullRequests().Get(ctx, GetGithubOwner(), GetGithubRepoName(), number)
+	if err != nil {
+		return nil, err
+	}
+	return fromGithubPr(githubPr), nil
+}
+
+func (f *githubForge) MergePr(ctx context.Context, number int, sha string, method string) (string, error) {
+	merge, r, err := f.gh.PullRequests().Merge(ctx, GetGithubOwner(), GetGithubRepoName(), number, "",
+		&github.PullRequestOptions{
+			SHA:         sha,
+			MergeMethod: method,
+		})
+	if r != nil && r.StatusCode == http.StatusConflict {
+		return "", ErrRemoteTipChanged
+	}
+	if err != nil {
+		return "", err
+	}
+	return merge.GetSHA(), nil
+}
+
+// The Github API list pull requests and issues under "issues", and they share their numbers.
+func (f *githubForge) LastPrNumber(ctx context.Context) (int, error) {
+	issues, _, err := f.gh.Issues().ListByRepo(
+		ctx,
+		GetGithubOwner(),
+		GetGithubRepoName(),
+		&github.IssueListByRepoOptions{
+			State:     "all",
+			Sort:      "created",
+			Direction: "desc",
+			ListOptions: github.ListOptions{
+				Page:    0,
+				PerPage: 1,
+			},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(issues) == 0 {
+		return 0, nil
+	}
+	return *issues[0].Number, nil
+}
+
+func (f *githubForge) Comment(ctx context.Context, number int, body string) error {
+	_, _, err := f.gh.Issues().CreateComment(ctx, GetGithubOwner(), GetGithubRepoName(), number, &github.IssueComment{Body: &body})
+	return err
+}
+
+func (f *githubForge) RetargetPr(ctx context.Context, number int, base string) error {
+	_, _, err := f.gh.PullRequests().Edit(ctx, GetGithubOwner(), GetGithubRepoName(), number,
+		&github.PullRequest{
+			Base: &github.PullRequestBranch{Ref: &base},
+		})
+	return err
+}
+
+func fromGithubPr(githubPr *github.PullRequest) *Pr {
+	pr := &Pr{
+		Number:   githubPr.GetNumber(),
+		Title:    githubPr.GetTitle(),
+		Body:     githubPr.GetBody(),
+		State:    githubPr.GetState(),
+		Merged:   githubPr.GetMerged(),
+		Draft:    githubPr.GetDraft(),
+		Head:     githubPr.GetHead().GetRef(),
+		HeadRepo: githubPr.GetHead().GetRepo().GetFullName(),
+		Base:     githubPr.GetBase().GetRef(),
+	}
+	if githubPr.Mergeable != nil {
+		pr.Mergeability = Mergeability(githubPr.GetMergeableState())
+	}
+	return pr
+}
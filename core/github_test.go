@@ -0,0 +1,118 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/machinebox/graphql"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGithubUrlsDefaultToGithubCom(t *testing.T) {
+	viper.Set("github.host", "github.com")
+	viper.Set("repo.github", "cupcicm/opp")
+
+	assert.Equal(t, "https://api.github.com/", GetGithubApiUrl())
+	assert.Equal(t, "https://api.github.com/graphql", GetGithubGraphqlUrl())
+	assert.Equal(t, "https://github.com/cupcicm/opp/pull/12", (&LocalPr{PrNumber: 12}).Url())
+}
+
+func TestGithubUrlsOnEnterprise(t *testing.T) {
+	viper.Set("github.host", "github.acme.com")
+	defer viper.Set("github.host", "github.com")
+	viper.Set("repo.github", "cupcicm/opp")
+
+	assert.Equal(t, "https://github.acme.com/api/v3/", GetGithubApiUrl())
+	assert.Equal(t, "https://github.acme.com/api/graphql", GetGithubGraphqlUrl())
+	assert.Equal(t, "https://github.acme.com/cupcicm/opp/pull/12", (&LocalPr{PrNumber: 12}).Url())
+}
+
+func TestClientTalksToEnterpriseServer(t *testing.T) {
+	var graphqlCalls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer enterprise token", r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(map[string]string{"login": "cupcicm"})
+	})
+	mux.HandleFunc("/api/graphql", func(w http.ResponseWriter, r *http.Request) {
+		graphqlCalls++
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	viper.Set("github.host", server.URL)
+	defer viper.Set("github.host", "github.com")
+	viper.Set("github.token", "enterprise token")
+	viper.Set("credentials.providers", []string{"config"})
+	ForgetResolvedTokens()
+	ctx := context.Background()
+
+	client := NewClient(ctx)
+	user, _, err := client.Users.Get(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, "cupcicm", user.GetLogin())
+
+	require.NoError(t, client.AutoMerge().Disable(ctx, "PR_id"))
+	assert.Equal(t, 1, graphqlCalls)
+}
+
+func TestClientLooksUpTheTokenOnFirstRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer command token", r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(map[string]string{"login": "cupcicm"})
+	}))
+	defer server.Close()
+	viper.Set("github.host", server.URL)
+	defer viper.Set("github.host", "github.com")
+	runs := path.Join(t.TempDir(), "runs")
+	viper.Set("github.token-command", "echo run >> "+runs+"; echo command token")
+	defer viper.Set("github.token-command", "")
+	viper.Set("credentials.providers", []string{"command"})
+	ForgetResolvedTokens()
+	ctx := context.Background()
+
+	client := NewClient(ctx)
+	assert.NoFileExists(t, runs)
+
+	_, _, err := client.Users.Get(ctx, "")
+	require.NoError(t, err)
+	assert.FileExists(t, runs)
+}
+
+func TestCountUnresolvedReadsAllThePages(t *testing.T) {
+	var cursors []any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables map[string]any `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		cursors = append(cursors, req.Variables["after"])
+		threads := map[string]any{
+			"pageInfo": map[string]any{"hasNextPage": true, "endCursor": "page2"},
+			"nodes":    []map[string]any{{"isResolved": false}, {"isResolved": true}},
+		}
+		if req.Variables["after"] == "page2" {
+			threads = map[string]any{
+				"pageInfo": map[string]any{"hasNextPage": false},
+				"nodes":    []map[string]any{{"isResolved": false}},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"repository": map[string]any{"pullRequest": map[string]any{"reviewThreads": threads}},
+		}})
+	}))
+	defer server.Close()
+	threads := githubReviewThreads{client: graphql.NewClient(server.URL)}
+
+	unresolved, err := threads.CountUnresolved(context.Background(), "cupcicm", "opp", 2)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, unresolved)
+	assert.Equal(t, []any{nil, "page2"}, cursors)
+}
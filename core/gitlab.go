@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitlabForge talks to the merge requests API of gitlab.com or of a self-managed gitlab.
+type GitlabForge struct {
+	client  restClient
+	project string
+}
+
+func NewGitlabForge(webUrl, token, project string) *GitlabForge {
+	return &GitlabForge{
+		client: restClient{
+			forge:  "gitlab",
+			apiUrl: strings.TrimSuffix(webUrl, "/") + "/api/v4",
+			authenticate: func(req *http.Request) {
+				req.Header.Set("PRIVATE-TOKEN", token)
+			},
+		},
+		project: project,
+	}
+}
+
+type gitlabMergeRequest struct {
+	Iid                 int    `json:"iid"`
+	Title               string `json:"title"`
+	Description         string `json:"description"`
+	State               string `json:"state"`
+	Draft               bool   `json:"draft"`
+	SourceBranch        string `json:"source_branch"`
+	TargetBranch        string `json:"target_branch"`
+	SourceProjectId     int    `json:"source_project_id"`
+	TargetProjectId     int    `json:"target_project_id"`
+	Sha                 string `json:"sha"`
+	MergeCommitSha      string `json:"merge_commit_sha"`
+	SquashCommitSha     string `json:"squash_commit_sha"`
+	DetailedMergeStatus string `json:"detailed_merge_status"`
+}
+
+func (f *GitlabForge) CreatePr(ctx context.Context, pr NewPr) (*Pr, error) {
+	if strings.Contains(pr.Head, ":") {
+		return nil, errors.New("opening merge requests from a fork is not supported on gitlab")
+	}
+	title := pr.Title
+	if pr.Draft {
+		title = "Draft: " + title
+	}
+	var mr gitlabMergeRequest
+	err := f.client.call(ctx, http.MethodPost, f.projectPath("merge_requests"), map[string]any{
+		"source_branch": pr.Head,
+		"target_branch": pr.Base,
+		"title":         title,
+		"description":   pr.Body,
+	}, &mr)
+	if err != nil {
+		return nil, err
+	}
+	return f.fromMergeRequest(&mr), nil
+}
+
+func (f *GitlabForge) GetPr(ctx context.Context, number int) (*Pr, error) {
+	var mr gitlabMergeRequest
+	if err := f.client.call(ctx, http.MethodGet, f.projectPath("merge_requests/%d", number), nil, &mr); err != nil {
+		return nil, err
+	}
+	return f.fromMergeRequest(&mr), nil
+}
+
+// Gitlab merges with the method set on the project, it can only be asked to squash on top.
+func (f *GitlabForge) MergePr(ctx context.Context, number int, sha string, method string) (string, error) {
+	var mr gitlabMergeRequest
+	err := f.client.call(ctx, http.MethodPut, f.projectPath("merge_requests/%d/merge", number), map[string]any{
+		"sha":    sha,
+		"squash": method == "squash",
+	}, &mr)
+	if isStatus(err, http.StatusConflict) {
+		return "", ErrRemoteTipChanged
+	}
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case mr.MergeCommitSha != "":
+		return mr.MergeCommitSha, nil
+	case mr.SquashCommitSha != "":
+		return mr.SquashCommitSha, nil
+	default:
+		// Fast-forward merges do not create any commit.
+		return mr.Sha, nil
+	}
+}
+
+func (f *GitlabForge) LastPrNumber(ctx context.Context) (int, error) {
+	var mrs []gitlabMergeRequest
+	err := f.client.call(ctx, http.MethodGet, f.projectPath("merge_requests?state=all&order_by=created_at&sort=desc&per_page=1"), nil, &mrs)
+	if err != nil {
+		return 0, err
+	}
+	if len(mrs) == 0 {
+		return 0, nil
+	}
+	return mrs[0].Iid, nil
+}
+
+func (f *GitlabForge) Comment(ctx context.Context, number int, body string) error {
+	return f.client.call(ctx, http.MethodPost, f.projectPath("merge_requests/%d/notes", number), map[string]any{"body": body}, nil)
+}
+
+func (f *GitlabForge) RetargetPr(ctx context.Context, number int, base string) error {
+	return f.client.call(ctx, http.MethodPut, f.projectPath("merge_requests/%d", number), map[string]any{"target_branch": base}, nil)
+}
+
+// Login returns the username of the owner of the token.
+func (f *GitlabForge) Login(ctx context.Context) (string, error) {
+	var user struct {
+		Username string `json:"username"`
+	}
+	if err := f.client.call(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
+
+func (f *GitlabForge) fromMergeRequest(mr *gitlabMergeRequest) *Pr {
+	pr := &Pr{
+		Number:       mr.Iid,
+		Title:        mr.Title,
+		Body:         mr.Description,
+		Draft:        mr.Draft,
+		Head:         mr.SourceBranch,
+		Base:         mr.TargetBranch,
+		Mergeability: gitlabMergeability(mr.DetailedMergeStatus),
+	}
+	switch mr.State {
+	case "opened":
+		pr.State = "open"
+	case "merged":
+		pr.State = "closed"
+		pr.Merged = true
+	default:
+		pr.State = "closed"
+	}
+	if mr.SourceProjectId == mr.TargetProjectId {
+		pr.HeadRepo = f.project
+	}
+	return pr
+}
+
+// Maps the detailed_merge_status of gitlab onto the mergeable_state of github.
+func gitlabMergeability(status string) Mergeability {
+	switch status {
+	case "unchecked", "checking", "preparing", "approvals_syncing":
+		return MergeabilityPending
+	case "mergeable":
+		return MergeabilityClean
+	case "conflict", "need_rebase":
+		return MergeabilityConflicting
+	case "draft_status":
+		return MergeabilityDraft
+	case "ci_must_pass", "ci_still_running", "external_status_checks":
+		return MergeabilityUnstable
+	case "not_approved", "requested_changes", "discussions_not_resolved", "blocked_status",
+		"merge_request_blocked", "jira_association_missing", "security_policy_violations", "merge_time":
+		return MergeabilityBlocked
+	default:
+		return Mergeability(status)
+	}
+}
+
+func (f *GitlabForge) projectPath(format string, args ...any) string {
+	return fmt.Sprintf("/projects/%s/", url.PathEscape(f.project)) + fmt.Sprintf(format, args...)
+}
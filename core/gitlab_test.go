@@ -0,0 +1,37 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitlabMergeability(t *testing.T) {
+	for status, expected := range map[string]Mergeability{
+		"checking":                 MergeabilityPending,
+		"mergeable":                MergeabilityClean,
+		"conflict":                 MergeabilityConflicting,
+		"need_rebase":              MergeabilityConflicting,
+		"draft_status":             MergeabilityDraft,
+		"ci_still_running":         MergeabilityUnstable,
+		"not_approved":             MergeabilityBlocked,
+		"discussions_not_resolved": MergeabilityBlocked,
+		"not_open":                 "not_open",
+	} {
+		assert.Equal(t, expected, gitlabMergeability(status), status)
+	}
+}
+
+func TestGitlabMergeRequestStates(t *testing.T) {
+	f := NewGitlabForge("https://gitlab.com", "", "acme/opp")
+
+	merged := f.fromMergeRequest(&gitlabMergeRequest{Iid: 3, State: "merged", SourceProjectId: 1, TargetProjectId: 1})
+	assert.Equal(t, "closed", merged.State)
+	assert.True(t, merged.Merged)
+	assert.Equal(t, "acme/opp", merged.HeadRepo)
+
+	fromFork := f.fromMergeRequest(&gitlabMergeRequest{Iid: 4, State: "opened", SourceProjectId: 2, TargetProjectId: 1})
+	assert.Equal(t, "open", fromFork.State)
+	assert.False(t, fromFork.Merged)
+	assert.Empty(t, fromFork.HeadRepo)
+}
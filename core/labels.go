@@ -0,0 +1,71 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+
+	"golang.org/x/exp/slices"
+)
+
+// A LabelRule applies its labels and milestone to the PRs that touch one of
+// its paths, or that contain a commit whose message matches one of its regexps.
+// Paths use the same syntax as .gitignore and CODEOWNERS.
+//
+//	pr:
+//	  rules:
+//	    - paths: ["core/story/"]
+//	      messages: ["(?i)linear"]
+//	      labels: ["stories"]
+//	      milestone: "v2"
+type LabelRule struct {
+	Paths     []string `mapstructure:"paths"`
+	Messages  []string `mapstructure:"messages"`
+	Labels    []string `mapstructure:"labels"`
+	Milestone string   `mapstructure:"milestone"`
+}
+
+// MatchLabelRules returns the labels of all the rules matching the files and
+// commits of a PR, and the milestone of the last matching rule that has one.
+func MatchLabelRules(rules []LabelRule, files []string, commits []Commit) ([]string, string, error) {
+	var (
+		labels    []string
+		milestone string
+	)
+	for _, rule := range rules {
+		matches, err := rule.matches(files, commits)
+		if err != nil {
+			return nil, "", err
+		}
+		if !matches {
+			continue
+		}
+		for _, label := range rule.Labels {
+			if !slices.Contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+		if rule.Milestone != "" {
+			milestone = rule.Milestone
+		}
+	}
+	return labels, milestone, nil
+}
+
+func (rule LabelRule) matches(files []string, commits []Commit) (bool, error) {
+	for _, path := range rule.Paths {
+		pattern := pathPattern(path)
+		if slices.ContainsFunc(files, pattern.MatchString) {
+			return true, nil
+		}
+	}
+	for _, message := range rule.Messages {
+		pattern, err := regexp.Compile(message)
+		if err != nil {
+			return false, fmt.Errorf("invalid regexp %q in pr.rules: %w", message, err)
+		}
+		if slices.ContainsFunc(commits, func(c Commit) bool { return pattern.MatchString(c.Message) }) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchLabelRules(t *testing.T) {
+	rules := []LabelRule{
+		{Paths: []string{"core/story/"}, Labels: []string{"stories"}},
+		{Paths: []string{"*.md"}, Labels: []string{"docs"}, Milestone: "v1"},
+		{Messages: []string{"(?i)^fix"}, Labels: []string{"bug", "stories"}, Milestone: "v2"},
+	}
+
+	testCases := []struct {
+		name      string
+		files     []string
+		messages  []string
+		labels    []string
+		milestone string
+	}{
+		{"nothing matches", []string{"cmd/pr.go"}, []string{"Add a flag"}, nil, ""},
+		{"path", []string{"core/story/linear.go"}, []string{"Add a flag"}, []string{"stories"}, ""},
+		{"nested path", []string{"docs/README.md"}, []string{"Document"}, []string{"docs"}, "v1"},
+		{"message", []string{"cmd/pr.go"}, []string{"Add a flag", "FIX the flag"}, []string{"bug", "stories"}, "v2"},
+		{"last milestone wins", []string{"README.md", "core/story/linear.go"}, []string{"fix"}, []string{"stories", "docs", "bug"}, "v2"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			commits := make([]Commit, len(tc.messages))
+			for i, message := range tc.messages {
+				commits[i] = Commit{Message: message}
+			}
+			labels, milestone, err := MatchLabelRules(rules, tc.files, commits)
+			require.NoError(t, err)
+			require.Equal(t, tc.labels, labels)
+			require.Equal(t, tc.milestone, milestone)
+		})
+	}
+}
+
+func TestMatchLabelRulesInvalidRegexp(t *testing.T) {
+	_, _, err := MatchLabelRules([]LabelRule{{Messages: []string{"("}}}, nil, []Commit{{Message: "fix"}})
+	require.Error(t, err)
+}
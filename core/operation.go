@@ -0,0 +1,54 @@
+package core
+
+import (
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RebaseOperation records the progress of the rebase of a PR chain, so that
+// it can be resumed with opp rebase --continue or unwound with opp rebase --abort
+// when a conflict interrupts it. Like the git sequencer, it is saved after every step.
+type RebaseOperation struct {
+	// The PR opp rebase was run on, last of the chain.
+	Pr int `yaml:"pr"`
+	// The PRs of the chain, root first.
+	Chain []int `yaml:"chain"`
+	// The commit where each PR of the chain started, before anything was rebased.
+	Parents map[int]string `yaml:"parents"`
+	// The tips of the PRs of the chain before anything was rebased.
+	OriginalTips map[int]string `yaml:"original_tips"`
+	Done         []int          `yaml:"done,omitempty"`
+	// The PR that was being rebased when the rebase got interrupted.
+	Pending int `yaml:"pending,omitempty"`
+}
+
+// GetRebaseOperation returns the rebase in progress, or nil when there is none.
+func (s *StateStore) GetRebaseOperation() (*RebaseOperation, error) {
+	if !FileExists(s.operationFile) {
+		return nil, nil
+	}
+	content, err := os.ReadFile(s.operationFile)
+	if err != nil {
+		return nil, err
+	}
+	op := RebaseOperation{}
+	if err := yaml.Unmarshal(content, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+func (s *StateStore) SaveRebaseOperation(op *RebaseOperation) error {
+	content, err := yaml.Marshal(op)
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(path.Dir(s.operationFile), 0700)
+	return os.WriteFile(s.operationFile, content, 0600)
+}
+
+func (s *StateStore) DeleteRebaseOperation() {
+	_ = os.Remove(s.operationFile)
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"sync"
+)
+
+// ParallelMap calls fn once for every distinct key, with at most workers calls
+// running at the same time.
+// When ctx is cancelled, the keys that have not been started yet are missing from
+// the result, and the cause of the cancellation is returned.
+func ParallelMap[K comparable, V any](
+	ctx context.Context,
+	keys []K,
+	workers int,
+	fn func(context.Context, K) V,
+) (map[K]V, error) {
+	unique := make([]K, 0, len(keys))
+	seen := make(map[K]bool, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	results := make(map[K]V, len(unique))
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		jobs = make(chan K)
+	)
+	for i := 0; i < min(max(workers, 1), len(unique)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				value := fn(ctx, key)
+				mu.Lock()
+				results[key] = value
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, key := range unique {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case jobs <- key:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results, context.Cause(ctx)
+}
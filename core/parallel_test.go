@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelMapDeduplicatesKeys(t *testing.T) {
+	var calls atomic.Int32
+	results, err := ParallelMap(context.Background(), []int{1, 2, 2, 3, 1}, 4, func(_ context.Context, k int) int {
+		calls.Add(1)
+		return k * 10
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(3), calls.Load())
+	require.Equal(t, map[int]int{1: 10, 2: 20, 3: 30}, results)
+}
+
+func TestParallelMapBoundsConcurrency(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	keys := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	_, err := ParallelMap(context.Background(), keys, 3, func(_ context.Context, k int) int {
+		current := running.Add(1)
+		for {
+			previous := maxRunning.Load()
+			if current <= previous || maxRunning.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		return k
+	})
+	require.NoError(t, err)
+	require.LessOrEqual(t, maxRunning.Load(), int32(3))
+}
+
+func TestParallelMapStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	interrupted := errors.New("interrupted")
+	results, err := ParallelMap(ctx, []int{1, 2, 3, 4, 5}, 1, func(_ context.Context, k int) int {
+		if k == 2 {
+			cancel(interrupted)
+		}
+		return k
+	})
+	require.ErrorIs(t, err, interrupted)
+	require.Equal(t, map[int]int{1: 1, 2: 2}, results)
+}
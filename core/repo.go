@@ -7,8 +7,8 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strconv"
 	"strings"
-
 )
 
 var ErrReferenceNotFound = errors.New("reference not found")
@@ -20,7 +20,10 @@ type Commit struct {
 
 type Repo struct {
 	s        *StateStore
+	retarget Retargeter
 	RootPath string
+	// The PRs without a local branch that have already been reported.
+	lostPrs map[int]bool
 }
 
 func Current() *Repo {
@@ -51,6 +54,14 @@ func NewRepo(folder string) *Repo {
 	}
 }
 
+// Retargeter changes the base of PRs to the base branch on the forge.
+type Retargeter func(ctx context.Context, prs []*LocalPr) error
+
+// UseRetargeter lets the repo update the PRs on the forge when it cleans up merged PRs.
+func (r *Repo) UseRetargeter(retarget Retargeter) {
+	r.retarget = retarget
+}
+
 func (r *Repo) OppEnabled() bool {
 	return FileExists(r.Config())
 }
@@ -71,9 +82,10 @@ func (r *Repo) Config() string {
 	return path.Join(r.DotOpDir(), "config.yaml")
 }
 
+// AllPrs returns the local PRs. The PRs that have a state but no local branch
+// are skipped: opp doctor tells what to do with them.
 func (r *Repo) AllPrs(ctx context.Context) []LocalPr {
 	var prNumbers = r.StateStore().AllLocalPrNumbers(ctx)
-	var toclean []*LocalPr
 	var prs = make([]LocalPr, 0, len(prNumbers))
 
 	for _, prNum := range prNumbers {
@@ -81,23 +93,32 @@ func (r *Repo) AllPrs(ctx context.Context) []LocalPr {
 		// Check that the branch exists.
 		_, err := r.GetLocalTip(pr)
 		if err != nil {
-			// This PR does not exist locally: clean it.
-			toclean = append(toclean, pr)
+			r.warnLostPr(pr)
 		} else {
 			prs = append(prs, *pr)
 		}
 	}
-	r.CleanupMultiple(ctx, toclean, prs)
 	return prs
 }
 
+func (r *Repo) warnLostPr(pr *LocalPr) {
+	if r.lostPrs == nil {
+		r.lostPrs = make(map[int]bool)
+	}
+	if r.lostPrs[pr.PrNumber] {
+		return
+	}
+	r.lostPrs[pr.PrNumber] = true
+	fmt.Fprintf(os.Stderr, "warning: %s has no local branch, run opp doctor\n", pr.LocalBranch())
+}
+
 func (r *Repo) Push(ctx context.Context, hash string, branch string) error {
 	ctx, cancel := context.WithTimeoutCause(
 		ctx, GetGithubTimeout(),
-		fmt.Errorf("push to %s too slow, increase github.timeout", GetRemoteName()),
+		fmt.Errorf("push to %s too slow, increase github.timeout", GetPushRemoteName()),
 	)
 	defer cancel()
-	cmd := r.GitExec(ctx, "%s --force %s %s:refs/heads/%s", GetPushCommand(), GetRemoteName(), hash, branch)
+	cmd := r.GitExec(ctx, "%s --force %s %s:refs/heads/%s", GetPushCommand(), GetPushRemoteName(), hash, branch)
 	return cmd.Run()
 }
 
@@ -129,7 +150,7 @@ func (r *Repo) AllLocalPrs() (map[int]string, error) {
 func (r *Repo) GetCommitsNotInBaseBranch(hash string) ([]Commit, error) {
 	baseHash, err := r.GetRefHash(
 		context.Background(),
-		fmt.Sprintf("refs/remotes/%s/%s", GetRemoteName(), GetBaseBranch()),
+		fmt.Sprintf("refs/remotes/%s", RemoteRef(r.BaseBranch())),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("could not find the tip of the base branch: %w", err)
@@ -143,10 +164,16 @@ func (r *Repo) GetCommitsNotInBaseBranch(hash string) ([]Commit, error) {
 	}
 	mergeBase := strings.TrimSpace(string(mbOutput))
 
-	// List commits between merge-base and hash with their full messages.
+	return r.GetCommitsBetween(context.Background(), mergeBase, hash)
+}
+
+// GetCommitsBetween lists the commits that are ancestors of to but not of from,
+// in git children -> parent order.
+func (r *Repo) GetCommitsBetween(ctx context.Context, from, to string) ([]Commit, error) {
+	// List commits between from and to with their full messages.
 	// Format: <hash>\x00<full message>\x00 for each commit.
 	// git log returns child-first order, which matches the old behavior.
-	logCmd := r.GitExec(context.Background(), "log --format=%%H%%x00%%B%%x00 %s..%s", mergeBase, hash)
+	logCmd := r.GitExec(ctx, "log --format=%%H%%x00%%B%%x00 %s..%s", from, to)
 	logOutput, err := logCmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("could not list commits: %w", err)
@@ -221,6 +248,16 @@ func (r *Repo) BaseBranch() Branch {
 	return NewBranch(r, GetBaseBranch())
 }
 
+// GithubBase is the base on github of a PR that depends on ancestor.
+// PRs opened from a fork can only be based on branches of the upstream repo,
+// so all the PRs of a chain are based on the base branch there.
+func (r *Repo) GithubBase(ancestor Branch) string {
+	if ancestor.IsPr() && IsForkWorkflow() {
+		return r.BaseBranch().RemoteName()
+	}
+	return ancestor.RemoteName()
+}
+
 func (r *Repo) Checkout(ctx context.Context, branch Branch) error {
 	return r.CheckoutRef(ctx, branch.LocalName())
 }
@@ -302,21 +339,36 @@ func (r *Repo) GetMainBranch(ctx context.Context, remoteName string) (string, er
 	return strings.TrimPrefix(ref, prefix), nil
 }
 
+// Fetch fetches the base branch from the upstream remote, and the PR branches
+// from the push remote when it is a different one.
 func (r *Repo) Fetch(ctx context.Context) error {
+	remotes := []string{GetUpstreamRemoteName()}
+	if IsForkWorkflow() {
+		remotes = append(remotes, GetPushRemoteName())
+	}
+	for _, remote := range remotes {
+		if err := r.fetch(ctx, remote); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repo) fetch(ctx context.Context, remote string) error {
 	ctx, cancel := context.WithTimeoutCause(
 		ctx, GetGithubTimeout(),
-		fmt.Errorf("fetch from %s too slow, increase github.timeout", GetRemoteName()),
+		fmt.Errorf("fetch from %s too slow, increase github.timeout", remote),
 	)
 	defer cancel()
 	// The --prune here is important : it removes the branches that have been deleted on github.
-	cmd := r.GitExec(ctx, "fetch --prune %s", GetRemoteName())
+	cmd := r.GitExec(ctx, "fetch --prune %s", remote)
 	return cmd.Run()
 }
 
 // When remote is true, rebase on the distant version of the branch. When false,
 // rebase on the local version.
 func (r *Repo) Rebase(ctx context.Context, branch Branch) error {
-	cmd := r.GitExec(ctx, "rebase %s/%s", GetRemoteName(), branch.RemoteName())
+	cmd := r.GitExec(ctx, "rebase %s", RemoteRef(branch))
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
@@ -324,7 +376,7 @@ func (r *Repo) Rebase(ctx context.Context, branch Branch) error {
 }
 
 func (r *Repo) TryRebaseCurrentBranchSilently(ctx context.Context, branch Branch) bool {
-	cmd := r.GitExec(ctx, "rebase %s/%s", GetRemoteName(), branch.RemoteName())
+	cmd := r.GitExec(ctx, "rebase %s", RemoteRef(branch))
 	err := cmd.Run()
 	if err == nil {
 		return true
@@ -341,7 +393,7 @@ func (r *Repo) TryRebaseOntoSilently(ctx context.Context, first string, onto Bra
 	if interactive {
 		interactiveString = "--interactive"
 	}
-	cmd := r.GitExec(ctx, "rebase %s --onto %s/%s %s^", interactiveString, GetRemoteName(), onto.RemoteName(), first)
+	cmd := r.GitExec(ctx, "rebase %s --onto %s %s^", interactiveString, RemoteRef(onto), first)
 	err := cmd.Run()
 	if err == nil {
 		return true
@@ -373,7 +425,7 @@ func (r *Repo) TryLocalRebaseOntoSilently(
 func (r *Repo) TryRebaseBranchOnto(ctx context.Context, parent string, onto Branch) bool {
 	ontoName := onto.LocalName()
 	if !onto.IsPr() {
-		ontoName = fmt.Sprintf("%s/%s", GetRemoteName(), onto.RemoteName())
+		ontoName = RemoteRef(onto)
 	}
 	cmd := r.GitExec(ctx, "rebase --onto %s %s", ontoName, parent)
 	err := cmd.Run()
@@ -390,7 +442,24 @@ func (r *Repo) TryRebaseBranchOnto(ctx context.Context, parent string, onto Bran
 // When remote is true, rebase on the distant version of the branch. When false,
 // rebase on the local version.
 func (r *Repo) InteractiveRebase(ctx context.Context, branch Branch) error {
-	cmd := r.GitExec(ctx, "rebase --no-fork-point -i %s/%s", GetRemoteName(), branch.RemoteName())
+	cmd := r.GitExec(ctx, "rebase --no-fork-point -i %s", RemoteRef(branch))
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// Edit opens file in the editor git uses for commit messages (GIT_EDITOR,
+// core.editor, VISUAL or EDITOR) and waits for it to be closed.
+func (r *Repo) Edit(ctx context.Context, file string) error {
+	editor, err := r.GitExec(ctx, "var GIT_EDITOR").Output()
+	if err != nil {
+		return fmt.Errorf("could not find which editor to use: %w", err)
+	}
+	// Like git, the editor is run by the shell and the file passed as an argument,
+	// so that the shell does not expand what is in its path.
+	cmd := exec.CommandContext(ctx, "bash", "-c", strings.TrimSpace(string(editor))+` "$@"`, "opp", file)
+	cmd.Dir = r.Path()
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
@@ -400,9 +469,8 @@ func (r *Repo) InteractiveRebase(ctx context.Context, branch Branch) error {
 func (r *Repo) SetTrackingBranch(localBranch Branch, remoteBranch Branch) error {
 	cmd := r.GitExec(
 		context.Background(),
-		"branch -u %s/%s %s",
-		GetRemoteName(),
-		remoteBranch.RemoteName(),
+		"branch -u %s %s",
+		RemoteRef(remoteBranch),
 		localBranch.LocalName())
 	cmd.Stderr = nil
 	cmd.Stdout = nil
@@ -459,7 +527,7 @@ func (r *Repo) GetLocalTip(b Branch) (string, error) {
 }
 
 func (r *Repo) GetRemoteTip(b Branch) (string, error) {
-	return r.GetRefHash(context.Background(), fmt.Sprintf("refs/remotes/%s/%s", GetRemoteName(), b.RemoteName()))
+	return r.GetRefHash(context.Background(), fmt.Sprintf("refs/remotes/%s", RemoteRef(b)))
 }
 
 // IsAncestor returns true if ancestor is an ancestor of descendant.
@@ -468,26 +536,69 @@ func (r *Repo) IsAncestor(ctx context.Context, ancestor, descendant string) bool
 	return cmd.Run() == nil
 }
 
-func (r *Repo) CleanupAfterMerge(ctx context.Context, pr *LocalPr) {
-	tip, err := r.GetLocalTip(pr)
+// CountCommits returns how many commits are ancestors of to but not of from.
+func (r *Repo) CountCommits(ctx context.Context, from, to string) (int, error) {
+	output, err := r.GitExec(ctx, "rev-list --count %s..%s", from, to).Output()
 	if err != nil {
-		fmt.Printf("could not find the tip of branch %s.\n", pr.LocalBranch())
-		return
+		return 0, fmt.Errorf("could not count the commits between %s and %s: %w", from, to, err)
 	}
-	fmt.Printf("Removing local branch %s. Tip was %s\n", pr.LocalBranch(), tip[0:7])
-	r.CleanupMultiple(ctx, []*LocalPr{pr}, r.AllPrs(ctx))
+	return strconv.Atoi(strings.TrimSpace(string(output)))
 }
 
-func (r *Repo) CleanupMultiple(ctx context.Context, toclean []*LocalPr, others []LocalPr) {
-	for _, possibleDependentPR := range others {
-		ancestor, _ := possibleDependentPR.GetAncestor()
+// ChangedFiles lists the files modified by the commits from oldest to newest, both included.
+func (r *Repo) ChangedFiles(ctx context.Context, oldest, newest string) ([]string, error) {
+	from, err := r.GetRefHash(ctx, oldest+"^")
+	if err != nil {
+		// oldest is the root commit: compare with the empty tree.
+		output, err := r.GitExec(ctx, "hash-object -t tree /dev/null").Output()
+		if err != nil {
+			return nil, fmt.Errorf("could not get the empty tree: %w", err)
+		}
+		from = strings.TrimSpace(string(output))
+	}
+	output, err := r.GitExec(ctx, "diff --name-only %s %s", from, newest).Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the files changed from %s to %s: %w", oldest, newest, err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// CleanupAfterMerge deletes the branches of pr, and returns the PRs that depended on it.
+func (r *Repo) CleanupAfterMerge(ctx context.Context, pr *LocalPr) ([]*LocalPr, error) {
+	tip, err := r.GetLocalTip(pr)
+	if err != nil {
+		// The branch is already gone, but the PRs that depend on it still need a new ancestor.
+		fmt.Printf("Forgetting %s, its local branch has been deleted\n", pr.LocalBranch())
+	} else {
+		fmt.Printf("Removing local branch %s. Tip was %s\n", pr.LocalBranch(), tip[0:7])
+	}
+	return r.CleanupMultiple(ctx, []*LocalPr{pr}, r.AllPrs(ctx))
+}
+
+// CleanupMultiple deletes the branches of the PRs in toclean, and makes the PRs
+// that depended on them depend on the base branch instead, locally and on the forge.
+// Returns these PRs.
+// Github closes the PRs whose base branch gets deleted, so their base is changed first.
+// When that fails, nothing is cleaned up and the error is returned.
+func (r *Repo) CleanupMultiple(ctx context.Context, toclean []*LocalPr, others []LocalPr) ([]*LocalPr, error) {
+	dependents := DependentPrs(toclean, others)
+	if r.retarget != nil && len(dependents) > 0 {
+		if err := r.retarget(ctx, dependents); err != nil {
+			var names []string
+			for _, deleting := range toclean {
+				names = append(names, deleting.LocalBranch())
+			}
+			return nil, fmt.Errorf("kept %s, the PRs that depend on it would be closed: %w", strings.Join(names, ", "), err)
+		}
+	}
+	for _, dependent := range dependents {
+		ancestor, _ := dependent.GetAncestor()
 		for _, deleting := range toclean {
 			if ancestor.LocalName() == deleting.LocalName() {
-				// This is a PR that depends on the PR we are currently cleaning.
 				// Make it point to the master branch
-				possibleDependentPR.SetAncestor(r.BaseBranch())
-				possibleDependentPR.SetKnownTipsFromAncestor(deleting)
-				r.SetTrackingBranch(&possibleDependentPR, r.BaseBranch())
+				dependent.SetAncestor(r.BaseBranch())
+				dependent.SetKnownTipsFromAncestor(deleting)
+				r.SetTrackingBranch(dependent, r.BaseBranch())
 			}
 		}
 	}
@@ -499,6 +610,26 @@ func (r *Repo) CleanupMultiple(ctx context.Context, toclean []*LocalPr, others [
 		r.DeleteLocalAndRemoteBranch(ctx, deleting)
 		deleting.DeleteState()
 	}
+	return dependents, nil
+}
+
+// DependentPrs returns the PRs of others that depend on one of the PRs of prs.
+func DependentPrs(prs []*LocalPr, others []LocalPr) []*LocalPr {
+	var dependents []*LocalPr
+	for _, possibleDependentPR := range others {
+		ancestor, err := possibleDependentPR.GetAncestor()
+		if err != nil {
+			continue
+		}
+		for _, pr := range prs {
+			if ancestor.LocalName() == pr.LocalName() {
+				dependent := possibleDependentPR
+				dependents = append(dependents, &dependent)
+				break
+			}
+		}
+	}
+	return dependents
 }
 
 func (r *Repo) DeleteLocalAndRemoteBranch(ctx context.Context, branch Branch) error {
@@ -509,10 +640,10 @@ func (r *Repo) DeleteLocalAndRemoteBranch(ctx context.Context, branch Branch) er
 func (r *Repo) DeleteRemoteBranch(ctx context.Context, branch Branch) error {
 	ctx, cancel := context.WithTimeoutCause(
 		ctx, GetGithubTimeout(),
-		fmt.Errorf("push to %s too slow, increase github.timeout", GetRemoteName()),
+		fmt.Errorf("push to %s too slow, increase github.timeout", branch.Remote()),
 	)
 	defer cancel()
-	cmd := r.GitExec(ctx, "%s %s :%s", GetPushCommand(), GetRemoteName(), branch.RemoteName())
+	cmd := r.GitExec(ctx, "%s %s :%s", GetPushCommand(), branch.Remote(), branch.RemoteName())
 	return cmd.Run()
 }
 
@@ -520,3 +651,106 @@ func (r *Repo) DetachHead(ctx context.Context) error {
 	cmd := r.GitExec(ctx, "checkout --detach HEAD")
 	return cmd.Run()
 }
+
+// RebaseInProgress returns true when git is in the middle of a rebase.
+func (r *Repo) RebaseInProgress(ctx context.Context) bool {
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		output, err := r.GitExec(ctx, "rev-parse --git-path %s", dir).Output()
+		if err != nil {
+			continue
+		}
+		gitPath := strings.TrimSpace(string(output))
+		if !path.IsAbs(gitPath) {
+			gitPath = path.Join(r.Path(), gitPath)
+		}
+		if FileExists(gitPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContinueRebase runs git rebase --continue, letting the user edit commit messages if needed.
+func (r *Repo) ContinueRebase(ctx context.Context) error {
+	cmd := r.GitExec(ctx, "rebase --continue")
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+func (r *Repo) AbortRebase(ctx context.Context) error {
+	return r.GitExec(ctx, "rebase --abort").Run()
+}
+
+// ResetBranch makes the local branch point to hash. The branch must not be checked out.
+func (r *Repo) ResetBranch(ctx context.Context, branch Branch, hash string) error {
+	return r.GitExec(ctx, "branch --force %s %s", branch.LocalName(), hash).Run()
+}
+
+// SupportsUpdateRefs returns true when git is recent enough to have git rebase --update-refs.
+func (r *Repo) SupportsUpdateRefs(ctx context.Context) bool {
+	output, err := r.GitExec(ctx, "version").Output()
+	if err != nil {
+		return false
+	}
+	// e.g. "git version 2.39.5" or "git version 2.39.3 (Apple Git-145)"
+	fields := strings.Fields(string(output))
+	if len(fields) < 3 {
+		return false
+	}
+	version := strings.SplitN(fields[2], ".", 3)
+	if len(version) < 2 {
+		return false
+	}
+	major, err1 := strconv.Atoi(version[0])
+	minor, err2 := strconv.Atoi(version[1])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return major > 2 || (major == 2 && minor >= 38)
+}
+
+// TryRebaseWithUpdateRefs rebases the current branch like TryRebaseBranchOnto, and also
+// moves the local branches that point to the rebased commits.
+func (r *Repo) TryRebaseWithUpdateRefs(ctx context.Context, parent string, onto Branch) bool {
+	ontoName := onto.LocalName()
+	if !onto.IsPr() {
+		ontoName = RemoteRef(onto)
+	}
+	cmd := r.GitExec(ctx, "rebase --update-refs --onto %s %s", ontoName, parent)
+	err := cmd.Run()
+	if err == nil {
+		return true
+	}
+	abort := r.GitExec(ctx, "rebase --abort")
+	if err := abort.Run(); err != nil {
+		panic(fmt.Errorf("tried to abort the rebase but failed: %w", err))
+	}
+	return false
+}
+
+// LocalBranchesBetween returns the tips of the local branches whose tip is one of the commits
+// that are ancestors of to but not of from, by branch name.
+func (r *Repo) LocalBranchesBetween(ctx context.Context, from, to string) (map[string]string, error) {
+	output, err := r.GitExec(ctx, "rev-list %s..%s", from, to).Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the commits between %s and %s: %w", from, to, err)
+	}
+	commits := make(map[string]bool)
+	for _, hash := range strings.Fields(string(output)) {
+		commits[hash] = true
+	}
+	output, err = r.GitExec(ctx, "for-each-ref '--format=%%(objectname) %%(refname:short)' refs/heads/").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list branches: %w", err)
+	}
+	branches := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		hash, name, found := strings.Cut(line, " ")
+		if found && commits[hash] {
+			branches[name] = hash
+		}
+	}
+	return branches, nil
+}
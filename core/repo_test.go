@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditDoesNotExpandThePath(t *testing.T) {
+	dir := path.Join(t.TempDir(), "a $HOME `echo b` $(echo c)")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	require.NoError(t, exec.Command("git", "init", "-q", dir).Run())
+	file := path.Join(dir, "message")
+	require.NoError(t, os.WriteFile(file, []byte("title\n"), 0644))
+	t.Setenv("GIT_EDITOR", "sed -i 's/title/edited/'")
+
+	require.NoError(t, NewRepo(dir).Edit(context.Background(), file))
+
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "edited\n", string(content))
+}
+
+func TestChangedFilesFromTheRootCommit(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Robot", "-c", "user.email=test@robot.com"}, args...)...)
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		return strings.TrimSpace(string(output))
+	}
+	git("init", "-q")
+	for _, file := range []string{"root", "second"} {
+		require.NoError(t, os.WriteFile(path.Join(dir, file), []byte(file), 0644))
+		git("add", file)
+		git("commit", "-q", "-m", file)
+	}
+	repo := NewRepo(dir)
+	ctx := context.Background()
+
+	files, err := repo.ChangedFiles(ctx, git("rev-parse", "HEAD^"), "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"root", "second"}, files)
+
+	files, err = repo.ChangedFiles(ctx, "HEAD", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"second"}, files)
+}
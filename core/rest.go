@@ -0,0 +1,76 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// restClient calls the json API of the forges that have no go client.
+type restClient struct {
+	// The name of the forge, for the error messages.
+	forge        string
+	apiUrl       string
+	authenticate func(*http.Request)
+}
+
+type forgeError struct {
+	Forge      string
+	StatusCode int
+	Message    string
+}
+
+func (e *forgeError) Error() string {
+	return fmt.Sprintf("%s answered %d: %s", e.Forge, e.StatusCode, e.Message)
+}
+
+// Sends body as json, and decodes the answer into result unless it is nil.
+func (c *restClient) call(ctx context.Context, method, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.apiUrl+path, reader)
+	if err != nil {
+		return err
+	}
+	c.authenticate(req)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var message struct {
+			Message any    `json:"message"`
+			Error   string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&message)
+		text := message.Error
+		if message.Message != nil {
+			text = fmt.Sprint(message.Message)
+		}
+		return &forgeError{Forge: c.forge, StatusCode: resp.StatusCode, Message: text}
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func isStatus(err error, status int) bool {
+	var forgeErr *forgeError
+	return errors.As(err, &forgeErr) && forgeErr.StatusCode == status
+}
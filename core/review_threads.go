@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+
+	"github.com/machinebox/graphql"
+)
+
+const reviewThreadsQuery = `
+query reviewThreads($owner: String!, $name: String!, $number: Int!, $after: String) {
+	repository(owner: $owner, name: $name) {
+		pullRequest(number: $number) {
+			reviewThreads(first: 100, after: $after) {
+				pageInfo {
+					hasNextPage
+					endCursor
+				}
+				nodes {
+					isResolved
+				}
+			}
+		}
+	}
+}
+`
+
+// GhReviewThreads reads the review threads of a PR. Whether a thread is
+// resolved is only available through the GraphQL API.
+type GhReviewThreads interface {
+	CountUnresolved(ctx context.Context, owner string, repo string, number int) (int, error)
+}
+
+type githubReviewThreads struct {
+	client *graphql.Client
+}
+
+type reviewThreadsResponse struct {
+	Repository struct {
+		PullRequest struct {
+			ReviewThreads struct {
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+				Nodes []struct {
+					IsResolved bool `json:"isResolved"`
+				} `json:"nodes"`
+			} `json:"reviewThreads"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+func (t *githubReviewThreads) CountUnresolved(ctx context.Context, owner string, repo string, number int) (int, error) {
+	unresolved := 0
+	var after *string
+	for {
+		req := graphql.NewRequest(reviewThreadsQuery)
+		req.Var("owner", owner)
+		req.Var("name", repo)
+		req.Var("number", number)
+		req.Var("after", after)
+		var resp reviewThreadsResponse
+		if err := t.client.Run(ctx, req, &resp); err != nil {
+			return 0, err
+		}
+		threads := resp.Repository.PullRequest.ReviewThreads
+		for _, thread := range threads.Nodes {
+			if !thread.IsResolved {
+				unresolved++
+			}
+		}
+		if !threads.PageInfo.HasNextPage {
+			return unresolved, nil
+		}
+		after = &threads.PageInfo.EndCursor
+	}
+}
@@ -2,6 +2,8 @@ package core
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path"
 	"strconv"
@@ -15,15 +17,31 @@ type BranchState struct {
 		KnownTips []string
 	}
 	KnownTips []string
+	// The branch of the PR on github, when it is not the one opp would have
+	// chosen, e.g. for PRs created without opp and adopted with opp adopt.
+	RemoteBranch string `yaml:"remote_branch,omitempty"`
+	// Set by opp merge --auto. The root of the chain has auto-merge enabled
+	// on github, the other PRs of the chain wait for their ancestor to be merged.
+	AutoMerge bool `yaml:"automerge,omitempty"`
+	// The labels and milestone opp has applied to the PR, so that they
+	// are not applied again if the user removes them on github.
+	Labels    []string `yaml:"labels,omitempty"`
+	Milestone string   `yaml:"milestone,omitempty"`
+	// The story of the PR, moved to done when the PR is merged.
+	Story string `yaml:"story,omitempty"`
 }
 
+var ErrCorruptState = errors.New("corrupt state")
+
 type StateStore struct {
-	baseFolder string
+	baseFolder    string
+	operationFile string
 }
 
 func NewStateStore(r *Repo) *StateStore {
 	return &StateStore{
-		baseFolder: path.Join(r.DotOpDir(), "state"),
+		baseFolder:    path.Join(r.DotOpDir(), "state"),
+		operationFile: path.Join(r.DotOpDir(), "operation"),
 	}
 }
 
@@ -38,7 +56,13 @@ func (s *StateStore) StateBranchFile(b Branch) string {
 func (s *StateStore) GetBranchState(b Branch) *BranchState {
 	var exists = FileExists(s.branchStateFile(b))
 	if exists {
-		return Must(s.loadBranchState(s.branchStateFile(b)))
+		state, err := s.loadBranchState(s.branchStateFile(b))
+		if err == nil {
+			return state
+		}
+		// Keep the file as it is for opp doctor, and carry on as if the branch had no state.
+		fmt.Fprintf(os.Stderr, "warning: %s, run opp doctor --fix\n", err)
+		return &BranchState{}
 	}
 	var newState = &BranchState{}
 	err := s.SaveBranchState(b, newState)
@@ -52,6 +76,18 @@ func (s *StateStore) DeleteBranchState(b Branch) {
 	_ = os.Remove(s.branchStateFile(b))
 }
 
+// SetAsideBranchState renames the state file of a branch so that it is not used anymore,
+// and returns the new name of the file.
+func (s *StateStore) SetAsideBranchState(b Branch) (string, error) {
+	file := s.branchStateFile(b) + ".corrupt"
+	return file, os.Rename(s.branchStateFile(b), file)
+}
+
+// LoadBranchState reads the state of a branch, without creating it when it does not exist.
+func (s *StateStore) LoadBranchState(b Branch) (*BranchState, error) {
+	return s.loadBranchState(s.branchStateFile(b))
+}
+
 func (s *StateStore) loadBranchState(file string) (*BranchState, error) {
 	content, err := os.ReadFile(file)
 	if err != nil {
@@ -60,12 +96,19 @@ func (s *StateStore) loadBranchState(file string) (*BranchState, error) {
 	state := BranchState{}
 	err = yaml.Unmarshal(content, &state)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w in %s: %s", ErrCorruptState, file, err)
 	}
 	return &state, nil
 }
 
+// SaveBranchState writes the state of a branch. A corrupt state file is never overwritten:
+// opp doctor --fix sets it aside so that what it contains can be recovered.
 func (s *StateStore) SaveBranchState(b Branch, state *BranchState) error {
+	if FileExists(s.branchStateFile(b)) {
+		if _, err := s.loadBranchState(s.branchStateFile(b)); errors.Is(err, ErrCorruptState) {
+			return err
+		}
+	}
 	content, err := yaml.Marshal(state)
 	if err != nil {
 		return err
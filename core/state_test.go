@@ -41,3 +41,31 @@ func TestStoresCorrectly(t *testing.T) {
 	require.NoError(t, err)
 	require.Contains(t, string(content), "name: main")
 }
+
+func TestCorruptStateDoesNotPanic(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "state_store")
+	require.NoError(t, err)
+	var s = StateStore{
+		baseFolder: dir,
+	}
+	var pr = &LocalPr{PrNumber: 1234}
+	require.NoError(t, os.MkdirAll(path.Join(dir, "pr"), 0700))
+	require.NoError(t, os.WriteFile(path.Join(dir, "pr", "1234"), []byte("ancestor: [unclosed"), 0600))
+
+	_, err = s.LoadBranchState(pr)
+	require.ErrorIs(t, err, ErrCorruptState)
+	state := s.GetBranchState(pr)
+	require.Equal(t, &BranchState{}, state)
+
+	// The corrupt file is kept for opp doctor, even when the state changes.
+	state.KnownTips = []string{"abcdef"}
+	require.ErrorIs(t, s.SaveBranchState(pr, state), ErrCorruptState)
+	content, err := os.ReadFile(path.Join(dir, "pr", "1234"))
+	require.NoError(t, err)
+	require.Equal(t, "ancestor: [unclosed", string(content))
+
+	_, err = s.SetAsideBranchState(pr)
+	require.NoError(t, err)
+	require.NoError(t, s.SaveBranchState(pr, state))
+}
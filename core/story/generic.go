@@ -0,0 +1,51 @@
+package story
+
+import (
+	"context"
+	"fmt"
+)
+
+// The http tool works with any tracker that can list the stories in progress as JSON:
+// story.api-url must return [{"identifier": "ABC-123", "title": "..."}], and
+// story.token, when set, is sent as a bearer token.
+func init() {
+	Register("http", Tool{
+		Title: "Story",
+		NewFetcher: func(config Config) (StoryFetcher, error) {
+			if err := requireConfig("the http story tool", map[string]string{"story.url": config.Url, "story.api-url": config.ApiUrl}); err != nil {
+				return nil, err
+			}
+			return NewHttpStoryFetcher(config), nil
+		},
+		StoryUrl: func(config Config, identifier string) string {
+			return fmt.Sprintf("%s/%s", config.Url, identifier)
+		},
+	})
+}
+
+type httpStoryFetcher struct {
+	readOnly
+	client restClient
+	apiUrl string
+}
+
+func NewHttpStoryFetcher(config Config) StoryFetcher {
+	return &httpStoryFetcher{
+		client: restClient{authenticate: bearer(config.Token)},
+		apiUrl: config.ApiUrl,
+	}
+}
+
+func (h *httpStoryFetcher) FetchInProgressStories(ctx context.Context) (stories []Story, err error) {
+	var resp []struct {
+		Identifier string `json:"identifier"`
+		Title      string `json:"title"`
+	}
+	if err := h.client.getJSON(ctx, h.apiUrl, &resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch stories from %s: %w", h.apiUrl, err)
+	}
+	for _, story := range resp {
+		stories = append(stories, Story{Title: story.Title, Identifier: story.Identifier})
+	}
+	return stories, nil
+}
@@ -0,0 +1,86 @@
+package story
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cupcicm/opp/core"
+)
+
+func init() {
+	Register("github", Tool{
+		Title:   "GitHub",
+		Pattern: `#\d+`,
+		NewFetcher: func(config Config) (StoryFetcher, error) {
+			if config.Token == "" {
+				// The issues are in the repo of the PRs, the github token can read them.
+				config.Token = core.GetGithubToken()
+			}
+			if err := requireConfig("github issues", map[string]string{"github.token": config.Token}); err != nil {
+				return nil, err
+			}
+			return NewGithubIssuesStoryFetcher(config, core.GetGithubRepo(), core.GetGithubUsername()), nil
+		},
+		StoryUrl: func(config Config, identifier string) string {
+			number := strings.TrimPrefix(identifier, "#")
+			if config.Url != "" {
+				return fmt.Sprintf("%s/%s", config.Url, number)
+			}
+			return fmt.Sprintf("%s/%s/issues/%s", core.GetGithubWebUrl(), core.GetGithubRepo(), number)
+		},
+	})
+}
+
+type githubIssuesStoryFetcher struct {
+	readOnly
+	client restClient
+	apiUrl string
+	repo   string
+	login  string
+}
+
+// NewGithubIssuesStoryFetcher finds the open issues of repo assigned to login.
+func NewGithubIssuesStoryFetcher(config Config, repo, login string) StoryFetcher {
+	apiUrl := config.ApiUrl
+	if apiUrl == "" {
+		apiUrl = strings.TrimSuffix(core.GetGithubApiUrl(), "/")
+	}
+	return &githubIssuesStoryFetcher{
+		client: restClient{authenticate: func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+config.Token)
+			req.Header.Set("Accept", "application/vnd.github+json")
+		}},
+		apiUrl: apiUrl,
+		repo:   repo,
+		login:  login,
+	}
+}
+
+type githubIssue struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	// Set when the issue is a pull request.
+	PullRequest *struct{} `json:"pull_request"`
+}
+
+func (g *githubIssuesStoryFetcher) FetchInProgressStories(ctx context.Context) (stories []Story, err error) {
+	query := url.Values{}
+	query.Set("assignee", g.login)
+	query.Set("state", "open")
+	query.Set("sort", "created")
+	query.Set("direction", "desc")
+	var issues []githubIssue
+	if err := g.client.getJSON(ctx, fmt.Sprintf("%s/repos/%s/issues?%s", g.apiUrl, g.repo, query.Encode()), &issues); err != nil {
+		return nil, fmt.Errorf("failed to fetch issues from github: %w", err)
+	}
+	for _, issue := range issues {
+		if issue.PullRequest != nil {
+			continue
+		}
+		stories = append(stories, Story{Title: issue.Title, Identifier: fmt.Sprintf("#%d", issue.Number)})
+	}
+	return stories, nil
+}
@@ -0,0 +1,75 @@
+package story
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// The issues assigned to me that are in progress, in any project.
+const jiraInProgressJql = `assignee = currentUser() AND statusCategory = "In Progress" ORDER BY created DESC`
+
+func init() {
+	Register("jira", Tool{
+		Title: "Jira",
+		NewFetcher: func(config Config) (StoryFetcher, error) {
+			if err := requireConfig("jira", map[string]string{"story.url": config.Url, "story.token": config.Token}); err != nil {
+				return nil, err
+			}
+			return NewJiraStoryFetcher(config), nil
+		},
+		StoryUrl: func(config Config, identifier string) string {
+			return fmt.Sprintf("%s/browse/%s", config.Url, identifier)
+		},
+	})
+}
+
+type jiraStoryFetcher struct {
+	readOnly
+	client restClient
+	apiUrl string
+}
+
+// NewJiraStoryFetcher uses the API of the Jira instance at story.url, unless story.api-url is set.
+// Jira cloud needs story.user, the email of the account the token belongs to; Jira server and data
+// center use the token alone.
+func NewJiraStoryFetcher(config Config) StoryFetcher {
+	apiUrl := config.ApiUrl
+	if apiUrl == "" {
+		apiUrl = config.Url
+	}
+	authenticate := bearer(config.Token)
+	if config.User != "" {
+		authenticate = func(req *http.Request) {
+			req.SetBasicAuth(config.User, config.Token)
+		}
+	}
+	return &jiraStoryFetcher{
+		client: restClient{authenticate: authenticate},
+		apiUrl: apiUrl,
+	}
+}
+
+type jiraSearchResponse struct {
+	Issues []struct {
+		Key    string `json:"key"`
+		Fields struct {
+			Summary string `json:"summary"`
+		} `json:"fields"`
+	} `json:"issues"`
+}
+
+func (j *jiraStoryFetcher) FetchInProgressStories(ctx context.Context) (stories []Story, err error) {
+	query := url.Values{}
+	query.Set("jql", jiraInProgressJql)
+	query.Set("fields", "summary")
+	var resp jiraSearchResponse
+	if err := j.client.getJSON(ctx, fmt.Sprintf("%s/rest/api/2/search?%s", j.apiUrl, query.Encode()), &resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch issues from jira: %w", err)
+	}
+	for _, issue := range resp.Issues {
+		stories = append(stories, Story{Title: issue.Fields.Summary, Identifier: issue.Key})
+	}
+	return stories, nil
+}
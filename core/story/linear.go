@@ -38,16 +38,35 @@ func (h AuthHeader) RoundTrip(req *http.Request) (*http.Response, error) {
 	return http.DefaultTransport.RoundTrip(req)
 }
 
-func newClient(token string) *graphqlRetryClient {
+func init() {
+	Register("linear", Tool{
+		Title: "Linear",
+		NewFetcher: func(config Config) (StoryFetcher, error) {
+			if err := requireConfig("linear", map[string]string{"story.url": config.Url, "story.token": config.Token}); err != nil {
+				return nil, err
+			}
+			endpoint := config.ApiUrl
+			if endpoint == "" {
+				endpoint = linearGraphqlEndpoint
+			}
+			return NewLinearStoryFetcher(endpoint, config.Token), nil
+		},
+		StoryUrl: func(config Config, identifier string) string {
+			return fmt.Sprintf("%s/%s", config.Url, identifier)
+		},
+	})
+}
+
+func newClient(endpoint, token string) *graphqlRetryClient {
 	opt := graphql.WithHTTPClient(&http.Client{Transport: AuthHeader{Token: token}})
 	return &graphqlRetryClient{
-		Client: graphql.NewClient(linearGraphqlEndpoint, opt),
+		Client: graphql.NewClient(endpoint, opt),
 	}
 }
 
-func NewLinearStoryFetcher(token string) StoryFetcher {
+func NewLinearStoryFetcher(endpoint, token string) StoryFetcher {
 	return &linearStoryFetcher{
-		client: newClient(token),
+		client: newClient(endpoint, token),
 	}
 }
 
@@ -95,3 +114,59 @@ func (l *linearStoryFetcher) FetchInProgressStories(ctx context.Context) (storie
 
 	return stories, nil
 }
+
+// Finds the internal id of the issue, and the id of the state called state in its team.
+func (l *linearStoryFetcher) findIssue(ctx context.Context, identifier, state string) (issueId string, stateId string, err error) {
+	req := graphql.NewRequest(linearIssueQuery)
+	req.Var("id", identifier)
+	req.Var("state", state)
+	var respData IssueResponseData
+	if err := l.client.Run(ctx, req, &respData); err != nil {
+		return "", "", fmt.Errorf("failed to find %s in linear: %w", identifier, err)
+	}
+	states := respData.Issue.Team.States.Nodes
+	if len(states) > 0 {
+		stateId = states[0].Id
+	}
+	return respData.Issue.Id, stateId, nil
+}
+
+func (l *linearStoryFetcher) MoveStory(ctx context.Context, identifier, state string) error {
+	issueId, stateId, err := l.findIssue(ctx, identifier, state)
+	if err != nil {
+		return err
+	}
+	if stateId == "" {
+		return fmt.Errorf("the team of %s has no state called %q", identifier, state)
+	}
+	req := graphql.NewRequest(linearIssueUpdateMutation)
+	req.Var("id", issueId)
+	req.Var("stateId", stateId)
+	var respData MutationResponseData
+	if err := l.client.Run(ctx, req, &respData); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", identifier, state, err)
+	}
+	if respData.IssueUpdate == nil || !respData.IssueUpdate.Success {
+		return fmt.Errorf("linear did not move %s to %s", identifier, state)
+	}
+	return nil
+}
+
+func (l *linearStoryFetcher) AttachLink(ctx context.Context, identifier, url, title string) error {
+	issueId, _, err := l.findIssue(ctx, identifier, "")
+	if err != nil {
+		return err
+	}
+	req := graphql.NewRequest(linearAttachmentLinkMutation)
+	req.Var("issueId", issueId)
+	req.Var("url", url)
+	req.Var("title", title)
+	var respData MutationResponseData
+	if err := l.client.Run(ctx, req, &respData); err != nil {
+		return fmt.Errorf("failed to link %s from %s: %w", url, identifier, err)
+	}
+	if respData.AttachmentLinkURL == nil || !respData.AttachmentLinkURL.Success {
+		return fmt.Errorf("linear did not link %s from %s", url, identifier)
+	}
+	return nil
+}
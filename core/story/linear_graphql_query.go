@@ -128,3 +128,64 @@ type Issue struct {
 	// Issue's human readable identifier (e.g. ABC-123).
 	Identifier string `json:"identifier"`
 }
+
+// The issue to update, and the workflow state of its team to move it to.
+
+const linearIssueQuery = `
+query issue ($id: String!, $state: String!) {
+	issue(id: $id) {
+		id
+		team {
+			states(filter: {name: {eqIgnoreCase: $state}}) {
+				nodes {
+					id
+					name
+				}
+			}
+		}
+	}
+}
+`
+
+type IssueResponseData struct {
+	Issue struct {
+		Id   string `json:"id"`
+		Team struct {
+			States struct {
+				Nodes []WorkflowState `json:"nodes"`
+			} `json:"states"`
+		} `json:"team"`
+	} `json:"issue"`
+}
+
+type WorkflowState struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// mutations
+
+const linearIssueUpdateMutation = `
+mutation issueUpdate ($id: String!, $stateId: String!) {
+	issueUpdate(id: $id, input: {stateId: $stateId}) {
+		success
+	}
+}
+`
+
+const linearAttachmentLinkMutation = `
+mutation attachmentLinkURL ($issueId: String!, $url: String!, $title: String) {
+	attachmentLinkURL(issueId: $issueId, url: $url, title: $title) {
+		success
+	}
+}
+`
+
+type MutationResponseData struct {
+	IssueUpdate       *MutationPayload `json:"issueUpdate,omitempty"`
+	AttachmentLinkURL *MutationPayload `json:"attachmentLinkURL,omitempty"`
+}
+
+type MutationPayload struct {
+	Success bool `json:"success"`
+}
@@ -0,0 +1,56 @@
+package story
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/avast/retry-go"
+)
+
+// restClient calls the JSON APIs of the story tools.
+type restClient struct {
+	// Sets the authentication headers of each request.
+	authenticate func(*http.Request)
+}
+
+// getJSON decodes the response of a GET on url into resp.
+func (c *restClient) getJSON(ctx context.Context, url string, resp any) error {
+	return retry.Do(
+		func() error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return retry.Unrecoverable(err)
+			}
+			req.Header.Set("Accept", "application/json")
+			c.authenticate(req)
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+				err := fmt.Errorf("GET %s: %s %s", url, res.Status, body)
+				if res.StatusCode < 500 {
+					return retry.Unrecoverable(err)
+				}
+				return err
+			}
+			return json.NewDecoder(res.Body).Decode(resp)
+		},
+		retry.Attempts(maxRetries),
+		retry.Context(ctx),
+		retry.LastErrorOnly(true),
+	)
+}
+
+func bearer(token string) func(*http.Request) {
+	return func(req *http.Request) {
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+}
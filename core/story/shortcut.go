@@ -0,0 +1,75 @@
+package story
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const shortcutApiUrl = "https://api.app.shortcut.com/api/v3"
+
+func init() {
+	Register("shortcut", Tool{
+		Title: "Shortcut",
+		NewFetcher: func(config Config) (StoryFetcher, error) {
+			if err := requireConfig("shortcut", map[string]string{"story.url": config.Url, "story.token": config.Token}); err != nil {
+				return nil, err
+			}
+			return NewShortcutStoryFetcher(config), nil
+		},
+		// story.url is the workspace, e.g. https://app.shortcut.com/my-company
+		StoryUrl: func(config Config, identifier string) string {
+			return fmt.Sprintf("%s/story/%s", config.Url, strings.TrimPrefix(strings.ToLower(identifier), "sc-"))
+		},
+	})
+}
+
+type shortcutStoryFetcher struct {
+	readOnly
+	client restClient
+	apiUrl string
+}
+
+func NewShortcutStoryFetcher(config Config) StoryFetcher {
+	apiUrl := config.ApiUrl
+	if apiUrl == "" {
+		apiUrl = shortcutApiUrl
+	}
+	return &shortcutStoryFetcher{
+		client: restClient{authenticate: func(req *http.Request) {
+			req.Header.Set("Shortcut-Token", config.Token)
+		}},
+		apiUrl: apiUrl,
+	}
+}
+
+type shortcutMember struct {
+	MentionName string `json:"mention_name"`
+}
+
+type shortcutSearchResponse struct {
+	Data []struct {
+		Id   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"data"`
+}
+
+func (s *shortcutStoryFetcher) FetchInProgressStories(ctx context.Context) (stories []Story, err error) {
+	var me shortcutMember
+	if err := s.client.getJSON(ctx, fmt.Sprintf("%s/member", s.apiUrl), &me); err != nil {
+		return nil, fmt.Errorf("failed to fetch the current member from shortcut: %w", err)
+	}
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("owner:%s is:started", me.MentionName))
+	var resp shortcutSearchResponse
+	if err := s.client.getJSON(ctx, fmt.Sprintf("%s/search/stories?%s", s.apiUrl, query.Encode()), &resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch stories from shortcut: %w", err)
+	}
+	for _, story := range resp.Data {
+		// The identifiers shortcut recognizes in branch names and PR titles.
+		stories = append(stories, Story{Title: story.Name, Identifier: fmt.Sprintf("sc-%d", story.Id)})
+	}
+	return stories, nil
+}
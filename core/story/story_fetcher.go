@@ -2,6 +2,13 @@ package story
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cupcicm/opp/core"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 type Story struct {
@@ -11,13 +18,106 @@ type Story struct {
 
 type StoryFetcher interface {
 	FetchInProgressStories(context.Context) ([]Story, error)
+	// MoveStory moves the story to the workflow state with this name.
+	MoveStory(ctx context.Context, identifier, state string) error
+	// AttachLink adds a link to url on the story.
+	AttachLink(ctx context.Context, identifier, url, title string) error
+}
+
+// ErrReadOnly is returned by the story tools that can only list the stories.
+var ErrReadOnly = errors.New("this story tool cannot update stories")
+
+// readOnly is embedded in the fetchers of the tools that cannot update stories (yet).
+type readOnly struct{}
+
+func (readOnly) MoveStory(context.Context, string, string) error {
+	return ErrReadOnly
+}
+
+func (readOnly) AttachLink(context.Context, string, string, string) error {
+	return ErrReadOnly
+}
+
+// Config is the configuration of the story tool, from the story.* keys.
+type Config struct {
+	// story.url: where the links to the stories point to.
+	Url string
+	// story.api-url: the API of the tool, when it is not the default one.
+	ApiUrl string
+	// story.token
+	Token string
+	// story.user: for the tools that authenticate with a user and a token.
+	User string
+}
+
+func LoadConfig() Config {
+	return Config{
+		Url:    strings.TrimSuffix(core.GetStoryToolUrl(), "/"),
+		ApiUrl: strings.TrimSuffix(core.GetStoryToolApiUrl(), "/"),
+		Token:  core.GetStoryToolToken(),
+		User:   core.GetStoryToolUser(),
+	}
+}
+
+// Tool is a story tracker opp can find stories in.
+type Tool struct {
+	// The name of the tool in the PR descriptions.
+	Title string
+	// The identifiers of the stories, storyPattern when empty.
+	Pattern string
+	// Creates the fetcher of the stories in progress, or says what is missing in the config.
+	NewFetcher func(Config) (StoryFetcher, error)
+	// The link to a story.
+	StoryUrl func(config Config, identifier string) string
 }
 
-func NewStoryFetcher(tool, token string) StoryFetcher {
-	switch tool {
-	case "linear":
-		return NewLinearStoryFetcher(token)
-	default:
-		panic("Story tool not supported to fetch stories")
+func (t Tool) pattern() string {
+	if t.Pattern == "" {
+		return storyPattern
+	}
+	return t.Pattern
+}
+
+var tools = make(map[string]Tool)
+
+// Register makes a story tool available in story.tool. Tools register themselves in init.
+func Register(name string, tool Tool) {
+	if _, found := tools[name]; found {
+		panic(fmt.Sprintf("story tool %s registered twice", name))
+	}
+	tools[name] = tool
+}
+
+func LookupTool(name string) (Tool, error) {
+	tool, found := tools[name]
+	if !found {
+		names := maps.Keys(tools)
+		slices.Sort(names)
+		return Tool{}, fmt.Errorf("story tool %q is not supported, use one of %s", name, strings.Join(names, ", "))
+	}
+	return tool, nil
+}
+
+func NewStoryFetcher(tool, token string) (StoryFetcher, error) {
+	t, err := LookupTool(tool)
+	if err != nil {
+		return nil, err
+	}
+	config := LoadConfig()
+	config.Token = token
+	return t.NewFetcher(config)
+}
+
+func requireConfig(tool string, values map[string]string) error {
+	var missing []string
+	for key, value := range values {
+		if value == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
 	}
+	slices.Sort(missing)
+	return fmt.Errorf("please set %s in the config to use %s", strings.Join(missing, " and "), tool)
 }
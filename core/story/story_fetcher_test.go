@@ -0,0 +1,302 @@
+package story
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cupcicm/opp/core"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Serves body as JSON at path, and keeps the request for the test to look at.
+func serve(t *testing.T, path string, body any) (*httptest.Server, *http.Request) {
+	var request http.Request
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		request = *r
+		require.NoError(t, json.NewEncoder(w).Encode(body))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &request
+}
+
+func TestUnknownTool(t *testing.T) {
+	_, err := NewStoryFetcher("trello", "token")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "github, http, jira, linear, shortcut")
+	}
+}
+
+func TestToolsSayWhatIsMissing(t *testing.T) {
+	jira, err := LookupTool("jira")
+	require.NoError(t, err)
+	_, err = jira.NewFetcher(Config{Url: "https://jira.example.com"})
+	assert.EqualError(t, err, "please set story.token in the config to use jira")
+}
+
+func TestLinear(t *testing.T) {
+	server, request := serve(t, "/graphql", map[string]any{
+		"data": map[string]any{
+			"issues": map[string]any{
+				"nodes": []map[string]string{{"identifier": "ABC-123", "title": "Linear story"}},
+			},
+		},
+	})
+	linear, err := LookupTool("linear")
+	require.NoError(t, err)
+	config := Config{Url: "https://linear.app/team/issue", ApiUrl: server.URL + "/graphql", Token: "lin_token"}
+	fetcher, err := linear.NewFetcher(config)
+	require.NoError(t, err)
+
+	stories, err := fetcher.FetchInProgressStories(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Story{{Title: "Linear story", Identifier: "ABC-123"}}, stories)
+	assert.Equal(t, "lin_token", request.Header.Get("Authorization"))
+	assert.Equal(t, "https://linear.app/team/issue/ABC-123", linear.StoryUrl(config, "ABC-123"))
+}
+
+func TestJira(t *testing.T) {
+	server, request := serve(t, "/rest/api/2/search", map[string]any{
+		"issues": []map[string]any{
+			{"key": "PROJ-42", "fields": map[string]string{"summary": "Jira story"}},
+		},
+	})
+	jira, err := LookupTool("jira")
+	require.NoError(t, err)
+	config := Config{Url: "https://jira.example.com", ApiUrl: server.URL, Token: "jira_token", User: "me@example.com"}
+	fetcher, err := jira.NewFetcher(config)
+	require.NoError(t, err)
+
+	stories, err := fetcher.FetchInProgressStories(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Story{{Title: "Jira story", Identifier: "PROJ-42"}}, stories)
+	assert.Equal(t, jiraInProgressJql, request.URL.Query().Get("jql"))
+	user, password, ok := request.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "me@example.com", user)
+	assert.Equal(t, "jira_token", password)
+	assert.Equal(t, "https://jira.example.com/browse/PROJ-42", jira.StoryUrl(config, "PROJ-42"))
+}
+
+func TestJiraServerUsesBearerToken(t *testing.T) {
+	server, request := serve(t, "/rest/api/2/search", map[string]any{"issues": []any{}})
+	fetcher := NewJiraStoryFetcher(Config{Url: server.URL, Token: "pat"})
+
+	stories, err := fetcher.FetchInProgressStories(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, stories)
+	assert.Equal(t, "Bearer pat", request.Header.Get("Authorization"))
+}
+
+func TestGithubIssues(t *testing.T) {
+	viper.Set("repo.github", "cupcicm/opp")
+	viper.Set("github.login", "cupcicm")
+	viper.Set("github.token", "gh_token")
+	core.ForgetResolvedTokens()
+	server, request := serve(t, "/repos/cupcicm/opp/issues", []map[string]any{
+		{"number": 12, "title": "An issue"},
+		{"number": 13, "title": "A PR", "pull_request": map[string]string{}},
+	})
+	github, err := LookupTool("github")
+	require.NoError(t, err)
+	config := Config{ApiUrl: server.URL}
+	fetcher, err := github.NewFetcher(config)
+	require.NoError(t, err)
+
+	stories, err := fetcher.FetchInProgressStories(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Story{{Title: "An issue", Identifier: "#12"}}, stories)
+	assert.Equal(t, "cupcicm", request.URL.Query().Get("assignee"))
+	assert.Equal(t, "open", request.URL.Query().Get("state"))
+	assert.Equal(t, "Bearer gh_token", request.Header.Get("Authorization"))
+	assert.Equal(t, "https://github.com/cupcicm/opp/issues/12", github.StoryUrl(config, "#12"))
+}
+
+func TestShortcut(t *testing.T) {
+	var searched http.Request
+	mux := http.NewServeMux()
+	mux.HandleFunc("/member", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "sc_token", r.Header.Get("Shortcut-Token"))
+		json.NewEncoder(w).Encode(map[string]string{"mention_name": "alice"})
+	})
+	mux.HandleFunc("/search/stories", func(w http.ResponseWriter, r *http.Request) {
+		searched = *r
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": []map[string]any{{"id": 789, "name": "Shortcut story"}},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	shortcut, err := LookupTool("shortcut")
+	require.NoError(t, err)
+	config := Config{Url: "https://app.shortcut.com/acme", ApiUrl: server.URL, Token: "sc_token"}
+	fetcher, err := shortcut.NewFetcher(config)
+	require.NoError(t, err)
+
+	stories, err := fetcher.FetchInProgressStories(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Story{{Title: "Shortcut story", Identifier: "sc-789"}}, stories)
+	assert.Equal(t, "owner:alice is:started", searched.URL.Query().Get("query"))
+	assert.Equal(t, "https://app.shortcut.com/acme/story/789", shortcut.StoryUrl(config, "sc-789"))
+}
+
+func TestGenericHttp(t *testing.T) {
+	server, request := serve(t, "/mine", []map[string]string{{"identifier": "T-1", "title": "Task"}})
+	tool, err := LookupTool("http")
+	require.NoError(t, err)
+	config := Config{Url: "https://tracker.example.com/tasks", ApiUrl: server.URL + "/mine", Token: "secret"}
+	fetcher, err := tool.NewFetcher(config)
+	require.NoError(t, err)
+
+	stories, err := fetcher.FetchInProgressStories(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Story{{Title: "Task", Identifier: "T-1"}}, stories)
+	assert.Equal(t, "Bearer secret", request.Header.Get("Authorization"))
+	assert.Equal(t, "https://tracker.example.com/tasks/T-1", tool.StoryUrl(config, "T-1"))
+}
+
+func TestErrorsAreReported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	fetcher := NewHttpStoryFetcher(Config{ApiUrl: server.URL})
+
+	_, err := fetcher.FetchInProgressStories(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "401 Unauthorized bad token")
+	}
+}
+
+func TestGithubIssuesPattern(t *testing.T) {
+	viper.Set("repo.github", "cupcicm/opp")
+	viper.Set("story.tool", "github")
+	viper.Set("story.url", "")
+	viper.Set("story.token", "")
+	defer viper.Set("story.tool", "")
+	service, err := NewStoryService(func(string, string) (StoryFetcher, error) {
+		return nil, nil
+	}, nil)
+	require.NoError(t, err)
+
+	title, story, link, err := service.FindStory(context.Background(), nil, "[#12] Fix the thing")
+	require.NoError(t, err)
+	assert.Equal(t, "[#12] Fix the thing", title)
+	assert.Equal(t, "#12", story)
+	assert.Equal(t, "GitHub [#12](https://github.com/cupcicm/opp/issues/12)", link)
+}
+
+// A fake linear API: answers the issue query and records the mutations.
+func fakeLinear(t *testing.T) (*httptest.Server, *[]map[string]any) {
+	var mutations []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		var data any
+		switch {
+		case strings.Contains(req.Query, "issue(id: $id)"):
+			assert.Equal(t, "ABC-123", req.Variables["id"])
+			var states []map[string]string
+			if strings.EqualFold(req.Variables["state"].(string), "in review") {
+				states = append(states, map[string]string{"id": "state-review", "name": "In Review"})
+			}
+			data = map[string]any{"issue": map[string]any{
+				"id":   "issue-uuid",
+				"team": map[string]any{"states": map[string]any{"nodes": states}},
+			}}
+		case strings.Contains(req.Query, "issueUpdate("):
+			mutations = append(mutations, req.Variables)
+			data = map[string]any{"issueUpdate": map[string]bool{"success": true}}
+		case strings.Contains(req.Query, "attachmentLinkURL("):
+			mutations = append(mutations, req.Variables)
+			data = map[string]any{"attachmentLinkURL": map[string]bool{"success": true}}
+		default:
+			t.Errorf("unexpected query %s", req.Query)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(server.Close)
+	return server, &mutations
+}
+
+func TestLinearMovesStory(t *testing.T) {
+	server, mutations := fakeLinear(t)
+	fetcher := NewLinearStoryFetcher(server.URL, "lin_token")
+
+	require.NoError(t, fetcher.MoveStory(context.Background(), "ABC-123", "in review"))
+	assert.Equal(t, []map[string]any{{"id": "issue-uuid", "stateId": "state-review"}}, *mutations)
+
+	err := fetcher.MoveStory(context.Background(), "ABC-123", "Shipped")
+	assert.EqualError(t, err, `the team of ABC-123 has no state called "Shipped"`)
+	assert.Len(t, *mutations, 1)
+}
+
+func TestLinearAttachesLink(t *testing.T) {
+	server, mutations := fakeLinear(t)
+	fetcher := NewLinearStoryFetcher(server.URL, "lin_token")
+
+	require.NoError(t, fetcher.AttachLink(context.Background(), "ABC-123", "https://github.com/cupcicm/opp/pull/2", "[ABC-123] my title"))
+	assert.Equal(t, []map[string]any{{
+		"issueId": "issue-uuid",
+		"url":     "https://github.com/cupcicm/opp/pull/2",
+		"title":   "[ABC-123] my title",
+	}}, *mutations)
+}
+
+func TestReadOnlyToolsAreSkipped(t *testing.T) {
+	viper.Set("story.tool", "http")
+	viper.Set("story.url", "https://tracker.example.com/tasks")
+	viper.Set("story.api-url", "https://tracker.example.com/api/mine")
+	defer func() {
+		viper.Set("story.tool", "")
+		viper.Set("story.url", "")
+		viper.Set("story.api-url", "")
+	}()
+	service, err := NewStoryService(NewStoryFetcher, nil)
+	require.NoError(t, err)
+
+	assert.NoError(t, service.StartReview(context.Background(), "T-1", "https://github.com/cupcicm/opp/pull/2", "title"))
+	assert.NoError(t, service.Finish(context.Background(), "T-1"))
+}
+
+// Cannot move the stories, and fails to attach links for another reason.
+type cannotMoveStories struct {
+	readOnly
+}
+
+func (cannotMoveStories) FetchInProgressStories(context.Context) ([]Story, error) {
+	return nil, nil
+}
+
+func (cannotMoveStories) AttachLink(context.Context, string, string, string) error {
+	return errors.New("link rejected")
+}
+
+func TestReadOnlyDoesNotHideOtherErrors(t *testing.T) {
+	viper.Set("story.tool", "http")
+	viper.Set("story.url", "https://tracker.example.com/tasks")
+	defer func() {
+		viper.Set("story.tool", "")
+		viper.Set("story.url", "")
+	}()
+	service, err := NewStoryService(func(string, string) (StoryFetcher, error) {
+		return cannotMoveStories{}, nil
+	}, nil)
+	require.NoError(t, err)
+
+	err = service.StartReview(context.Background(), "T-1", "https://github.com/cupcicm/opp/pull/2", "title")
+	if assert.Error(t, err) {
+		assert.Equal(t, "link rejected", err.Error())
+	}
+}
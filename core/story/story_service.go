@@ -11,73 +11,142 @@ import (
 	"strings"
 
 	"github.com/cupcicm/opp/core"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 )
 
 const storyPattern = `\w+[-_]\d+`
 
-var storyPatternWithBrackets = fmt.Sprintf(`\[%s\]`, storyPattern)
+var storyPatternWithBrackets = withBrackets(storyPattern)
+
+func withBrackets(pattern string) string {
+	return fmt.Sprintf(`\[%s\]`, pattern)
+}
 
 type StoryService interface {
-	EnrichBodyAndTitle(ctx context.Context, commitMessages []string, rawTitle, rawBody string) (title, body string, err error)
+	EnrichBodyAndTitle(ctx context.Context, commitMessages []string, rawTitle, rawBody string) (title, body, story string, err error)
+	// FindStory enriches the title like EnrichBodyAndTitle, but returns the story and a
+	// markdown link to it instead of adding them to the body, for PR templates to use.
+	FindStory(ctx context.Context, commitMessages []string, rawTitle string) (title, story, link string, err error)
+	// StartReview moves the story to story.states.in-review, and links the PR from it.
+	StartReview(ctx context.Context, story, prUrl, prTitle string) error
+	// Finish moves the story to story.states.done.
+	Finish(ctx context.Context, story string) error
 }
 
-func NewStoryService(storyFetcher func(string, string) StoryFetcher, in io.Reader) StoryService {
+func NewStoryService(storyFetcher func(string, string) (StoryFetcher, error), in io.Reader) (StoryService, error) {
 	tool := core.GetStoryTool()
-	url := core.GetStoryToolUrl()
-	token := core.GetStoryToolToken()
+	if tool == "" {
+		// A token in the environment may be meant for another tool, only the config tells.
+		if core.GetStoryToolUrl() != "" || core.GetStoryToolConfigToken() != "" {
+			return nil, errors.New("please set story.tool in the config")
+		}
+		return &StoryServiceNoop{}, nil
+	}
+	config := LoadConfig()
 
-	if tool == "" && url == "" && token == "" {
-		return &StoryServiceNoop{}
+	t, err := LookupTool(tool)
+	if err != nil {
+		return nil, err
 	}
 
-	if tool == "" || url == "" || token == "" {
-		panic("please fill in all Story fields in the config (story.tool, story.url and story.token)")
+	re, err := regexp.Compile(t.pattern())
+	if err != nil {
+		return nil, fmt.Errorf("the stories pattern of %s doesn't compile: %w", tool, err)
 	}
 
-	re, err := regexp.Compile(storyPattern)
+	reWithBrackets, err := regexp.Compile(withBrackets(t.pattern()))
 	if err != nil {
-		panic("storyPattern regexp doesn't compile")
+		return nil, fmt.Errorf("the stories pattern of %s doesn't compile: %w", tool, err)
 	}
 
-	reWithBrackets, err := regexp.Compile(storyPatternWithBrackets)
+	fetcher, err := storyFetcher(tool, config.Token)
 	if err != nil {
-		panic("storyPatternWithBrackets regexp doesn't compile")
+		return nil, err
 	}
 
 	return &StoryServiceEnabled{
 		re:             re,
 		reWithBrackets: reWithBrackets,
-		tool:           tool,
-		url:            url,
-		storyFetcher:   storyFetcher(tool, token),
+		tool:           t,
+		config:         config,
+		storyFetcher:   fetcher,
 		in:             in,
-	}
+	}, nil
 }
 
 type StoryServiceNoop struct{}
 
-func (s *StoryServiceNoop) EnrichBodyAndTitle(_ context.Context, _ []string, rawTitle, rawBody string) (title, body string, err error) {
-	return rawTitle, rawBody, nil
+func (s *StoryServiceNoop) EnrichBodyAndTitle(_ context.Context, _ []string, rawTitle, rawBody string) (title, body, story string, err error) {
+	return rawTitle, rawBody, "", nil
+}
+
+func (s *StoryServiceNoop) FindStory(_ context.Context, _ []string, rawTitle string) (title, story, link string, err error) {
+	return rawTitle, "", "", nil
+}
+
+func (s *StoryServiceNoop) StartReview(_ context.Context, _, _, _ string) error {
+	return nil
+}
+
+func (s *StoryServiceNoop) Finish(_ context.Context, _ string) error {
+	return nil
 }
 
 type StoryServiceEnabled struct {
 	re             *regexp.Regexp
 	reWithBrackets *regexp.Regexp
-	tool           string
-	url            string
+	tool           Tool
+	config         Config
 	storyFetcher   StoryFetcher
 	in             io.Reader
 }
 
-func (s *StoryServiceEnabled) EnrichBodyAndTitle(ctx context.Context, commitMessages []string, rawTitle, rawBody string) (title, body string, err error) {
-	story, title := s.getStoryAndEnrichTitle(ctx, s.in, commitMessages, rawTitle)
+func (s *StoryServiceEnabled) EnrichBodyAndTitle(ctx context.Context, commitMessages []string, rawTitle, rawBody string) (title, body, story string, err error) {
+	story, title = s.getStoryAndEnrichTitle(ctx, s.in, commitMessages, rawTitle)
 	body, err = s.enrichBody(rawBody, story)
 	if err != nil {
-		return "", "", err
+		return "", "", "", err
+	}
+	return title, body, story, nil
+}
+
+func (s *StoryServiceEnabled) FindStory(ctx context.Context, commitMessages []string, rawTitle string) (title, story, link string, err error) {
+	story, title = s.getStoryAndEnrichTitle(ctx, s.in, commitMessages, rawTitle)
+	if story == "" {
+		return title, "", "", nil
+	}
+	link, err = s.formatBodyInPRTitle(story)
+	if err != nil {
+		return "", "", "", err
+	}
+	return title, story, link, nil
+}
+
+func (s *StoryServiceEnabled) StartReview(ctx context.Context, story, prUrl, prTitle string) error {
+	var errs []error
+	if state := core.GetStoryInReviewState(); state != "" {
+		errs = append(errs, ignoreReadOnly(s.storyFetcher.MoveStory(ctx, story, state)))
+	}
+	if core.LinkPrFromStoryEnabled() {
+		errs = append(errs, ignoreReadOnly(s.storyFetcher.AttachLink(ctx, story, prUrl, prTitle)))
+	}
+	// Filtered one by one: errors.Is would find ErrReadOnly in any of the joined errors.
+	return errors.Join(errs...)
+}
+
+func (s *StoryServiceEnabled) Finish(ctx context.Context, story string) error {
+	state := core.GetStoryDoneState()
+	if state == "" {
+		return nil
+	}
+	return ignoreReadOnly(s.storyFetcher.MoveStory(ctx, story, state))
+}
+
+// The tools that cannot update stories are not an error, there is just nothing to do.
+func ignoreReadOnly(err error) error {
+	if errors.Is(err, ErrReadOnly) {
+		return nil
 	}
-	return title, body, nil
+	return err
 }
 
 func (s *StoryServiceEnabled) getStoryAndEnrichTitle(ctx context.Context, in io.Reader, commitMessages []string, rawTitle string) (story, title string) {
@@ -207,7 +276,7 @@ func (s *StoryServiceEnabled) enrichBody(rawBody, story string) (string, error)
 }
 
 func (s *StoryServiceEnabled) formatBodyInPRTitle(story string) (string, error) {
-	url := fmt.Sprintf("%s/%s", s.url, story)
+	url := s.tool.StoryUrl(s.config, story)
 
-	return fmt.Sprintf("%s [%s](%s)", cases.Title(language.Und).String(s.tool), story, url), nil
+	return fmt.Sprintf("%s [%s](%s)", s.tool.Title, story, url), nil
 }
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"text/template"
+)
+
+// The places where github looks for a PR template, in order.
+var prTemplateLocations = []string{
+	".github/pull_request_template.md",
+	".github/PULL_REQUEST_TEMPLATE.md",
+	"pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md",
+	"docs/pull_request_template.md",
+	"docs/PULL_REQUEST_TEMPLATE.md",
+}
+
+// PrTemplateData holds the placeholders available in PR body templates.
+type PrTemplateData struct {
+	// The body of the longest commit message, which opp uses as the PR body without template.
+	LongestMessage string
+	// A bulleted list of the subjects of the commits in the PR, oldest first.
+	Commits string
+	// The story of the PR (e.g. ABC-123) and a markdown link to it.
+	Story     string
+	StoryLink string
+	// A bulleted list of the PRs this PR depends on, root of the chain first.
+	Chain string
+}
+
+// LoadPrTemplate reads the template configured in pr.template, or the PR template of github.
+// Returns nil when there is none.
+// The template of github is written for its web UI and may contain {{ for other reasons:
+// when it is not a valid opp template, it is ignored.
+func (r *Repo) LoadPrTemplate() (*template.Template, error) {
+	if configured := GetPrTemplate(); configured != "" {
+		content, err := os.ReadFile(path.Join(r.Path(), configured))
+		if err != nil {
+			return nil, err
+		}
+		return template.New(configured).Parse(string(content))
+	}
+	for _, location := range prTemplateLocations {
+		content, err := os.ReadFile(path.Join(r.Path(), location))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(location).Parse(string(content))
+		if err == nil {
+			err = tmpl.Execute(io.Discard, PrTemplateData{})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: ignoring %s, it is not a valid template (%s). Set pr.template to use it anyway.\n", location, err)
+			return nil, nil
+		}
+		return tmpl, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// FakeGitea stands in for the API of a gitea instance hosting cupcicm/opp.
+// It also points the config of opp to it.
+type FakeGitea struct {
+	*httptest.Server
+	mu           sync.Mutex
+	PullRequests map[int]*FakeGiteaPr
+	// The issues, which share their numbers with the PRs.
+	Issues []int
+	Notes  map[int][]string
+	// The merge style of each merged PR.
+	MergeStyles map[int]string
+}
+
+type FakeGiteaPr struct {
+	Number         int    `json:"number"`
+	Title          string `json:"title"`
+	Body           string `json:"body"`
+	State          string `json:"state"`
+	Merged         bool   `json:"merged"`
+	Mergeable      bool   `json:"mergeable"`
+	MergeCommitSha string `json:"merge_commit_sha,omitempty"`
+	Head           struct {
+		Ref string `json:"ref"`
+		Sha string `json:"sha"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+func NewFakeGitea(t *testing.T, prs ...*FakeGiteaPr) *FakeGitea {
+	g := &FakeGitea{
+		PullRequests: make(map[int]*FakeGiteaPr),
+		Notes:        make(map[int][]string),
+		MergeStyles:  make(map[int]string),
+	}
+	for _, pr := range prs {
+		g.PullRequests[pr.Number] = pr
+	}
+	g.Server = httptest.NewServer(http.HandlerFunc(g.serve))
+	t.Cleanup(g.Close)
+	viper.Set("forge.type", "gitea")
+	viper.Set("gitea.host", g.URL)
+	viper.Set("gitea.token", "my gitea token")
+	return g
+}
+
+func (g *FakeGitea) serve(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if r.URL.Path == "/api/v1/version" {
+		json.NewEncoder(w).Encode(map[string]string{"version": "1.21.0"})
+		return
+	}
+	if r.Header.Get("Authorization") != "token my gitea token" {
+		http.Error(w, `{"message": "token is required"}`, http.StatusUnauthorized)
+		return
+	}
+	path, found := strings.CutPrefix(r.URL.Path, "/api/v1/repos/cupcicm/opp/")
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(path, "/")
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+	switch {
+	case path == "issues" && r.Method == http.MethodGet:
+		issues := []map[string]int{}
+		if last := g.lastNumber(); last != 0 {
+			issues = append(issues, map[string]int{"number": last})
+		}
+		json.NewEncoder(w).Encode(issues)
+		return
+	case path == "pulls" && r.Method == http.MethodPost:
+		pr := &FakeGiteaPr{
+			Number: g.lastNumber() + 1,
+			Title:  body["title"].(string),
+			Body:   body["body"].(string),
+			State:  "open",
+		}
+		pr.Head.Ref = body["head"].(string)
+		pr.Base.Ref = body["base"].(string)
+		g.PullRequests[pr.Number] = pr
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(pr)
+		return
+	case len(parts) == 3 && parts[0] == "issues" && parts[2] == "comments" && r.Method == http.MethodPost:
+		number, _ := strconv.Atoi(parts[1])
+		g.Notes[number] = append(g.Notes[number], body["body"].(string))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+		return
+	case len(parts) < 2 || parts[0] != "pulls":
+		http.NotFound(w, r)
+		return
+	}
+	number, _ := strconv.Atoi(parts[1])
+	pr, found := g.PullRequests[number]
+	if !found {
+		http.Error(w, `{"message": "pull request does not exist"}`, http.StatusNotFound)
+		return
+	}
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(pr)
+	case len(parts) == 2 && r.Method == http.MethodPatch:
+		if base, ok := body["base"].(string); ok {
+			pr.Base.Ref = base
+		}
+		json.NewEncoder(w).Encode(pr)
+	case len(parts) == 3 && parts[2] == "merge" && r.Method == http.MethodPost:
+		if body["head_commit_id"] != pr.Head.Sha {
+			http.Error(w, `{"message": "head out of date"}`, http.StatusConflict)
+			return
+		}
+		if !pr.Mergeable {
+			http.Error(w, `{"message": "please try again later"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		pr.State = "closed"
+		pr.Merged = true
+		pr.MergeCommitSha = pr.Head.Sha
+		g.MergeStyles[number] = body["Do"].(string)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (g *FakeGitea) lastNumber() int {
+	last := 0
+	for number := range g.PullRequests {
+		last = max(last, number)
+	}
+	for _, number := range g.Issues {
+		last = max(last, number)
+	}
+	return last
+}
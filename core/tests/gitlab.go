@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// FakeGitlab stands in for the merge requests API of the gitlab project cupcicm/opp.
+// It also points the config of opp to it.
+type FakeGitlab struct {
+	*httptest.Server
+	mu            sync.Mutex
+	MergeRequests map[int]*FakeMergeRequest
+	Notes         map[int][]string
+}
+
+type FakeMergeRequest struct {
+	Iid                 int    `json:"iid"`
+	Title               string `json:"title"`
+	Description         string `json:"description"`
+	State               string `json:"state"`
+	SourceBranch        string `json:"source_branch"`
+	TargetBranch        string `json:"target_branch"`
+	Sha                 string `json:"sha"`
+	MergeCommitSha      string `json:"merge_commit_sha,omitempty"`
+	DetailedMergeStatus string `json:"detailed_merge_status"`
+}
+
+func NewFakeGitlab(t *testing.T, mergeRequests ...*FakeMergeRequest) *FakeGitlab {
+	g := &FakeGitlab{
+		MergeRequests: make(map[int]*FakeMergeRequest),
+		Notes:         make(map[int][]string),
+	}
+	for _, mr := range mergeRequests {
+		g.MergeRequests[mr.Iid] = mr
+	}
+	g.Server = httptest.NewServer(http.HandlerFunc(g.serve))
+	t.Cleanup(g.Close)
+	viper.Set("forge.type", "gitlab")
+	viper.Set("gitlab.host", g.URL)
+	viper.Set("gitlab.token", "my gitlab token")
+	return g
+}
+
+func (g *FakeGitlab) serve(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	const project = "/api/v4/projects/cupcicm%2Fopp/"
+	if r.Header.Get("PRIVATE-TOKEN") != "my gitlab token" {
+		http.Error(w, `{"message": "401 Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	path, found := strings.CutPrefix(r.URL.EscapedPath(), project)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(path, "/")
+	if parts[0] != "merge_requests" {
+		http.NotFound(w, r)
+		return
+	}
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			mrs := []*FakeMergeRequest{}
+			if last := g.lastIid(); last != 0 {
+				mrs = append(mrs, g.MergeRequests[last])
+			}
+			json.NewEncoder(w).Encode(mrs)
+		case http.MethodPost:
+			mr := &FakeMergeRequest{
+				Iid:                 g.lastIid() + 1,
+				Title:               body["title"].(string),
+				Description:         body["description"].(string),
+				State:               "opened",
+				SourceBranch:        body["source_branch"].(string),
+				TargetBranch:        body["target_branch"].(string),
+				DetailedMergeStatus: "checking",
+			}
+			g.MergeRequests[mr.Iid] = mr
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(mr)
+		}
+		return
+	}
+	iid, _ := strconv.Atoi(parts[1])
+	mr, found := g.MergeRequests[iid]
+	if !found {
+		http.Error(w, `{"message": "404 Not found"}`, http.StatusNotFound)
+		return
+	}
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(mr)
+	case len(parts) == 2 && r.Method == http.MethodPut:
+		if target, ok := body["target_branch"].(string); ok {
+			mr.TargetBranch = target
+		}
+		json.NewEncoder(w).Encode(mr)
+	case len(parts) == 3 && parts[2] == "merge" && r.Method == http.MethodPut:
+		if body["sha"] != mr.Sha {
+			http.Error(w, `{"message": "SHA does not match HEAD of source branch"}`, http.StatusConflict)
+			return
+		}
+		mr.State = "merged"
+		mr.MergeCommitSha = mr.Sha
+		json.NewEncoder(w).Encode(mr)
+	case len(parts) == 3 && parts[2] == "notes" && r.Method == http.MethodPost:
+		g.Notes[iid] = append(g.Notes[iid], body["body"].(string))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (g *FakeGitlab) lastIid() int {
+	last := 0
+	for iid := range g.MergeRequests {
+		last = max(last, iid)
+	}
+	return last
+}
@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cupcicm/opp/cmd"
 	"github.com/cupcicm/opp/core"
@@ -32,8 +33,10 @@ type Paths struct {
 
 type TestRepo struct {
 	*core.Repo
-	Source           *git.Repository
-	GithubRepo       *git.Repository
+	Source     *git.Repository
+	GithubRepo *git.Repository
+	// Where the PR branches are pushed, when they are pushed to a fork.
+	Fork             *git.Repository
 	Paths            Paths
 	GithubMock       *GithubMock
 	StoryFetcherMock *StoryFetcherMock
@@ -43,13 +46,33 @@ type TestRepo struct {
 }
 
 func setConfig() {
+	// Only the tokens set here, not the ones of whoever runs the tests.
+	viper.Set("credentials.providers", []string{"config"})
 	viper.Set("github.login", "cupcicm")
+	viper.Set("github.token", "my github token")
+	viper.Set("github.host", "github.com")
+	viper.Set("forge.type", "github")
+	viper.Set("gitlab.host", "gitlab.com")
+	viper.Set("gitlab.token", "")
+	viper.Set("gitea.host", "")
+	viper.Set("gitea.token", "")
+	viper.Set("github.merge.method", "rebase")
+	viper.Set("github.checks.grace-period", time.Minute)
 	viper.Set("repo.branch", "master")
 	viper.Set("repo.github", "cupcicm/opp")
 	viper.Set("repo.remote", "origin")
+	viper.Set("repo.upstream", "")
+	viper.Set("repo.push-remote", "")
+	viper.Set("repo.fork", "")
+	viper.Set("pr.reviewers", []string{})
+	viper.Set("pr.codeowners", false)
+	viper.Set("pr.rules", []any{})
+	viper.Set("pr.template", "")
+	viper.Set("pr.stack", false)
 	viper.Set("story.tool", "linear")
 	viper.Set("story.url", "https://my.base.url/browse")
 	viper.Set("story.token", "my token")
+	core.ForgetResolvedTokens()
 }
 
 func NewTestRepo(t *testing.T) *TestRepo {
@@ -68,12 +91,19 @@ func NewTestRepo(t *testing.T) *TestRepo {
 	githubConfig.Raw.Section("core").SetOption("hooksPath", "")
 	require.NoError(t, github.SetConfig(githubConfig))
 
+	storyFetcherMock := &StoryFetcherMock{}
+	// Updating the stories is only reported, the tests that care assert the calls.
+	storyFetcherMock.On("MoveStory", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	storyFetcherMock.On("AttachLink", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
 	repo := core.NewRepo(sourcePath)
 	mock := &GithubMock{
-		PullRequestsMock: &PullRequestsMock{},
-		IssuesMock:       &IssuesMock{},
+		PullRequestsMock:  &PullRequestsMock{},
+		IssuesMock:        &IssuesMock{},
+		ChecksMock:        &ChecksMock{},
+		RepositoriesMock:  &RepositoriesMock{},
+		AutoMergeMock:     &AutoMergeMock{},
+		ReviewThreadsMock: &ReviewThreadsMock{},
 	}
-	storyFetcherMock := &StoryFetcherMock{}
 	var out strings.Builder
 	var in bytes.Buffer
 	testRepo := TestRepo{
@@ -90,10 +120,12 @@ func NewTestRepo(t *testing.T) *TestRepo {
 		In:               &in,
 		App: cmd.MakeApp(&out, &in, repo, func(context.Context) core.Gh {
 			return mock
-		}, func(string, string) story.StoryFetcher {
-			return storyFetcherMock
+		}, func(string, string) (story.StoryFetcher, error) {
+			return storyFetcherMock, nil
 		}),
 	}
+	// Return cli.Exit errors to the tests instead of exiting the process.
+	testRepo.App.ExitErrHandler = func(context.Context, *cli.Command, error) {}
 	testRepo.PrepareSource()
 	testRepo.AlwaysFailingEditor()
 	return &testRepo
@@ -152,7 +184,11 @@ func (r *TestRepo) PrepareSource() {
 func (r *TestRepo) AssertHasPr(t *testing.T, n int) *core.LocalPr {
 	_, err := r.Source.Branch(fmt.Sprintf("pr/%d", n))
 	assert.Nil(t, err)
-	_, err = r.GithubRepo.Reference(plumbing.NewBranchReferenceName(fmt.Sprintf("cupcicm/pr/%d", n)), true)
+	remote := r.GithubRepo
+	if r.Fork != nil {
+		remote = r.Fork
+	}
+	_, err = remote.Reference(plumbing.NewBranchReferenceName(fmt.Sprintf("cupcicm/pr/%d", n)), true)
 	assert.Nil(t, err)
 
 	return core.NewLocalPr(r.Repo, n)
@@ -185,10 +221,16 @@ func (r *TestRepo) CreatePrAssertPrDetailsWithStories(t *testing.T, ref string,
 	return pr
 }
 
+// MergePr merges pr, and expects the PRs that depend on it to be retargeted to master.
 func (r *TestRepo) MergePr(t *testing.T, pr *core.LocalPr) error {
 	tip := core.Must(r.GetLocalTip(pr))
 	r.GithubMock.PullRequestsMock.CallGetAndReturnMergeable(pr.PrNumber, true)
 	r.GithubMock.PullRequestsMock.CallMerge(pr.PrNumber, tip)
+	for _, other := range r.AllPrs(context.Background()) {
+		if ancestor, err := other.GetAncestor(); err == nil && ancestor.LocalName() == pr.LocalName() {
+			r.GithubMock.PullRequestsMock.CallEditBase(other.PrNumber, "master")
+		}
+	}
 	err := r.Run("merge", fmt.Sprintf("pr/%d", pr.PrNumber))
 	if err != nil {
 		return err
@@ -196,9 +238,25 @@ func (r *TestRepo) MergePr(t *testing.T, pr *core.LocalPr) error {
 	return r.Push(context.Background(), tip, r.BaseBranch().RemoteName())
 }
 
+// CallMergeAndUpdateBase expects a merge of pr on github, and simulates it
+// by pushing the local tip of pr (as it is at merge time) to the base branch.
+func (r *TestRepo) CallMergeAndUpdateBase(pr *core.LocalPr) {
+	var tip string
+	r.GithubMock.PullRequestsMock.On("Merge", mock.Anything, "cupcicm", "opp", pr.PrNumber, "", mock.Anything).Run(func(mock.Arguments) {
+		tip = core.Must(r.GetLocalTip(pr))
+		core.Must(0, r.Push(context.Background(), tip, r.BaseBranch().RemoteName()))
+	}).Return(
+		&github.PullRequestMergeResult{SHA: &tip}, nil, nil,
+	).Once()
+}
+
 type GithubMock struct {
 	*PullRequestsMock
 	*IssuesMock
+	*ChecksMock
+	*RepositoriesMock
+	*AutoMergeMock
+	*ReviewThreadsMock
 }
 
 func (g GithubMock) PullRequests() core.GhPullRequest {
@@ -207,6 +265,18 @@ func (g GithubMock) PullRequests() core.GhPullRequest {
 func (g GithubMock) Issues() core.GhIssues {
 	return g.IssuesMock
 }
+func (g GithubMock) Checks() core.GhChecks {
+	return g.ChecksMock
+}
+func (g GithubMock) Repositories() core.GhRepositories {
+	return g.RepositoriesMock
+}
+func (g GithubMock) AutoMerge() core.GhAutoMerge {
+	return g.AutoMergeMock
+}
+func (g GithubMock) ReviewThreads() core.GhReviewThreads {
+	return g.ReviewThreadsMock
+}
 
 type PullRequestsMock struct {
 	mock.Mock
@@ -214,6 +284,18 @@ type PullRequestsMock struct {
 type IssuesMock struct {
 	mock.Mock
 }
+type ChecksMock struct {
+	mock.Mock
+}
+type RepositoriesMock struct {
+	mock.Mock
+}
+type AutoMergeMock struct {
+	mock.Mock
+}
+type ReviewThreadsMock struct {
+	mock.Mock
+}
 
 func (m *PullRequestsMock) List(ctx context.Context, owner string, repo string, opt *github.PullRequestListOptions) ([]*github.PullRequest, *github.Response, error) {
 	args := m.Mock.Called(ctx, owner, repo, opt)
@@ -234,6 +316,39 @@ func (m *PullRequestsMock) Merge(ctx context.Context, owner string, repo string,
 	args := m.Mock.Called(ctx, owner, repo, number, commitMessage, options)
 	return args.Get(0).(*github.PullRequestMergeResult), nil, args.Error(2)
 }
+
+func (m *PullRequestsMock) Edit(ctx context.Context, owner string, repo string, number int, pull *github.PullRequest) (*github.PullRequest, *github.Response, error) {
+	args := m.Mock.Called(ctx, owner, repo, number, pull)
+	return args.Get(0).(*github.PullRequest), nil, args.Error(2)
+}
+
+func (m *PullRequestsMock) ListReviews(ctx context.Context, owner string, repo string, number int, opts *github.ListOptions) ([]*github.PullRequestReview, *github.Response, error) {
+	args := m.Mock.Called(ctx, owner, repo, number, opts)
+	response, _ := args.Get(1).(*github.Response)
+	return args.Get(0).([]*github.PullRequestReview), response, args.Error(2)
+}
+
+func (m *PullRequestsMock) ListReviewers(ctx context.Context, owner string, repo string, number int, opts *github.ListOptions) (*github.Reviewers, *github.Response, error) {
+	args := m.Mock.Called(ctx, owner, repo, number, opts)
+	response, _ := args.Get(1).(*github.Response)
+	return args.Get(0).(*github.Reviewers), response, args.Error(2)
+}
+
+func (m *PullRequestsMock) RequestReviewers(ctx context.Context, owner string, repo string, number int, reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error) {
+	args := m.Mock.Called(ctx, owner, repo, number, reviewers)
+	return args.Get(0).(*github.PullRequest), nil, args.Error(2)
+}
+
+// CallRequestReviewers expects a review request for the given users and team slugs.
+func (m *PullRequestsMock) CallRequestReviewers(prNumber int, reviewers []string, teams []string) {
+	m.On("RequestReviewers", mock.Anything, "cupcicm", "opp", prNumber, github.ReviewersRequest{
+		Reviewers:     reviewers,
+		TeamReviewers: teams,
+	}).Return(
+		&github.PullRequest{Number: &prNumber}, nil, nil,
+	).Once()
+}
+
 func (m *IssuesMock) ListByRepo(ctx context.Context, owner string, repo string, opts *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error) {
 	args := m.Mock.Called(ctx, owner, repo, opts)
 	return args.Get(0).([]*github.Issue), nil, args.Error(2)
@@ -244,6 +359,50 @@ func (m *IssuesMock) CreateComment(ctx context.Context, owner string, repo strin
 	return args.Get(0).(*github.IssueComment), nil, args.Error(2)
 }
 
+func (m *IssuesMock) AddAssignees(ctx context.Context, owner string, repo string, number int, assignees []string) (*github.Issue, *github.Response, error) {
+	args := m.Mock.Called(ctx, owner, repo, number, assignees)
+	return args.Get(0).(*github.Issue), nil, args.Error(2)
+}
+
+func (m *IssuesMock) CallAddAssignees(prNumber int, assignees ...string) {
+	m.On("AddAssignees", mock.Anything, "cupcicm", "opp", prNumber, assignees).Return(
+		&github.Issue{Number: &prNumber}, nil, nil,
+	).Once()
+}
+
+func (m *IssuesMock) AddLabelsToIssue(ctx context.Context, owner string, repo string, number int, labels []string) ([]*github.Label, *github.Response, error) {
+	args := m.Mock.Called(ctx, owner, repo, number, labels)
+	return args.Get(0).([]*github.Label), nil, args.Error(2)
+}
+
+func (m *IssuesMock) ListMilestones(ctx context.Context, owner string, repo string, opts *github.MilestoneListOptions) ([]*github.Milestone, *github.Response, error) {
+	args := m.Mock.Called(ctx, owner, repo, opts)
+	return args.Get(0).([]*github.Milestone), nil, args.Error(2)
+}
+
+func (m *IssuesMock) Edit(ctx context.Context, owner string, repo string, number int, issue *github.IssueRequest) (*github.Issue, *github.Response, error) {
+	args := m.Mock.Called(ctx, owner, repo, number, issue)
+	return args.Get(0).(*github.Issue), nil, args.Error(2)
+}
+
+func (m *IssuesMock) CallAddLabels(prNumber int, labels ...string) {
+	m.On("AddLabelsToIssue", mock.Anything, "cupcicm", "opp", prNumber, labels).Return(
+		[]*github.Label{}, nil, nil,
+	).Once()
+}
+
+// CallSetMilestone expects the PR to be added to the milestone with the given title,
+// which is the only open milestone of the repo and has number 1.
+func (m *IssuesMock) CallSetMilestone(prNumber int, title string) {
+	number := 1
+	m.On("ListMilestones", mock.Anything, "cupcicm", "opp", mock.Anything).Return(
+		[]*github.Milestone{{Number: &number, Title: &title}}, nil, nil,
+	).Once()
+	m.On("Edit", mock.Anything, "cupcicm", "opp", prNumber, &github.IssueRequest{Milestone: &number}).Return(
+		&github.Issue{Number: &prNumber}, nil, nil,
+	).Once()
+}
+
 func (m *IssuesMock) CallListAndReturnPr(prNumber int) {
 	pr := github.Issue{
 		Number: &prNumber,
@@ -267,9 +426,16 @@ func (m *PullRequestsMock) CallGetAndReturnMergeable(prNumber int, mergeable boo
 	if mergeable {
 		reason = "clean"
 	}
+	m.CallGetAndReturnMergeableState(prNumber, reason)
+}
+
+func (m *PullRequestsMock) CallGetAndReturnMergeableState(prNumber int, reason string) {
+	mergeable := reason == "clean"
 	state := "open"
+	nodeID := PrNodeID(prNumber)
 	pr := github.PullRequest{
 		Number:         &prNumber,
+		NodeID:         &nodeID,
 		Mergeable:      &mergeable,
 		MergeableState: &reason,
 		State:          &state,
@@ -278,6 +444,73 @@ func (m *PullRequestsMock) CallGetAndReturnMergeable(prNumber int, mergeable boo
 		&pr, nil, nil,
 	).Once()
 }
+
+func (m *PullRequestsMock) CallGetAndReturnMerged(prNumber int) {
+	merged := true
+	state := "closed"
+	nodeID := PrNodeID(prNumber)
+	pr := github.PullRequest{
+		Number: &prNumber,
+		NodeID: &nodeID,
+		Merged: &merged,
+		State:  &state,
+	}
+	m.On("Get", mock.Anything, "cupcicm", "opp", prNumber).Return(
+		&pr, nil, nil,
+	).Once()
+}
+
+// CallListReviews returns reviews built from login and state pairs
+// (e.g. {"alice", "APPROVED"}).
+func (m *PullRequestsMock) CallListReviews(prNumber int, reviews ...[2]string) {
+	m.CallListReviewsPage(prNumber, 0, reviews...)
+}
+
+// CallListReviewsPage returns a page of reviews, nextPage is 0 on the last one.
+func (m *PullRequestsMock) CallListReviewsPage(prNumber int, nextPage int, reviews ...[2]string) {
+	result := make([]*github.PullRequestReview, 0, len(reviews))
+	for _, review := range reviews {
+		login, state := review[0], review[1]
+		result = append(result, &github.PullRequestReview{
+			User:  &github.User{Login: &login},
+			State: &state,
+		})
+	}
+	m.On("ListReviews", mock.Anything, "cupcicm", "opp", prNumber, mock.Anything).Return(
+		result, &github.Response{NextPage: nextPage}, nil,
+	).Once()
+}
+
+// CallListReviewers returns the pending review requests of the PR.
+// Reviewers containing a slash (org/team) are returned as teams.
+func (m *PullRequestsMock) CallListReviewers(prNumber int, reviewers ...string) {
+	result := github.Reviewers{}
+	for _, reviewer := range reviewers {
+		reviewer := reviewer
+		if _, slug, isTeam := strings.Cut(reviewer, "/"); isTeam {
+			result.Teams = append(result.Teams, &github.Team{Slug: &slug})
+		} else {
+			result.Users = append(result.Users, &github.User{Login: &reviewer})
+		}
+	}
+	m.On("ListReviewers", mock.Anything, "cupcicm", "opp", prNumber, mock.Anything).Return(
+		&result, nil, nil,
+	).Once()
+}
+
+// CallStatus mocks everything opp status looks up on github for a PR
+// that has not been reviewed yet.
+func (m *GithubMock) CallStatus(prNumber int, mergeable bool) {
+	m.PullRequestsMock.CallGetAndReturnMergeable(prNumber, mergeable)
+	m.PullRequestsMock.CallListReviews(prNumber)
+	m.PullRequestsMock.CallListReviewers(prNumber)
+	m.ReviewThreadsMock.CallCountUnresolved(prNumber, 0)
+}
+
+// The GraphQL id of the PR, as returned by the PR mocks.
+func PrNodeID(prNumber int) string {
+	return fmt.Sprintf("PR_%d", prNumber)
+}
 func (m *PullRequestsMock) CallGetAndReturnMergeabilityBeingEvaluated(prNumber int) {
 	reason := "clean"
 	state := "open"
@@ -301,6 +534,159 @@ func (m *PullRequestsMock) CallMerge(prNumber int, tip string) {
 	).Once()
 }
 
+// CallGetAndReturnBody returns an open PR with the given title and body.
+func (m *PullRequestsMock) CallGetAndReturnBody(prNumber int, title string, body string) {
+	state := "open"
+	pr := github.PullRequest{
+		Number: &prNumber,
+		Title:  &title,
+		Body:   &body,
+		State:  &state,
+	}
+	m.On("Get", mock.Anything, "cupcicm", "opp", prNumber).Return(
+		&pr, nil, nil,
+	).Once()
+}
+
+// PushToFork adds a fork remote, and makes opp push the PR branches to it.
+func (r *TestRepo) PushToFork(t *testing.T) {
+	forkPath := path.Join(path.Dir(r.Paths.Destination), "fork")
+	r.Fork = core.Must(git.PlainInit(forkPath, true))
+	require.NoError(t, r.GitExec(context.Background(), "remote add fork %s", forkPath).Run())
+	viper.Set("repo.upstream", "origin")
+	viper.Set("repo.push-remote", "fork")
+	viper.Set("repo.fork", "alice/opp")
+}
+
+// CallGetAndReturnBranches returns an open PR from head to base, both branches of cupcicm/opp.
+func (m *PullRequestsMock) CallGetAndReturnBranches(prNumber int, head string, base string) {
+	m.CallGetAndReturnForkBranches(prNumber, "cupcicm/opp", head, base)
+}
+
+// CallGetAndReturnForkBranches returns an open PR from head in headRepo to base in cupcicm/opp.
+func (m *PullRequestsMock) CallGetAndReturnForkBranches(prNumber int, headRepo string, head string, base string) {
+	state := "open"
+	repo := "cupcicm/opp"
+	pr := github.PullRequest{
+		Number: &prNumber,
+		State:  &state,
+		Head:   &github.PullRequestBranch{Ref: &head, Repo: &github.Repository{FullName: &headRepo}},
+		Base:   &github.PullRequestBranch{Ref: &base, Repo: &github.Repository{FullName: &repo}},
+	}
+	m.On("Get", mock.Anything, "cupcicm", "opp", prNumber).Return(
+		&pr, nil, nil,
+	).Once()
+}
+
+func (m *PullRequestsMock) CallEditBody(prNumber int, body string) {
+	pr := github.PullRequest{
+		Number: &prNumber,
+	}
+	m.On("Edit", mock.Anything, "cupcicm", "opp", prNumber, mock.MatchedBy(func(pull *github.PullRequest) bool {
+		return pull.GetBody() == body
+	})).Return(
+		&pr, nil, nil,
+	).Once()
+}
+
+func (m *PullRequestsMock) CallEditBase(prNumber int, base string) {
+	pr := github.PullRequest{
+		Number: &prNumber,
+	}
+	m.On("Edit", mock.Anything, "cupcicm", "opp", prNumber, mock.MatchedBy(func(pull *github.PullRequest) bool {
+		return pull.GetBase().GetRef() == base
+	})).Return(
+		&pr, nil, nil,
+	).Once()
+}
+
+func (m *ChecksMock) ListCheckRunsForRef(ctx context.Context, owner string, repo string, ref string, opts *github.ListCheckRunsOptions) (*github.ListCheckRunsResults, *github.Response, error) {
+	args := m.Mock.Called(ctx, owner, repo, ref, opts)
+	response, _ := args.Get(1).(*github.Response)
+	return args.Get(0).(*github.ListCheckRunsResults), response, args.Error(2)
+}
+
+// CallListCheckRuns returns check runs built from name, status and conclusion triplets.
+func (m *ChecksMock) CallListCheckRuns(runs ...[3]string) {
+	m.CallListCheckRunsPage(0, runs...)
+}
+
+// CallListCheckRunsPage returns a page of check runs, nextPage is 0 on the last one.
+func (m *ChecksMock) CallListCheckRunsPage(nextPage int, runs ...[3]string) {
+	result := github.ListCheckRunsResults{}
+	for _, run := range runs {
+		name, status, conclusion := run[0], run[1], run[2]
+		url := fmt.Sprintf("https://ci.example.com/%s", name)
+		checkRun := github.CheckRun{
+			Name:    &name,
+			Status:  &status,
+			HTMLURL: &url,
+		}
+		if conclusion != "" {
+			checkRun.Conclusion = &conclusion
+		}
+		result.CheckRuns = append(result.CheckRuns, &checkRun)
+	}
+	m.On("ListCheckRunsForRef", mock.Anything, "cupcicm", "opp", mock.Anything, mock.Anything).Return(
+		&result, &github.Response{NextPage: nextPage}, nil,
+	).Once()
+}
+
+func (m *RepositoriesMock) GetCombinedStatus(ctx context.Context, owner string, repo string, ref string, opts *github.ListOptions) (*github.CombinedStatus, *github.Response, error) {
+	args := m.Mock.Called(ctx, owner, repo, ref, opts)
+	response, _ := args.Get(1).(*github.Response)
+	return args.Get(0).(*github.CombinedStatus), response, args.Error(2)
+}
+
+// CallGetCombinedStatus returns commit statuses built from context and state pairs.
+func (m *RepositoriesMock) CallGetCombinedStatus(statuses ...[2]string) {
+	m.CallGetCombinedStatusPage(0, statuses...)
+}
+
+// CallGetCombinedStatusPage returns a page of commit statuses, nextPage is 0 on the last one.
+func (m *RepositoriesMock) CallGetCombinedStatusPage(nextPage int, statuses ...[2]string) {
+	result := github.CombinedStatus{}
+	for _, status := range statuses {
+		context, state := status[0], status[1]
+		url := fmt.Sprintf("https://ci.example.com/%s", context)
+		result.Statuses = append(result.Statuses, &github.RepoStatus{
+			Context:   &context,
+			State:     &state,
+			TargetURL: &url,
+		})
+	}
+	m.On("GetCombinedStatus", mock.Anything, "cupcicm", "opp", mock.Anything, mock.Anything).Return(
+		&result, &github.Response{NextPage: nextPage}, nil,
+	).Once()
+}
+
+func (m *AutoMergeMock) Enable(ctx context.Context, pullRequestID string, mergeMethod string) error {
+	args := m.Mock.Called(ctx, pullRequestID, mergeMethod)
+	return args.Error(0)
+}
+
+func (m *AutoMergeMock) Disable(ctx context.Context, pullRequestID string) error {
+	args := m.Mock.Called(ctx, pullRequestID)
+	return args.Error(0)
+}
+
+func (m *AutoMergeMock) CallEnable(prNumber int) {
+	m.On("Enable", mock.Anything, PrNodeID(prNumber), mock.Anything).Return(nil).Once()
+}
+
+func (m *AutoMergeMock) CallDisable(prNumber int) {
+	m.On("Disable", mock.Anything, PrNodeID(prNumber)).Return(nil).Once()
+}
+
+func (m *ReviewThreadsMock) CountUnresolved(ctx context.Context, owner string, repo string, number int) (int, error) {
+	args := m.Mock.Called(ctx, owner, repo, number)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *ReviewThreadsMock) CallCountUnresolved(prNumber int, unresolved int) {
+	m.On("CountUnresolved", mock.Anything, "cupcicm", "opp", prNumber).Return(unresolved, nil).Once()
+}
+
 type StoryFetcherMock struct {
 	mock.Mock
 }
@@ -310,6 +696,14 @@ func (s *StoryFetcherMock) FetchInProgressStories(ctx context.Context) ([]story.
 	return args.Get(0).([]story.Story), args.Error(1)
 }
 
+func (s *StoryFetcherMock) MoveStory(ctx context.Context, identifier, state string) error {
+	return s.Mock.Called(ctx, identifier, state).Error(0)
+}
+
+func (s *StoryFetcherMock) AttachLink(ctx context.Context, identifier, url, title string) error {
+	return s.Mock.Called(ctx, identifier, url, title).Error(0)
+}
+
 func (s *StoryFetcherMock) CallFetchInProgressStories(stories []story.Story, fetchError bool) {
 	var err error
 	if fetchError {
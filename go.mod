@@ -3,6 +3,7 @@ module github.com/cupcicm/opp
 go 1.21
 
 require (
+	github.com/atotto/clipboard v0.1.4
 	github.com/avast/retry-go v3.0.0+incompatible
 	github.com/go-git/go-git/v5 v5.9.0
 	github.com/google/go-github/v56 v56.0.0
@@ -11,13 +12,12 @@ require (
 	github.com/urfave/cli/v3 v3.0.0-alpha9.6
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d
 	golang.org/x/oauth2 v0.13.0
-	golang.org/x/text v0.13.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/atotto/clipboard v0.1.4 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/text v0.13.0 // indirect
 )
 
 require (
@@ -22,7 +22,7 @@ func gh(ctx context.Context) core.Gh {
 	return core.NewClient(ctx)
 }
 
-func sf(tool, token string) story.StoryFetcher {
+func sf(tool, token string) (story.StoryFetcher, error) {
 	return story.NewStoryFetcher(tool, token)
 }
 